@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/usalko/prodl/internal/dump_extractor"
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// extractCmd represents the extract command
+var extractCmd = &cobra.Command{
+	Use:   "extract",
+	Short: "The 'extract' subcommand will export the table data of dump to csv or jsonl files.",
+	Long: `The 'extract' subcommand writes the rows of INSERT ... VALUES statements and
+of COPY ... FROM stdin data to the file per table without the database. The header
+of the file is taken from the CREATE TABLE statement. For example:
+
+'<cmd> extract --dialect mysql --table orders dump-file-name.sql.gz'.
+
+'<cmd> extract --table 'order%' --format jsonl --output-dir ./orders dump-file-name.tar.gz'.`,
+	Args: cobra.RangeArgs(1, MAX_COUNT_FOR_PROCESSING_FILES),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode := extract(cmd, args)
+		if exitCode != EXIT_CODE_OK {
+			os.Exit(exitCode)
+		}
+	},
+}
+
+func init() {
+	extractCmd.Flags().StringP("dialect", "s", "pg", `
+Sql dialect of the dump: mysql, sqlite3 or pg
+`)
+	extractCmd.Flags().StringArrayP("table", "t", nil, `
+Extract the tables which match the pattern, the option can be repeated (all tables by default).
+The pattern is the LIKE pattern (orders, order%) or the glob pattern (order*),
+it's matched against the table name and the name qualified by the schema (public.orders).
+`)
+	extractCmd.Flags().StringP("format", "f", "csv", `
+Output format: csv or jsonl. The NULL is the empty field of csv and null of jsonl
+`)
+	extractCmd.Flags().StringP("output-dir", "o", ".", `
+Directory for the files of tables, the file is named <table>.csv or <table>.jsonl
+`)
+	rootCmd.AddCommand(extractCmd)
+}
+
+func extract(cmd *cobra.Command, args []string) int {
+	dialectName, _ := cmd.Flags().GetString("dialect")
+	tables, _ := cmd.Flags().GetStringArray("table")
+	formatName, _ := cmd.Flags().GetString("format")
+	outputDir, _ := cmd.Flags().GetString("output-dir")
+	sqlDialect, _, err := (*dialect.SqlDialect).ParseUrl(nil, dialectName+"://")
+	if err != nil {
+		rootCmd.PrintErrf("unknown dialect %v\n", dialectName)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	format, err := dump_extractor.ParseExtractFormat(formatName)
+	if err != nil {
+		rootCmd.PrintErrf("%v\n", err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	var filter *dump_rewriter.TableFilter
+	if len(tables) > 0 {
+		filter, err = dump_rewriter.NewTableFilter(tables, nil, sqlDialect)
+		if err != nil {
+			rootCmd.PrintErrf("table filter fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		rootCmd.PrintErrf("make output directory %v fail with error: %v\n", outputDir, err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+
+	exitCode := EXIT_CODE_OK
+	extractor := dump_extractor.NewExtractor(sqlDialect, filter, format, outputDir)
+	for _, fileName := range args {
+		rootCmd.Printf("process file %v\n", fileName)
+		reader, closer, err := openArchiveReader(fileName)
+		if err != nil {
+			rootCmd.PrintErrf("%v\n", err)
+			exitCode = EXIT_CODE_FATAL_ERROR
+			continue
+		}
+		err = extractor.Extract(reader)
+		closer.Close()
+		if err != nil {
+			rootCmd.PrintErrf("extract file %v fail with error: %v\n", fileName, err)
+			exitCode = EXIT_CODE_FATAL_ERROR
+		}
+	}
+	if err := extractor.Close(); err != nil {
+		rootCmd.PrintErrf("close extracted files fail with error: %v\n", err)
+		exitCode = EXIT_CODE_FATAL_ERROR
+	}
+
+	for _, table := range extractor.Tables() {
+		rootCmd.Printf("table %v: rows %v, file %v\n", table, extractor.Rows(table), extractor.FileName(table))
+	}
+	if len(extractor.Tables()) == 0 {
+		rootCmd.PrintErrf("no tables are extracted\n")
+	}
+	if extractor.ParseErrors() > 0 {
+		rootCmd.PrintErrf("statements which can't be parsed: %v, their rows aren't extracted\n", extractor.ParseErrors())
+		if exitCode == EXIT_CODE_OK {
+			exitCode = EXIT_CODE_STATEMENTS_FAILED
+		}
+	}
+	return exitCode
+}
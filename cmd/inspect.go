@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/usalko/prodl/internal/dump_inspector"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "The 'inspect' subcommand will show the content of dump without loading.",
+	Long: `The 'inspect' subcommand lists the entries of a sql dump with the statistics
+of statements: counts by the statement type, created tables, rows by the table
+and parse errors. For example:
+
+'<cmd> inspect --dialect pg dump-file-name.tar.gz'.
+
+'<cmd> inspect --format json dump-file-name.zip'.`,
+	Args: cobra.RangeArgs(1, MAX_COUNT_FOR_PROCESSING_FILES),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode := inspect(cmd, args)
+		if exitCode != EXIT_CODE_OK {
+			os.Exit(exitCode)
+		}
+	},
+}
+
+func init() {
+	inspectCmd.Flags().StringP("dialect", "s", "pg", `
+Sql dialect of the dump: mysql, sqlite3 or pg
+`)
+	inspectCmd.Flags().StringP("format", "f", "table", `
+Output format: table or json
+`)
+	rootCmd.AddCommand(inspectCmd)
+}
+
+func inspect(cmd *cobra.Command, args []string) int {
+	dialectName, _ := cmd.Flags().GetString("dialect")
+	format, _ := cmd.Flags().GetString("format")
+	sqlDialect, _, err := (*dialect.SqlDialect).ParseUrl(nil, dialectName+"://")
+	if err != nil {
+		rootCmd.PrintErrf("unknown dialect %v\n", dialectName)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	if format != "table" && format != "json" {
+		rootCmd.PrintErrf("unknown format %v, the format should be table or json\n", format)
+		return EXIT_CODE_FATAL_ERROR
+	}
+
+	exitCode := EXIT_CODE_OK
+	fileReports := make([]*fileReport, 0, len(args))
+	for _, fileName := range args {
+		report, err := inspectFile(fileName, sqlDialect)
+		if err != nil {
+			rootCmd.PrintErrf("inspect file %v fail with error: %v\n", fileName, err)
+			exitCode = EXIT_CODE_FATAL_ERROR
+		}
+		fileReports = append(fileReports, report)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(fileReports); err != nil {
+			rootCmd.PrintErrf("encode report fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+		return exitCode
+	}
+	for _, report := range fileReports {
+		printFileReport(cmd.OutOrStdout(), report)
+	}
+	return exitCode
+}
+
+type fileReport struct {
+	FileName string                        `json:"fileName"`
+	Entries  []*dump_inspector.EntryReport `json:"entries"`
+	Error    string                        `json:"error,omitempty"`
+}
+
+func inspectFile(fileName string, sqlDialect dialect.SqlDialect) (*fileReport, error) {
+	report := &fileReport{FileName: fileName, Entries: make([]*dump_inspector.EntryReport, 0)}
+	reader, closer, err := openArchiveReader(fileName)
+	if err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+	defer closer.Close()
+
+	report.Entries, err = dump_inspector.Inspect(reader, sqlDialect)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report, err
+}
+
+func printFileReport(out io.Writer, report *fileReport) {
+	fmt.Fprintf(out, "file %v\n", report.FileName)
+	for _, entry := range report.Entries {
+		modified := "-"
+		if !entry.Modified.IsZero() {
+			modified = entry.Modified.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "\nentry %q, size %v, modified %v\n", entry.Name, entry.Size, modified)
+
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "  STATEMENT TYPE\tCOUNT")
+		for _, statementType := range sortedKeys(entry.StatementTypes) {
+			fmt.Fprintf(writer, "  %v\t%v\n", statementType, entry.StatementTypes[statementType])
+		}
+		writer.Flush()
+
+		if len(entry.Tables) > 0 {
+			fmt.Fprintf(out, "  tables created: %v\n", strings.Join(entry.Tables, ", "))
+		}
+		if len(entry.Rows) > 0 {
+			writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "  TABLE\tROWS")
+			for _, table := range sortedKeys(entry.Rows) {
+				fmt.Fprintf(writer, "  %v\t%v\n", table, entry.Rows[table])
+			}
+			writer.Flush()
+		}
+		if len(entry.ParseErrors) > 0 {
+			fmt.Fprintf(out, "  parse errors: %v\n", len(entry.ParseErrors))
+			for _, parseError := range entry.ParseErrors {
+				fmt.Fprintf(out, "    offset %v, %v: %v\n", parseError.Offset, parseError.Statement, parseError.Error)
+			}
+		}
+	}
+	if report.Error != "" {
+		fmt.Fprintf(out, "\nerror: %v\n", report.Error)
+	}
+	fmt.Fprintln(out)
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/load_checkpoint"
+	"github.com/usalko/prodl/internal/load_jobs"
 	"github.com/usalko/prodl/internal/sql_connection"
 	"github.com/usalko/prodl/internal/sql_parser"
 	"github.com/usalko/prodl/internal/sql_parser/ast"
@@ -16,55 +21,366 @@ import (
 
 const MAX_COUNT_FOR_PROCESSING_FILES = 1024
 
+// The batch size of the load with the checkpoint if --batch-size and --batch-bytes aren't defined,
+// the checkpoint is saved after every commit
+const CHECKPOINT_BATCH_SIZE = 1000
+
 // loadCmd represents the load command
 var loadCmd = &cobra.Command{
 	Use:   "load",
 	Short: "The 'load' subcommand will load dump to the database.",
 	Long: `The 'load' subcommand loads a sql dump to the database. For example:
 
-'<cmd> load --to sqlite3://./local.sqlite3 dump-file-name.tar.gz'.`,
+'<cmd> load --to sqlite3://./local.sqlite3 dump-file-name.tar.gz'.
+
+The directory of 'pg_dump -Fd' can be loaded as well:
+
+'<cmd> load -c pg://username:password@localhost:5432/database_name dump-directory'.
+
+The processed statements can be written to the sql file instead of the database:
+
+'<cmd> load --source-dialect mysql -c 'file://./out.sql?dialect=pg' dump-file-name.sql.gz'.
+
+The dump can be checked without the database, the statements are parsed only:
+
+'<cmd> load --dry-run -c pg:// dump-file-name.sql.gz' or '<cmd> load -c null://pg dump-file-name.sql.gz'.`,
 	Args: cobra.RangeArgs(1, MAX_COUNT_FOR_PROCESSING_FILES),
 	Run: func(cmd *cobra.Command, args []string) {
-		debugLevel, _ := cmd.Flags().GetInt("debug-level")
-		targetSqlUrl, _ := cmd.Flags().GetString("target-sql-connection")
-		sqlDialect, connectionOptions, err := (*dialect.SqlDialect).ParseUrl(nil, targetSqlUrl)
+		exitCode := load(cmd, args)
+		if exitCode != EXIT_CODE_OK {
+			os.Exit(exitCode)
+		}
+	},
+}
+
+// Exit codes of the load command
+const (
+	EXIT_CODE_OK                = 0
+	EXIT_CODE_FATAL_ERROR       = 1 // The connection or a file fail, or the limit of errors is reached
+	EXIT_CODE_STATEMENTS_FAILED = 2 // Some statements are not parsed or not executed
+)
+
+var errMaxErrorsReached = errors.New("the limit of errors is reached")
+
+// loadSummary counts the results of the load for all files,
+// the statements of parallel jobs are counted concurrently
+type loadSummary struct {
+	mutex           sync.Mutex
+	files           int
+	failedFiles     int
+	statements      int
+	skipped         int // Statements of the sections and tables which aren't selected
+	rows            uint64
+	parseErrors     int
+	executionErrors int
+	maxErrors       int // The limit of parse and execution errors, zero is unlimited
+	startTime       time.Time
+	lastTime        time.Time // The time of the last statement
+}
+
+// addStatement counts the statement and returns the count of statements
+// and the duration of the statement processing
+func (summary *loadSummary) addStatement() (int, time.Duration) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.statements++
+	now := time.Now()
+	duration := now.Sub(summary.lastTime)
+	summary.lastTime = now
+	return summary.statements, duration
+}
+
+func (summary *loadSummary) addRows(rows uint64) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.rows += rows
+}
+
+func (summary *loadSummary) addSkipped() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.skipped++
+}
+
+func (summary *loadSummary) addParseError() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.parseErrors++
+}
+
+func (summary *loadSummary) addExecutionError() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	summary.executionErrors++
+}
+
+func (summary *loadSummary) errors() int {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	return summary.parseErrors + summary.executionErrors
+}
+
+func (summary *loadSummary) isMaxErrorsReached() bool {
+	return summary.maxErrors > 0 && summary.errors() >= summary.maxErrors
+}
+
+func (summary *loadSummary) print() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+	rootCmd.Printf("files: %v (failed %v), statements: %v (skipped %v), rows: %v, parse errors: %v, execution errors: %v, elapsed time: %v\n",
+		summary.files, summary.failedFiles, summary.statements, summary.skipped, summary.rows,
+		summary.parseErrors, summary.executionErrors, time.Since(summary.startTime).Round(time.Millisecond))
+}
+
+func (summary *loadSummary) exitCode() int {
+	if summary.failedFiles > 0 || summary.isMaxErrorsReached() {
+		return EXIT_CODE_FATAL_ERROR
+	}
+	if summary.errors() > 0 {
+		return EXIT_CODE_STATEMENTS_FAILED
+	}
+	return EXIT_CODE_OK
+}
+
+// loader loads the statements of files to the connection
+// or to the parallel jobs (if the jobs are defined)
+type loader struct {
+	sqlDialect dialect.SqlDialect // Dialect of the dump
+	connection sql_connection.SqlConnection
+	jobs       *load_jobs.LoadJobs
+	translator *dump_rewriter.DialectTranslator   // Translates the statements into the dialect of target, nil if the dialects are the same
+	deferrer   *dump_rewriter.IndexDeferrer       // Defers the secondary indexes and foreign keys, nil if disabled
+	checkpoint *loadCheckpoint                    // Saves the position of committed statements, nil if disabled
+	filter     *dump_rewriter.TableFilter         // Selects the statements by the tables, nil if disabled
+	sections   map[dump_rewriter.DumpSection]bool // Selected sections of the dump, nil if all sections are loaded
+	rowFilter  *dump_rewriter.RowFilter           // Selects the rows of INSERT and COPY data, nil if disabled
+	masker     *dump_rewriter.DataMasker          // Masks the values of columns, nil if disabled
+	renamer    *dump_rewriter.TableRenamer        // Renames the tables and maps the schemas, nil if disabled
+	summary    *loadSummary
+	debugLevel int
+}
+
+func load(cmd *cobra.Command, args []string) int {
+	debugLevel, _ := cmd.Flags().GetInt("debug-level")
+	targetSqlUrl, _ := cmd.Flags().GetString("target-sql-connection")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	maxErrors, _ := cmd.Flags().GetInt("max-errors")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	batchBytes, _ := cmd.Flags().GetInt("batch-bytes")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	deferIndexes, _ := cmd.Flags().GetBool("defer-indexes")
+	checkpointFile, _ := cmd.Flags().GetString("checkpoint")
+	includeTables, _ := cmd.Flags().GetStringArray("include-table")
+	excludeTables, _ := cmd.Flags().GetStringArray("exclude-table")
+	sectionNames, _ := cmd.Flags().GetStringArray("section")
+	sourceDialectName, _ := cmd.Flags().GetString("source-dialect")
+	maskRulesFile, _ := cmd.Flags().GetString("mask-rules")
+	rowConditions, _ := cmd.Flags().GetStringArray("where")
+	tableRenames, _ := cmd.Flags().GetStringArray("rename-table")
+	schemaMaps, _ := cmd.Flags().GetStringArray("map-schema")
+	targetConnection, sqlDialect, targetOptions, err := sql_connection.ConnectUrl(targetSqlUrl)
+	if err != nil {
+		rootCmd.PrintErrf("make connection structure for target url %v fail with error: %v\n", targetSqlUrl, err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	sourceDialect := sqlDialect
+	var translator *dump_rewriter.DialectTranslator
+	if sourceDialectName != "" {
+		sourceDialect, _, err = (*dialect.SqlDialect).ParseUrl(nil, sourceDialectName+"://")
 		if err != nil {
-			rootCmd.PrintErrf("parse target url %v fail with error: %v\n", targetSqlUrl, err)
-			return
+			rootCmd.PrintErrf("unknown source dialect %v\n", sourceDialectName)
+			return EXIT_CODE_FATAL_ERROR
 		}
-		connection, err := sql_connection.Connect(sqlDialect)
+	}
+	if sourceDialect != sqlDialect {
+		translator, err = dump_rewriter.NewDialectTranslator(sourceDialect, sqlDialect)
 		if err != nil {
-			rootCmd.PrintErrf("make connection structure for target url %v fail with error: %v\n", targetSqlUrl, err)
-			return
+			rootCmd.PrintErrf("%v\n", err)
+			return EXIT_CODE_FATAL_ERROR
 		}
-
-		err = connection.Establish(connectionOptions)
+	}
+	if _, isNop := targetConnection.(*sql_connection.NopConnection); isNop {
+		dryRun = true
+	}
+	_, isFile := targetConnection.(*sql_connection.FileConnection)
+	var filter *dump_rewriter.TableFilter
+	if len(includeTables) > 0 || len(excludeTables) > 0 {
+		filter, err = dump_rewriter.NewTableFilter(includeTables, excludeTables, sourceDialect)
 		if err != nil {
-			rootCmd.PrintErrf("establish connection for target url %v fail with error: %v\n", targetSqlUrl, err)
-			return
+			rootCmd.PrintErrf("table filter fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+	}
+	var sections map[dump_rewriter.DumpSection]bool
+	if len(sectionNames) > 0 {
+		sections = map[dump_rewriter.DumpSection]bool{dump_rewriter.SESSION_SECTION: true}
+		for _, sectionName := range sectionNames {
+			section, err := dump_rewriter.ParseDumpSection(sectionName)
+			if err != nil {
+				rootCmd.PrintErrf("%v\n", err)
+				return EXIT_CODE_FATAL_ERROR
+			}
+			sections[section] = true
+		}
+	}
+	var rowFilter *dump_rewriter.RowFilter
+	if len(rowConditions) > 0 {
+		rowFilter, err = dump_rewriter.NewRowFilter(rowConditions, sourceDialect)
+		if err != nil {
+			rootCmd.PrintErrf("row filter fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+	}
+	var masker *dump_rewriter.DataMasker
+	if maskRulesFile != "" {
+		rules, err := dump_rewriter.ReadMaskRules(maskRulesFile)
+		if err == nil {
+			masker, err = dump_rewriter.NewDataMasker(rules, sourceDialect)
+		}
+		if err != nil {
+			rootCmd.PrintErrf("masking rules fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+	}
+	var renamer *dump_rewriter.TableRenamer
+	if len(tableRenames) > 0 || len(schemaMaps) > 0 {
+		renamer, err = dump_rewriter.NewTableRenamer(tableRenames, schemaMaps, sourceDialect)
+		if err != nil {
+			rootCmd.PrintErrf("table renamer fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+	}
+	firstFile := 0
+	var checkpoint *loadCheckpoint
+	if checkpointFile != "" {
+		if dryRun || isFile || jobs > 1 || deferIndexes {
+			rootCmd.PrintErrf("checkpoint can't be used with the dry run, output file, parallel jobs or deferred indexes\n")
+			return EXIT_CODE_FATAL_ERROR
+		}
+		checkpoint, firstFile, err = newLoadCheckpoint(checkpointFile, args)
+		if err != nil {
+			rootCmd.PrintErrf("read checkpoint fail with error: %v\n", err)
+			return EXIT_CODE_FATAL_ERROR
+		}
+		if batchSize == 0 && batchBytes == 0 {
+			// The commits of statements are tracked by the batch connection
+			batchSize = CHECKPOINT_BATCH_SIZE
+		}
+	}
+	// connect makes the new established connection to the target
+	connect := func() (sql_connection.SqlConnection, error) {
+		connection, _, connectionOptions, err := sql_connection.ConnectUrl(targetSqlUrl)
+		if err != nil {
+			return nil, err
+		}
+		if dryRun {
+			connection = &sql_connection.NopConnection{}
 		}
+		if batchSize > 0 || batchBytes > 0 {
+			connection = sql_connection.NewBatchConnection(connection, batchSize, batchBytes)
+		}
+		return connection, connection.Establish(connectionOptions)
+	}
+
+	connection, err := connect()
+	if err != nil {
+		rootCmd.PrintErrf("establish connection for target url %v fail with error: %v\n", targetSqlUrl, err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	defer func() {
+		if err := connection.Close(); err != nil {
+			rootCmd.PrintErrf("close connection for target url %v fail with error: %v\n", targetSqlUrl, err)
+		}
+	}()
+	if checkpoint != nil {
+		connection.(*sql_connection.BatchConnection).SetCommitHandler(checkpoint.commit)
+	}
 
+	if dryRun {
+		rootCmd.Printf("dry run, the statements are parsed only (%v)\n", sourceDialect.String())
+	} else if isFile {
+		rootCmd.Printf("the statements are written to the file %v (%v)\n", targetOptions, sqlDialect.String())
+	} else {
 		// Test connection to the database
 		err = connection.Execute("select 1")
 		if err != nil {
 			rootCmd.PrintErrf("check connection for target url %v fail with error: %v\n", targetSqlUrl, err)
-			return
+			return EXIT_CODE_FATAL_ERROR
 		}
 		rootCmd.Printf("connection established\n")
-		// Open reader and do StatementStream
-		for _, fileName := range args {
-			rootCmd.Printf("process file %v", fileName)
-			err := processFile(fileName, sqlDialect, connection, debugLevel)
-			if err != nil {
-				rootCmd.Println(" - fail")
-				rootCmd.Println()
-				rootCmd.PrintErrf("Error is %v", err)
-				rootCmd.PrintErrln()
-			} else {
-				rootCmd.Println(" - ok")
-			}
+	}
+
+	summary := &loadSummary{maxErrors: maxErrors, startTime: time.Now(), lastTime: time.Now()}
+	ldr := &loader{
+		sqlDialect: sourceDialect,
+		connection: connection,
+		translator: translator,
+		checkpoint: checkpoint,
+		filter:     filter,
+		sections:   sections,
+		rowFilter:  rowFilter,
+		masker:     masker,
+		renamer:    renamer,
+		summary:    summary,
+		debugLevel: debugLevel,
+	}
+	if deferIndexes && sqlDialect == dialect.SQLITE3 {
+		rootCmd.PrintErrf("deferred indexes aren't supported for sqlite3 (the table can't be altered by adding of constraints), the indexes are created with tables\n")
+	} else if deferIndexes {
+		// The deferred statements are made in the dialect of the dump and translated with the other statements
+		ldr.deferrer = dump_rewriter.NewIndexDeferrer(sourceDialect)
+	}
+	if jobs > 1 && sqlDialect == dialect.SQLITE3 {
+		rootCmd.PrintErrf("parallel jobs aren't supported for sqlite3 (the database has the single writer), the statements are loaded serially\n")
+	} else if jobs > 1 && isFile {
+		rootCmd.PrintErrf("parallel jobs aren't supported for the output file, the statements are written serially\n")
+	} else if jobs > 1 {
+		ldr.jobs, err = load_jobs.NewLoadJobs(connection, jobs, connect, ldr.reportExecutionError)
+		if err != nil {
+			rootCmd.PrintErrf("establish connections of jobs for target url %v fail with error: %v\n", targetSqlUrl, err)
+			return EXIT_CODE_FATAL_ERROR
 		}
-	},
+	}
+	// Open reader and do StatementStream
+	for i, fileName := range args {
+		if i < firstFile {
+			rootCmd.Printf("file %v - skipped, it's loaded before the checkpoint\n", fileName)
+			continue
+		}
+		rootCmd.Printf("process file %v\n", fileName)
+		summary.files++
+		errorsBefore := summary.errors()
+		err := ldr.processFile(fileName)
+		if ldr.jobs != nil {
+			ldr.jobs.WaitAll()
+		}
+		if summary.isMaxErrorsReached() {
+			rootCmd.PrintErrf("file %v - aborted, %v\n", fileName, errMaxErrorsReached)
+			break
+		}
+		if err != nil {
+			summary.failedFiles++
+			rootCmd.PrintErrf("file %v - fail\n\nError is %v\n", fileName, err)
+		} else if fileErrors := summary.errors() - errorsBefore; fileErrors > 0 {
+			rootCmd.Printf("file %v - %v errors\n", fileName, fileErrors)
+		} else {
+			rootCmd.Printf("file %v - ok\n", fileName)
+		}
+	}
+	if ldr.deferrer != nil && !summary.isMaxErrorsReached() {
+		ldr.executeDeferred(ldr.deferrer.ReleaseAll())
+	}
+	if ldr.jobs != nil {
+		if err := ldr.jobs.Close(); err != nil {
+			rootCmd.PrintErrf("close connections of jobs for target url %v fail with error: %v\n", targetSqlUrl, err)
+		}
+	}
+	if checkpoint != nil && summary.failedFiles == 0 && !summary.isMaxErrorsReached() {
+		// The load is complete
+		checkpoint.remove()
+	}
+	summary.print()
+	return summary.exitCode()
 }
 
 func init() {
@@ -74,7 +390,119 @@ Sql url for loading dump file. Examples:
     mysql://user:password@/dbname            // [MySQL, MariaDB, TiDB]
     sqlite3://./local.sqlite3?cache=shared   // [Sqlite3]
     pg://username:password@localhost:5432/database_name    // [PostgresQL]
+    null://pg                                // [Dry run, the statements are parsed only]
+    file://./out.sql.gz?dialect=pg           // [Sql file, .gz and .zst are compressed]
+
+`)
+	loadCmd.Flags().Bool("dry-run", false, `
+Parse the dump without the database, the parse errors are reported with the entry name
+and byte offset of the statement. The exit code is non-zero if any statement fails.
+`)
+	loadCmd.Flags().Int("max-errors", 0, `
+Abort the load when the count of parse and execution errors reaches the limit,
+zero means no limit.
+
+Exit codes:
+
+    0 all statements are loaded
+    1 fatal error: the connection or a file fail, or the limit of errors is reached
+    2 some statements are not parsed or not executed
+
+`)
+	loadCmd.Flags().Int("batch-size", 0, `
+Execute the statements in transactions of the given count of statements,
+zero means the autocommit of every statement. The transactions of the dump
+(BEGIN ... COMMIT) and COPY statements are executed as is.
+`)
+	loadCmd.Flags().Int("batch-bytes", 0, `
+Execute the statements in transactions of the given size of statements text in bytes,
+zero means no limit. It can be used together with --batch-size.
+`)
+	loadCmd.Flags().IntP("jobs", "j", 1, `
+Count of parallel jobs, every job has own connection. The schema statements are
+executed serially, the data statements (INSERT and COPY) are loaded in parallel by
+the table. The statements of the table which wait for the data of the table
+(indexes, constraints) are executed after the data is loaded. The transactions
+and locks of the dump (BEGIN, COMMIT, LOCK TABLES) are skipped in the parallel mode.
+`)
+	loadCmd.Flags().Bool("defer-indexes", false, `
+Remove the secondary indexes and foreign keys from CREATE TABLE statements (mysql and pg)
+and create them after the data of the table is loaded: before the next statement which
+references the table or at the end of the load.
+`)
+	loadCmd.Flags().StringArray("include-table", nil, `
+Load the statements of the tables which match the pattern only, the option can be repeated.
+The pattern is the LIKE pattern (users%, audit_log) or the glob pattern (users*, log_[0-9]*),
+it's matched against the table name and the name qualified by the schema (public.users%).
+The statements of tables are CREATE, ALTER, DROP, TRUNCATE, INSERT, COPY and LOCK TABLES,
+the other statements are loaded.
+`)
+	loadCmd.Flags().StringArray("exclude-table", nil, `
+Skip the statements of the tables which match the pattern (see --include-table),
+the option can be repeated.
+`)
+	loadCmd.Flags().StringArray("section", nil, `
+Load the section of the dump only: pre-data, data or post-data, the option can be repeated.
+The statements are classified by the type like pg_restore does:
+
+    pre-data   CREATE TABLE, SEQUENCE, TYPE, FUNCTION, VIEW and the other schema statements
+    data       INSERT, COPY, setval
+    post-data  CREATE INDEX, ADD CONSTRAINT, triggers, rules and policies
+
+The session statements (SET, set_config and transactions) are loaded for every section.
+`)
+	loadCmd.Flags().String("mask-rules", "", `
+The rules file (json) for the masking of columns, the values of INSERT and COPY statements
+are masked before the execution. The rules are defined by table.column, the strategies are
+hash, email, name, null, fixed (with the value), digits (the random digits keeping the format)
+and token (the same token for the value in all tables, the foreign keys match). For example:
+
+    {"secret": "key", "columns": {"users.email": {"strategy": "email"},
+     "users.id": {"strategy": "token"}, "orders.user_id": {"strategy": "token"}}}
+
+`)
+	loadCmd.Flags().StringArray("where", nil, `
+Load the rows of INSERT and COPY data which match the condition of the table only,
+the option can be repeated (the conditions of the same table are combined by AND).
+The condition is 'table: expression' or 'schema.table: expression', the expression
+uses the mysql grammar (quote the identifiers by backticks) with the comparisons,
+AND, OR, NOT, IN, BETWEEN, LIKE, IS NULL and the arithmetic. For example:
+
+    --where "users: created_at >= '2024-01-01' AND status IN ('active', 'trial')"
+
+The INSERT statement without the matching rows is skipped.
+`)
+	loadCmd.Flags().StringArray("rename-table", nil, `
+Rename the table 'old=new' in all statements (CREATE, ALTER, DROP, INSERT, COPY etc.),
+the option can be repeated. The names are 'table' or 'schema.table', the indexes,
+constraints and sequences which names start with the old table name and '_' are renamed
+too (users_pkey, users_id_seq). For example:
+
+    --rename-table users=members --rename-table public.orders=archive.orders
+
+`)
+	loadCmd.Flags().StringArray("map-schema", nil, `
+Map the schema 'old=new' in all statements and in the search_path of SET and set_config,
+the option can be repeated. For example:
+
+    --map-schema public=tenant_a
 
+`)
+	loadCmd.Flags().String("source-dialect", "", `
+Sql dialect of the dump if it differs from the dialect of target. The statements are translated
+into the dialect of target, only the mysql dump can be translated (into pg or sqlite3):
+the identifiers are quoted by double quotes, AUTO_INCREMENT becomes the identity column (pg)
+or the integer primary key (sqlite3), tinyint(1) becomes boolean, datetime becomes timestamp,
+the strings use the standard quoting, the table options (ENGINE, CHARSET etc.), SET,
+LOCK TABLES and DISABLE KEYS statements are removed. By default the dialect of target is used.
+`)
+	loadCmd.Flags().String("checkpoint", "", `
+The checkpoint file (e.g. state.json) for the resumable load. The file, the archive entry,
+the byte offset and the index of the last committed statement are saved after every commit,
+the restarted load skips the statements before the checkpoint (the session statements SET
+and set_config are executed again). The resume is refused if the file is changed (the fingerprint of the file differs). The checkpoint file is removed
+when the load is complete. The statements are committed by batches of 1000 statements
+if --batch-size and --batch-bytes aren't defined.
 `)
 	loadCmd.Flags().IntP("debug-level", "d", 0, `
 Debug level:
@@ -87,16 +515,21 @@ Debug level:
 	rootCmd.AddCommand(loadCmd)
 }
 
-func processFile(fileName string, sqlDialect dialect.SqlDialect, connection sql_connection.SqlConnection, debugLevel int) error {
-	respBody, err := os.Open(fileName)
+// processFile loads the statements of all entries of the file, the results are counted in the summary.
+// The processing stops when the limit of errors is reached.
+func (ldr *loader) processFile(fileName string) error {
+	reader, closer, err := openArchiveReader(fileName)
 	if err != nil {
-		return fmt.Errorf("file %s open error (%v)", fileName, err)
+		return err
+	}
+	defer closer.Close()
+	if ldr.checkpoint != nil {
+		if err := ldr.checkpoint.startFile(fileName); err != nil {
+			return err
+		}
 	}
-	defer respBody.Close()
-
-	reader := archive_stream.NewReader(respBody)
 
-	for {
+	for entryIndex := 0; ; {
 		entry, err := reader.GetNextEntry()
 		if err == io.EOF {
 			break
@@ -106,43 +539,345 @@ func processFile(fileName string, sqlDialect dialect.SqlDialect, connection sql_
 		}
 
 		if !entry.IsDir() {
-			rc, err := entry.Open()
-			defer func() {
-				if err := rc.Close(); err != nil {
-					rootCmd.PrintErrf("close entry reader fail: %s", err)
+			entryName := entry.GetName()
+			if entryName == "" {
+				entryName = fileName
+			}
+			offset := int64(0)
+			if ldr.checkpoint != nil {
+				skip, resumeOffset, err := ldr.checkpoint.startEntry(entryIndex, entryName)
+				if err != nil {
+					return err
+				}
+				if skip {
+					entryIndex++
+					continue
 				}
-			}()
+				offset = resumeOffset
+			}
+			entryIndex++
 
-			if err != nil {
-				return fmt.Errorf("unable to open file: %s", err)
+			if err := ldr.processEntry(entry, entryName, offset); err != nil {
+				return err
 			}
+		}
+	}
+	if ldr.checkpoint != nil {
+		return ldr.checkpoint.finishFile()
+	}
+	return nil
+}
 
-			statementsCount := 0
-			lastTime := time.Now()
-			sql_parser.StatementStream(rc, sqlDialect,
-				func(statementText string, statement ast.Statement, parseError error) {
-					if parseError != nil {
-						if debugLevel >= 1 {
-							rootCmd.PrintErrf("parse sql statement:\n %s \n\nfail: %s\n", statementText, parseError)
-						} else {
-							rootCmd.PrintErrf("%s\n", parseError)
-						}
-					}
-					executionError := connection.Execute(statementText)
-					if executionError != nil {
-						if debugLevel >= 1 {
-							rootCmd.PrintErrf("execute sql statement:\n %s \n\nfail: %s\n", statementText, executionError)
-						} else {
-							rootCmd.PrintErrf("%s\n", executionError)
-						}
-					}
-					statementsCount++
-					if debugLevel >= 2 {
-						rootCmd.Printf("[%v] processed statements: %v\n", time.Since(lastTime), statementsCount)
-					}
-					lastTime = time.Now()
-				})
+// processEntry loads the statements of the archive entry from the offset (the statements
+// before the offset are loaded by the previous run)
+func (ldr *loader) processEntry(entry archive_stream.ArchiveEntry, entryName string, offset int64) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("unable to open file: %s", err)
+	}
+	// The entry is closed before the next one is opened, the dump can have thousands of entries
+	defer func() {
+		if err := rc.Close(); err != nil {
+			rootCmd.PrintErrf("close entry reader fail: %s", err)
+		}
+	}()
+
+	if offset > 0 {
+		// The statements before the checkpoint are skipped, the session statements are replayed
+		// and the columns of the created tables are remembered by the row filter, the masker and the translator
+		rootCmd.Printf("resume entry %v from offset %v (statement %v)\n", entryName, offset, ldr.checkpoint.position.Statement)
+		if err := load_checkpoint.SkipStatements(rc, ldr.sqlDialect, offset, func(statementText string, statement ast.Statement, parseError error) {
+			if _, ok := statement.(*ast.CreateTable); ok {
+				ldr.rememberColumns(statementText, statement)
+				return
+			}
+			ldr.execute(statementText, statement)
+		}); err != nil {
+			return fmt.Errorf("skip entry %s to offset %v fail (%v)", entryName, offset, err)
 		}
 	}
+	var offsetHandler sql_parser.OffsetHandler
+	if ldr.checkpoint != nil {
+		offsetHandler = func(endOffset int64) {
+			if !ldr.summary.isMaxErrorsReached() {
+				ldr.checkpoint.statementEnd(endOffset)
+			}
+		}
+	}
+	// The rest of the stream isn't read when the limit of errors is reached
+	source := &abortableReader{reader: rc, summary: ldr.summary}
+	err = sql_parser.StatementStreamWithOffsets(source, ldr.sqlDialect, offset,
+		func(statementText string, statement ast.Statement, parseError error) {
+			if ldr.summary.isMaxErrorsReached() {
+				return
+			}
+			if parseError != nil {
+				ldr.reportParseError(entryName, statementText, parseError)
+			}
+			ldr.execute(statementText, statement)
+		},
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			if ldr.summary.isMaxErrorsReached() {
+				return
+			}
+			if parseError != nil {
+				ldr.reportParseError(entryName, statementText, parseError)
+			}
+			ldr.copyFrom(statementText, statement, data)
+		},
+		offsetHandler)
+	if ldr.checkpoint != nil {
+		if err := ldr.checkpoint.flush(ldr.connection); err != nil {
+			ldr.reportExecutionError("COMMIT", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("process entry %s fail (%v)", entry.GetName(), err)
+	}
 	return nil
 }
+
+// execute executes the statement on the connection or passes it to the parallel jobs,
+// the statements of sections and tables and the rows are filtered, the values are masked,
+// the tables are renamed and the indexes of CREATE TABLE are deferred if it's enabled
+func (ldr *loader) execute(statementText string, statement ast.Statement) {
+	if ldr.sections != nil && !ldr.sections[dump_rewriter.StatementSection(statementText, statement)] {
+		ldr.rememberColumns(statementText, statement)
+		ldr.summary.addSkipped()
+		return
+	}
+	if ldr.filter != nil {
+		var selected bool
+		statementText, statement, selected = ldr.filter.Filter(statementText, statement)
+		if !selected {
+			ldr.summary.addSkipped()
+			return
+		}
+	}
+	if ldr.rowFilter != nil {
+		var selected bool
+		var err error
+		statementText, statement, selected, err = ldr.rowFilter.Filter(statementText, statement)
+		if err != nil {
+			// The statement isn't executed to keep the rows filtered
+			ldr.reportExecutionError(statementText, err)
+			return
+		}
+		if !selected {
+			ldr.summary.addSkipped()
+			return
+		}
+	}
+	if ldr.masker != nil {
+		var err error
+		statementText, statement, err = ldr.masker.Mask(statementText, statement)
+		if err != nil {
+			// The statement isn't executed to keep the data masked
+			ldr.reportExecutionError(statementText, err)
+			return
+		}
+	}
+	if ldr.renamer != nil {
+		statementText, statement = ldr.renamer.Rename(statementText, statement)
+	}
+	if ldr.deferrer != nil && statement != nil {
+		if strippedText, stripped, ok := ldr.deferrer.Defer(statement); ok {
+			statementText, statement = strippedText, stripped
+		} else {
+			ldr.executeDeferred(ldr.deferrer.Release(statement))
+		}
+	}
+	ldr.executeStatement(statementText, statement)
+}
+
+// rememberColumns passes CREATE TABLE statement which isn't executed to the row filter,
+// the masker and the translator, the columns of the table are used by INSERT statements
+func (ldr *loader) rememberColumns(statementText string, statement ast.Statement) {
+	if _, ok := statement.(*ast.CreateTable); !ok {
+		return
+	}
+	if ldr.rowFilter != nil {
+		ldr.rowFilter.RememberColumns(statement)
+	}
+	if ldr.masker != nil {
+		ldr.masker.RememberColumns(statement)
+	}
+	if ldr.translator != nil {
+		// The translator gets the statements of the renamed tables
+		if ldr.renamer != nil {
+			statementText, statement = ldr.renamer.Rename(statementText, statement)
+		}
+		ldr.translator.RememberColumns(statement)
+	}
+}
+
+// executeDeferred executes the deferred statements of indexes and foreign keys
+func (ldr *loader) executeDeferred(statements []dump_rewriter.RewrittenStatement) {
+	for _, deferred := range statements {
+		ldr.executeStatement(deferred.Text, deferred.Statement)
+	}
+}
+
+// executeStatement translates the statement into the dialect of target if the translation is enabled
+func (ldr *loader) executeStatement(statementText string, statement ast.Statement) {
+	if ldr.translator == nil {
+		ldr.executeTranslated(statementText, statement)
+		return
+	}
+	translated, err := ldr.translator.Translate(statementText, statement)
+	if err != nil {
+		ldr.reportExecutionError(statementText, err)
+		return
+	}
+	if len(translated) == 0 {
+		ldr.summary.addSkipped()
+		return
+	}
+	for _, statement := range translated {
+		ldr.executeTranslated(statement.Text, statement.Statement)
+	}
+}
+
+func (ldr *loader) executeTranslated(statementText string, statement ast.Statement) {
+	run := func(connection sql_connection.SqlConnection) {
+		if ldr.summary.isMaxErrorsReached() {
+			return
+		}
+		executionError := sql_connection.ExecuteStatement(connection, statementText, statement)
+		if executionError != nil {
+			ldr.reportExecutionError(statementText, executionError)
+		} else if insert, ok := statement.(*ast.Insert); ok {
+			if values, ok := insert.Rows.(ast.Values); ok {
+				ldr.summary.addRows(uint64(len(values)))
+			}
+		}
+		ldr.countStatement()
+	}
+	if ldr.jobs != nil {
+		ldr.jobs.Execute(statementText, statement, run)
+		return
+	}
+	run(ldr.connection)
+}
+
+// copyFrom executes the COPY ... FROM stdin statement on the connection or passes it to the parallel jobs
+func (ldr *loader) copyFrom(statementText string, statement ast.Statement, data io.Reader) {
+	if ldr.sections != nil || ldr.filter != nil {
+		selected := ldr.sections == nil || ldr.sections[dump_rewriter.DATA_SECTION]
+		if selected && ldr.filter != nil {
+			_, _, selected = ldr.filter.Filter(statementText, statement)
+		}
+		if !selected {
+			// The data is skipped by the statement stream
+			ldr.summary.addSkipped()
+			return
+		}
+	}
+	if ldr.rowFilter != nil {
+		var err error
+		data, err = ldr.rowFilter.FilterCopyData(statementText, statement, data)
+		if err != nil {
+			// The data is skipped by the statement stream to keep the rows filtered
+			ldr.reportExecutionError(statementText, err)
+			return
+		}
+	}
+	if ldr.masker != nil {
+		var err error
+		data, err = ldr.masker.MaskCopyData(statementText, statement, data)
+		if err != nil {
+			// The data is skipped by the statement stream to keep the data masked
+			ldr.reportExecutionError(statementText, err)
+			return
+		}
+	}
+	if ldr.renamer != nil {
+		statementText, statement = ldr.renamer.Rename(statementText, statement)
+	}
+	run := func(connection sql_connection.SqlConnection, data io.Reader) {
+		if ldr.summary.isMaxErrorsReached() {
+			return
+		}
+		rowCounter := sql_parser.NewCopyDataRowCounter(data)
+		executionError := connection.CopyFrom(statementText, rowCounter)
+		if executionError != nil {
+			ldr.reportExecutionError(statementText, executionError)
+		} else {
+			ldr.summary.addRows(rowCounter.Rows())
+		}
+		ldr.countStatement()
+	}
+	if ldr.jobs != nil {
+		if err := ldr.jobs.CopyFrom(statementText, statement, data, run); err != nil {
+			ldr.reportExecutionError(statementText, err)
+		}
+		return
+	}
+	run(ldr.connection, data)
+}
+
+func (ldr *loader) reportParseError(entryName string, statementText string, parseError error) {
+	ldr.summary.addParseError()
+	var statementError sql_parser.StatementError
+	offset := int64(-1)
+	if errors.As(parseError, &statementError) {
+		offset = statementError.Offset
+	}
+	if ldr.debugLevel >= 1 {
+		rootCmd.PrintErrf("parse sql statement (%s, offset %v):\n %s \n\nfail: %s\n", entryName, offset, statementText, parseError)
+	} else {
+		rootCmd.PrintErrf("%s, offset %v: %s\n", entryName, offset, parseError)
+	}
+}
+
+func (ldr *loader) reportExecutionError(statementText string, executionError error) {
+	ldr.summary.addExecutionError()
+	if ldr.debugLevel >= 1 {
+		rootCmd.PrintErrf("execute sql statement:\n %s \n\nfail: %s\n", statementText, executionError)
+	} else {
+		rootCmd.PrintErrf("%s\n", executionError)
+	}
+}
+
+func (ldr *loader) countStatement() {
+	statements, duration := ldr.summary.addStatement()
+	if ldr.debugLevel >= 2 {
+		rootCmd.Printf("[%v] processed statements: %v\n", duration, statements)
+	}
+}
+
+// openArchiveReader opens the dump file or the directory of pg_dump -Fd
+func openArchiveReader(fileName string) (*archive_stream.ArchiveStreamReader, io.Closer, error) {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file %s open error (%v)", fileName, err)
+	}
+
+	if fileInfo.IsDir() {
+		// The directory of pg_dump -Fd
+		reader, err := archive_stream.NewPgDumpDirectoryReader(fileName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("directory %s open error (%v)", fileName, err)
+		}
+		return reader, io.NopCloser(nil), nil
+	}
+
+	respBody, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file %s open error (%v)", fileName, err)
+	}
+	return archive_stream.NewReader(respBody), respBody, nil
+}
+
+// abortableReader fails when the limit of errors is reached
+type abortableReader struct {
+	reader  io.Reader
+	summary *loadSummary
+}
+
+func (reader *abortableReader) Read(p []byte) (int, error) {
+	if reader.summary.isMaxErrorsReached() {
+		return 0, errMaxErrorsReached
+	}
+	return reader.reader.Read(p)
+}
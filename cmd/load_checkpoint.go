@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/usalko/prodl/internal/load_checkpoint"
+	"github.com/usalko/prodl/internal/sql_connection"
+)
+
+// loadCheckpoint saves the position of the last committed statement to the checkpoint file
+// and skips the statements before the position of the previous run on the resume
+type loadCheckpoint struct {
+	fileName  string
+	resume    *load_checkpoint.Checkpoint // The checkpoint of the previous run, nil if the position is reached
+	position  load_checkpoint.Checkpoint  // The position of the last processed statement
+	committed bool                        // The statements are committed after the last save
+}
+
+// newLoadCheckpoint reads the checkpoint of the previous run and returns the index of file
+// to resume from. The resume is refused if the checkpoint is made for the other file.
+func newLoadCheckpoint(fileName string, files []string) (*loadCheckpoint, int, error) {
+	resume, err := load_checkpoint.Load(fileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	checkpoint := &loadCheckpoint{fileName: fileName, resume: resume}
+	if resume == nil {
+		return checkpoint, 0, nil
+	}
+	fileIndex := slices.Index(files, resume.File)
+	if fileIndex < 0 {
+		return nil, 0, fmt.Errorf("checkpoint %v is made for the file %v which isn't loaded, resume is refused", fileName, resume.File)
+	}
+	return checkpoint, fileIndex, nil
+}
+
+// startFile starts the position of the file, the fingerprint of the file is compared with the checkpoint
+func (checkpoint *loadCheckpoint) startFile(fileName string) error {
+	fingerprint, err := load_checkpoint.Fingerprint(fileName)
+	if err != nil {
+		return fmt.Errorf("fingerprint of file %v fail (%v)", fileName, err)
+	}
+	if checkpoint.resume != nil && checkpoint.resume.File == fileName && checkpoint.resume.Fingerprint != fingerprint {
+		return fmt.Errorf("file %v is changed after the checkpoint %v (fingerprint %v but expected %v), resume is refused",
+			fileName, checkpoint.fileName, fingerprint, checkpoint.resume.Fingerprint)
+	}
+	checkpoint.position = load_checkpoint.Checkpoint{File: fileName, Fingerprint: fingerprint}
+	return nil
+}
+
+// startEntry starts the position of the archive entry and returns the offset to resume from,
+// the entries before the checkpoint are skipped
+func (checkpoint *loadCheckpoint) startEntry(entryIndex int, entryName string) (skip bool, offset int64, err error) {
+	checkpoint.position.EntryIndex = entryIndex
+	checkpoint.position.Entry = entryName
+	checkpoint.position.Offset = 0
+	checkpoint.position.Statement = 0
+
+	resume := checkpoint.resume
+	if resume == nil || resume.File != checkpoint.position.File {
+		return false, 0, nil
+	}
+	if entryIndex < resume.EntryIndex {
+		return true, 0, nil
+	}
+	checkpoint.resume = nil
+	if entryIndex > resume.EntryIndex || entryName != resume.Entry {
+		return false, 0, fmt.Errorf("entry %v (index %v) of the checkpoint %v isn't found, resume is refused",
+			resume.Entry, resume.EntryIndex, checkpoint.fileName)
+	}
+	checkpoint.position.Offset = resume.Offset
+	checkpoint.position.Statement = resume.Statement
+	return false, resume.Offset, nil
+}
+
+// finishFile checks the entry of the checkpoint is found in the file
+func (checkpoint *loadCheckpoint) finishFile() error {
+	if resume := checkpoint.resume; resume != nil && resume.File == checkpoint.position.File {
+		checkpoint.resume = nil
+		return fmt.Errorf("entry %v (index %v) of the checkpoint %v isn't found, resume is refused",
+			resume.Entry, resume.EntryIndex, checkpoint.fileName)
+	}
+	return nil
+}
+
+// statementEnd moves the position to the end of processed statement, the position
+// is saved if the statements are committed
+func (checkpoint *loadCheckpoint) statementEnd(endOffset int64) {
+	checkpoint.position.Offset = endOffset
+	checkpoint.position.Statement++
+	if checkpoint.committed {
+		checkpoint.save()
+	}
+}
+
+// commit is the commit handler of the connection
+func (checkpoint *loadCheckpoint) commit() {
+	checkpoint.committed = true
+}
+
+// flush commits the batch of the connection and saves the position
+func (checkpoint *loadCheckpoint) flush(connection sql_connection.SqlConnection) error {
+	if batchConnection, ok := connection.(*sql_connection.BatchConnection); ok {
+		if err := batchConnection.Flush(); err != nil {
+			return err
+		}
+	}
+	if checkpoint.committed {
+		checkpoint.save()
+	}
+	return nil
+}
+
+func (checkpoint *loadCheckpoint) save() {
+	checkpoint.committed = false
+	if err := checkpoint.position.Save(checkpoint.fileName); err != nil {
+		rootCmd.PrintErrf("save checkpoint %v fail with error: %v\n", checkpoint.fileName, err)
+	}
+}
+
+// remove removes the checkpoint file when the load is complete
+func (checkpoint *loadCheckpoint) remove() {
+	if err := os.Remove(checkpoint.fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		rootCmd.PrintErrf("remove checkpoint %v fail with error: %v\n", checkpoint.fileName, err)
+	}
+}
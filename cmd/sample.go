@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/dump_sampler"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// sampleCmd represents the sample command
+var sampleCmd = &cobra.Command{
+	Use:   "sample",
+	Short: "The 'sample' subcommand will write the part of dump which satisfies the foreign keys.",
+	Long: `The 'sample' subcommand selects the part of rows of the root table and writes
+the new sql dump with the selected rows, the rows of the child tables which reference
+them and the rows of the parent tables which are referenced by the kept rows. The foreign
+keys are taken from CREATE TABLE and ALTER TABLE ... ADD CONSTRAINT statements. For example:
+
+'<cmd> sample --ratio 0.01 --root users --output sample.sql.gz dump-file-name.sql.gz'.
+
+'<cmd> sample --dialect mysql --ratio 0.1 --root shop.customers -o sample.sql dump-file-name.sql'.`,
+	Args: cobra.RangeArgs(1, MAX_COUNT_FOR_PROCESSING_FILES),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode := sample(cmd, args)
+		if exitCode != EXIT_CODE_OK {
+			os.Exit(exitCode)
+		}
+	},
+}
+
+func init() {
+	sampleCmd.Flags().StringP("dialect", "s", "pg", `
+Sql dialect of the dump: mysql, sqlite3 or pg
+`)
+	sampleCmd.Flags().Float64P("ratio", "r", 0.01, `
+The part of rows of the root table which are selected (0 < ratio <= 1)
+`)
+	sampleCmd.Flags().String("root", "", `
+The root table of the sample (table or schema.table). The tables which aren't linked
+with the root table by the foreign keys are written as is.
+`)
+	sampleCmd.Flags().Int64("seed", 1, `
+Seed of the random selection of rows, the same seed selects the same rows
+`)
+	sampleCmd.Flags().StringP("output", "o", "sample.sql", `
+The output sql file, the file is compressed by gzip (.gz) or zstd (.zst) by the extension.
+The dump is read twice (three times for pg_dump which adds the foreign keys after the data).
+`)
+	rootCmd.AddCommand(sampleCmd)
+}
+
+func sample(cmd *cobra.Command, args []string) int {
+	dialectName, _ := cmd.Flags().GetString("dialect")
+	ratio, _ := cmd.Flags().GetFloat64("ratio")
+	root, _ := cmd.Flags().GetString("root")
+	seed, _ := cmd.Flags().GetInt64("seed")
+	output, _ := cmd.Flags().GetString("output")
+	sqlDialect, _, err := (*dialect.SqlDialect).ParseUrl(nil, dialectName+"://")
+	if err != nil {
+		rootCmd.PrintErrf("unknown dialect %v\n", dialectName)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	sampler, err := dump_sampler.NewSampler(sqlDialect, ratio, root, seed)
+	if err != nil {
+		rootCmd.PrintErrf("%v\n", err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+
+	for scan := true; scan; scan = sampler.Rescan() {
+		for _, fileName := range args {
+			rootCmd.Printf("scan file %v\n", fileName)
+			if err := readFile(fileName, sampler.Scan); err != nil {
+				rootCmd.PrintErrf("scan file %v fail with error: %v\n", fileName, err)
+				return EXIT_CODE_FATAL_ERROR
+			}
+		}
+	}
+	if err := sampler.Select(); err != nil {
+		rootCmd.PrintErrf("%v\n", err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+
+	connection := &sql_connection.FileConnection{}
+	if err := connection.Establish(output); err != nil {
+		rootCmd.PrintErrf("create output file %v fail with error: %v\n", output, err)
+		return EXIT_CODE_FATAL_ERROR
+	}
+	exitCode := EXIT_CODE_OK
+	for _, fileName := range args {
+		rootCmd.Printf("sample file %v\n", fileName)
+		err := readFile(fileName, func(reader *archive_stream.ArchiveStreamReader) error {
+			return sampler.Write(reader, connection)
+		})
+		if err != nil {
+			rootCmd.PrintErrf("sample file %v fail with error: %v\n", fileName, err)
+			exitCode = EXIT_CODE_FATAL_ERROR
+			break
+		}
+	}
+	if err := connection.Close(); err != nil {
+		rootCmd.PrintErrf("close output file %v fail with error: %v\n", output, err)
+		exitCode = EXIT_CODE_FATAL_ERROR
+	}
+
+	for _, table := range sampler.Tables() {
+		rows, kept := sampler.Rows(table)
+		rootCmd.Printf("table %v: rows %v of %v\n", table, kept, rows)
+	}
+	if sampler.ParseErrors() > 0 {
+		rootCmd.PrintErrf("INSERT and COPY statements which can't be parsed: %v, they are skipped\n", sampler.ParseErrors())
+		if exitCode == EXIT_CODE_OK {
+			exitCode = EXIT_CODE_STATEMENTS_FAILED
+		}
+	}
+	return exitCode
+}
+
+// readFile opens the archive of the file and calls the function for the archive reader
+func readFile(fileName string, read func(reader *archive_stream.ArchiveStreamReader) error) error {
+	reader, closer, err := openArchiveReader(fileName)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	return read(reader)
+}
@@ -1,7 +1,9 @@
 package archive_stream
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"compress/gzip"
 
 	"bytes"
@@ -9,6 +11,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/usalko/hexi"
@@ -17,6 +21,7 @@ import (
 
 var SUPPORTED_FORMATS map[ft.FileType]bool = map[ft.FileType]bool{
 	ft.GZIP: false,
+	ft.TAR:  true,
 	ft.ZIP:  true,
 }
 
@@ -47,10 +52,12 @@ type ArchiveEntry interface {
 }
 
 type ArchiveStreamReader struct {
-	inputReader  io.Reader
-	localFileEnd bool
-	currentEntry ArchiveEntry
-	archiveType  ft.FileType
+	inputReader   io.Reader
+	localFileEnd  bool
+	currentEntry  ArchiveEntry
+	archiveType   ft.FileType
+	tarReader     *tar.Reader
+	pgDumpArchive *PgDumpArchive
 }
 
 func NewReader(reader io.Reader) *ArchiveStreamReader {
@@ -59,6 +66,18 @@ func NewReader(reader io.Reader) *ArchiveStreamReader {
 	}
 }
 
+// NewPgDumpDirectoryReader creates the reader of pg_dump directory format archive (pg_dump -Fd)
+func NewPgDumpDirectoryReader(dirName string) (*ArchiveStreamReader, error) {
+	pgDumpArchive, err := newPgDumpDirectoryArchive(dirName)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveStreamReader{
+		archiveType:   PG_DUMP_FILE_TYPE,
+		pgDumpArchive: pgDumpArchive,
+	}, nil
+}
+
 func (reader *ArchiveStreamReader) readEntry(buf []byte) (ArchiveEntry, error) {
 
 	switch reader.archiveType {
@@ -67,10 +86,15 @@ func (reader *ArchiveStreamReader) readEntry(buf []byte) (ArchiveEntry, error) {
 		if err != nil {
 			return nil, err
 		}
+		// The archive inside the gzip stream (.tar.gz)
+		contentReader := bufio.NewReaderSize(gzipReader, tarBlockSize)
+		if entry, ok, err := reader.readNestedArchive(contentReader); ok {
+			return entry, err
+		}
 		entry := &GzipEntry{
 			Header: gzipReader.Header,
 			ArchiveEntryState: ArchiveEntryState{
-				reader:  gzipReader,
+				reader:  contentReader,
 				readNum: 0,
 				eof:     false,
 			},
@@ -232,11 +256,101 @@ func (reader *ArchiveStreamReader) readEntry(buf []byte) (ArchiveEntry, error) {
 		entry.limitedReader = io.LimitReader(reader.inputReader, int64(entry.CompressedSize64))
 
 		return entry, nil
+	case ft.TAR:
+		reader.tarReader = tar.NewReader(io.MultiReader(bytes.NewReader(buf), reader.inputReader))
+		return reader.readTarEntry()
+	case PG_DUMP_FILE_TYPE:
+		return reader.readPgDumpArchive(io.MultiReader(bytes.NewReader(buf), reader.inputReader))
 	default:
+		if stream := compressedStreamByType(reader.archiveType); stream != nil {
+			decompressedReader, err := stream.decompressor(io.MultiReader(bytes.NewReader(buf), reader.inputReader))
+			if err != nil {
+				return nil, err
+			}
+			// The archive inside the compressed stream (.tar.zst, .tar.xz, ...)
+			contentReader := bufio.NewReaderSize(decompressedReader, tarBlockSize)
+			if entry, ok, err := reader.readNestedArchive(contentReader); ok {
+				return entry, err
+			}
+			// The compressed stream contains the single entry
+			reader.localFileEnd = true
+			entry := &CompressedEntry{
+				FileType: stream.fileType,
+				ArchiveEntryState: ArchiveEntryState{
+					reader:  contentReader,
+					readNum: 0,
+					eof:     false,
+				},
+				closer: decompressedReader,
+			}
+			return entry, nil
+		}
 		return nil, fmt.Errorf("unimplemented file format %s", hexi.FileTypeShortName(reader.archiveType))
 	}
 }
 
+// readNestedArchive reads the first entry of the archive (tar or pg_dump) inside the compressed
+// stream, the ok is false if the stream doesn't contain the archive
+func (reader *ArchiveStreamReader) readNestedArchive(contentReader *bufio.Reader) (entry ArchiveEntry, ok bool, err error) {
+	if block, err := contentReader.Peek(tarBlockSize); err == nil && isTarHeader(block) {
+		reader.archiveType = ft.TAR
+		reader.tarReader = tar.NewReader(contentReader)
+		entry, err := reader.readTarEntry()
+		return entry, true, err
+	}
+	if magic, err := contentReader.Peek(len(pgDumpMagic)); err == nil && string(magic) == pgDumpMagic {
+		reader.archiveType = PG_DUMP_FILE_TYPE
+		entry, err := reader.readPgDumpArchive(contentReader)
+		return entry, true, err
+	}
+	return nil, false, nil
+}
+
+// readPgDumpArchive reads the table of contents of pg_dump archive and returns the first entry
+func (reader *ArchiveStreamReader) readPgDumpArchive(input io.Reader) (ArchiveEntry, error) {
+	pgDumpArchive, err := newPgDumpArchive(input)
+	if err != nil {
+		return nil, err
+	}
+	reader.pgDumpArchive = pgDumpArchive
+	return reader.readPgDumpEntry()
+}
+
+func (reader *ArchiveStreamReader) readPgDumpEntry() (ArchiveEntry, error) {
+	entry, err := reader.pgDumpArchive.nextEntry()
+	if err == io.EOF {
+		reader.localFileEnd = true
+	}
+	return entry, err
+}
+
+// readTarEntry reads the next regular file of tar archive,
+// directories, links and other special entries are skipped
+func (reader *ArchiveStreamReader) readTarEntry() (ArchiveEntry, error) {
+	for {
+		header, err := reader.tarReader.Next()
+		if err == io.EOF {
+			reader.localFileEnd = true
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		entry := &TarEntry{
+			Header: *header,
+			ArchiveEntryState: ArchiveEntryState{
+				reader:  reader.tarReader,
+				readNum: 0,
+				eof:     false,
+			},
+		}
+		return entry, nil
+	}
+}
+
 func (reader *ArchiveStreamReader) GetNextEntry() (ArchiveEntry, error) {
 	if reader.localFileEnd {
 		return nil, io.EOF
@@ -286,6 +400,24 @@ func (reader *ArchiveStreamReader) GetNextEntry() (ArchiveEntry, error) {
 		reader.currentEntry.setEof(true)
 	}
 
+	if reader.pgDumpArchive != nil {
+		entry, err := reader.readPgDumpEntry()
+		if err != nil {
+			return nil, err
+		}
+		reader.currentEntry = entry
+		return entry, nil
+	}
+
+	if reader.tarReader != nil {
+		entry, err := reader.readTarEntry()
+		if err != nil {
+			return nil, err
+		}
+		reader.currentEntry = entry
+		return entry, nil
+	}
+
 	headerIDBuf := make([]byte, zipHeaderIdentifierLen)
 	if _, err := io.ReadFull(reader.inputReader, headerIDBuf); err != nil {
 		if reader.archiveType == ft.GZIP {
@@ -295,16 +427,21 @@ func (reader *ArchiveStreamReader) GetNextEntry() (ArchiveEntry, error) {
 	}
 
 	if reader.archiveType == 0 { // File header
-		fileType, _ := hexi.DetectFileType(headerIDBuf)
-		if fileType == nil || !isSupportedFormat(*fileType) {
-			return nil, fmt.Errorf("unsupported archive format, supported formats are: %s, %s", hexi.FileTypeShortName(ft.GZIP), hexi.FileTypeShortName(ft.ZIP))
+		fileType, header, err := reader.detectArchiveType(headerIDBuf)
+		if err != nil {
+			return nil, err
 		}
-		reader.archiveType = *fileType
+		headerIDBuf = header
+		reader.archiveType = fileType
 	}
 
 	switch reader.archiveType {
 	case ft.GZIP:
 
+	case ft.TAR:
+
+	case PG_DUMP_FILE_TYPE:
+
 	case ft.ZIP:
 		headerID := binary.LittleEndian.Uint32(headerIDBuf)
 		if headerID == zipDirectoryHeaderSignature || headerID == zipDirectoryEndSignature {
@@ -312,6 +449,9 @@ func (reader *ArchiveStreamReader) GetNextEntry() (ArchiveEntry, error) {
 			return nil, io.EOF
 		}
 	default:
+		if compressedStreamByType(reader.archiveType) != nil {
+			break
+		}
 		return nil, fmt.Errorf("unimplemented file format %s", hexi.FileTypeShortName(reader.archiveType))
 	}
 
@@ -323,9 +463,57 @@ func (reader *ArchiveStreamReader) GetNextEntry() (ArchiveEntry, error) {
 	return entry, nil
 }
 
+// detectArchiveType detects the archive type by the magic of the file header,
+// the header is extended by the bytes read for the detection
+func (reader *ArchiveStreamReader) detectArchiveType(header []byte) (ft.FileType, []byte, error) {
+	fileType, _ := hexi.DetectFileType(header)
+	if fileType != nil && isSupportedFormat(*fileType) {
+		return *fileType, header, nil
+	}
+	// The magic of compressed stream (or pg_dump archive) can be longer than the header identifier
+	header = reader.readHeader(header, max(maxCompressedStreamMagicLen(), len(pgDumpMagic)))
+	if stream := lookupCompressedStream(header); stream != nil {
+		return stream.fileType, header, nil
+	}
+	if bytes.HasPrefix(header, []byte(pgDumpMagic)) {
+		return PG_DUMP_FILE_TYPE, header, nil
+	}
+	// The tar magic is placed inside the first header block
+	header = reader.readHeader(header, tarBlockSize)
+	if isTarHeader(header) {
+		return ft.TAR, header, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported archive format, supported formats are: %s", strings.Join(supportedFormatNames(), ", "))
+}
+
+// readHeader reads the header up to the size bytes (if the input is long enough)
+func (reader *ArchiveStreamReader) readHeader(header []byte, size int) []byte {
+	if len(header) >= size {
+		return header
+	}
+	buf := make([]byte, size)
+	copy(buf, header)
+	n, _ := io.ReadFull(reader.inputReader, buf[len(header):])
+	return buf[:len(header)+n]
+}
+
 func isSupportedFormat(fileType ft.FileType) bool {
 	if _, ok := SUPPORTED_FORMATS[fileType]; !ok {
 		return false
 	}
 	return true
 }
+
+func supportedFormatNames() []string {
+	names := make([]string, 0, len(SUPPORTED_FORMATS))
+	for fileType := range SUPPORTED_FORMATS {
+		names = append(names, hexi.FileTypeShortName(fileType))
+	}
+	compressedStreams.Range(func(_, value any) bool {
+		names = append(names, hexi.FileTypeShortName(value.(*compressedStream).fileType))
+		return true
+	})
+	names = append(names, pgDumpMagic)
+	slices.Sort(names)
+	return names
+}
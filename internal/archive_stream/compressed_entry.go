@@ -0,0 +1,211 @@
+package archive_stream
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"github.com/usalko/hexi/ft"
+)
+
+// StreamDecompressor returns the reader of decompressed data of the compressed stream
+type StreamDecompressor func(r io.Reader) (io.ReadCloser, error)
+
+type compressedStream struct {
+	fileType     ft.FileType
+	magic        []byte
+	decompressor StreamDecompressor
+}
+
+var (
+	compressedStreams sync.Map // map[string]*compressedStream, the key is the stream magic
+)
+
+func init() {
+	RegisterStreamDecompressor(ft.ZST, []byte{0x28, 0xb5, 0x2f, 0xfd}, newZstdReader)
+	RegisterStreamDecompressor(ft.XZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, newXzReader)
+	RegisterStreamDecompressor(ft.BZ2, []byte{'B', 'Z', 'h'}, newBzip2Reader)
+	RegisterStreamDecompressor(ft.LZ4, []byte{0x04, 0x22, 0x4d, 0x18}, newLz4Reader)
+
+	RegisterDecompressor(CompressMethodBzip2, zipDecompressor(newBzip2Reader))
+	RegisterDecompressor(CompressMethodZstd, zipDecompressor(newZstdReader))
+	RegisterDecompressor(CompressMethodXz, zipDecompressor(newXzReader))
+}
+
+// RegisterStreamDecompressor registers the decompressor for the compressed stream
+// which starts with the magic bytes
+func RegisterStreamDecompressor(fileType ft.FileType, magic []byte, dcomp StreamDecompressor) {
+	compressedStreams.Store(string(magic), &compressedStream{
+		fileType:     fileType,
+		magic:        bytes.Clone(magic),
+		decompressor: dcomp,
+	})
+}
+
+func lookupCompressedStream(header []byte) *compressedStream {
+	var result *compressedStream
+	compressedStreams.Range(func(_, value any) bool {
+		stream := value.(*compressedStream)
+		if bytes.HasPrefix(header, stream.magic) {
+			result = stream
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+func compressedStreamByType(fileType ft.FileType) *compressedStream {
+	var result *compressedStream
+	compressedStreams.Range(func(_, value any) bool {
+		stream := value.(*compressedStream)
+		if stream.fileType == fileType {
+			result = stream
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+func maxCompressedStreamMagicLen() int {
+	maxLen := 0
+	compressedStreams.Range(func(_, value any) bool {
+		maxLen = max(maxLen, len(value.(*compressedStream).magic))
+		return true
+	})
+	return maxLen
+}
+
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func newXzReader(r io.Reader) (io.ReadCloser, error) {
+	xzReader, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xzReader), nil
+}
+
+func newBzip2Reader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func newLz4Reader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+// zipDecompressor adapts the StreamDecompressor to the zip.Decompressor
+func zipDecompressor(dcomp StreamDecompressor) func(r io.Reader) io.ReadCloser {
+	return func(r io.Reader) io.ReadCloser {
+		rc, err := dcomp(r)
+		if err != nil {
+			return io.NopCloser(errorReader{err})
+		}
+		return rc
+	}
+}
+
+type errorReader struct {
+	err error
+}
+
+func (reader errorReader) Read(p []byte) (int, error) {
+	return 0, reader.err
+}
+
+// CompressedEntry is the single entry of the compressed stream (zstd, xz, bzip2, lz4)
+type CompressedEntry struct {
+	FileType ft.FileType // Type of the compressed stream
+	ArchiveEntryState
+	closer io.Closer
+}
+
+type CompressedEntryCloser struct {
+	io.Reader
+	compressedEntry *CompressedEntry
+}
+
+func (compressedEntryCloser CompressedEntryCloser) Close() error {
+	compressedEntryCloser.compressedEntry.eof = true
+	return compressedEntryCloser.compressedEntry.closer.Close()
+}
+
+// GetName implements ArchiveEntry.
+// The compressed stream doesn't keep the name of the file.
+func (entry *CompressedEntry) GetName() string {
+	return ""
+}
+
+// IsDir implements ArchiveEntry.
+func (entry *CompressedEntry) IsDir() bool {
+	return false
+}
+
+// Open implements ArchiveEntry.
+func (entry *CompressedEntry) Open() (io.ReadCloser, error) {
+	return CompressedEntryCloser{
+		Reader:          entry.reader,
+		compressedEntry: entry,
+	}, nil
+}
+
+// addReadNum implements ArchiveEntry.
+func (entry *CompressedEntry) addReadNum(n uint64) {
+	entry.readNum += n
+}
+
+// getCrc32 implements ArchiveEntry.
+func (entry *CompressedEntry) getCrc32() uint32 {
+	return 0
+}
+
+// getLimitedReader implements ArchiveEntry.
+func (entry *CompressedEntry) getLimitedReader() io.Reader {
+	return io.LimitReader(entry.reader, 0)
+}
+
+// getReadNum implements ArchiveEntry.
+func (entry *CompressedEntry) getReadNum() uint64 {
+	return entry.readNum
+}
+
+// getReader implements ArchiveEntry.
+func (entry *CompressedEntry) getReader() io.Reader {
+	return entry.reader
+}
+
+// getUncompressedSize64 implements ArchiveEntry.
+func (entry *CompressedEntry) getUncompressedSize64() uint64 {
+	return 0
+}
+
+// isEof implements ArchiveEntry.
+func (entry *CompressedEntry) isEof() bool {
+	return entry.eof
+}
+
+// isHasDataDescriptorSignature implements ArchiveEntry.
+func (entry *CompressedEntry) isHasDataDescriptorSignature() bool {
+	return false
+}
+
+// readDataDescriptor implements ArchiveEntry.
+func (entry *CompressedEntry) readDataDescriptor(r io.Reader) error {
+	return nil
+}
+
+// setEof implements ArchiveEntry.
+func (entry *CompressedEntry) setEof(eof bool) {
+	entry.eof = eof
+}
@@ -0,0 +1,607 @@
+package archive_stream
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/usalko/hexi/ft"
+)
+
+// The pg_dump archive isn't known for hexi, the file type is reserved for it
+const PG_DUMP_FILE_TYPE ft.FileType = math.MaxUint16
+
+const (
+	pgDumpMagic = "PGDMP"
+
+	// The table of contents file of directory format archive
+	pgDumpTocFileName = "toc.dat"
+
+	// Archive formats (see pg_backup.h)
+	pgDumpFormatCustom    = 1
+	pgDumpFormatDirectory = 3
+
+	// Compression algorithms (see compression.h)
+	pgDumpCompressionNone = 0
+	pgDumpCompressionGzip = 1
+	pgDumpCompressionLz4  = 2
+	pgDumpCompressionZstd = 3
+
+	// Data offset flags of the custom format
+	pgDumpOffsetNoData = 3
+
+	// Data block types of the custom format
+	pgDumpBlockData  = 1
+	pgDumpBlockBlobs = 3
+
+	// The max supported string length of the archive (protects from broken archives)
+	pgDumpMaxStringLen = 1 << 30
+)
+
+// Archive versions with the format changes (see pg_backup_archiver.h),
+// the archives of pg_dump 8.4 (version 1.10) and newer are supported
+var (
+	pgDumpVersion1_10 = pgDumpVersion(1, 10, 0) // tablespaces, server and pg_dump versions
+	pgDumpVersion1_11 = pgDumpVersion(1, 11, 0) // sections
+	pgDumpVersion1_14 = pgDumpVersion(1, 14, 0) // table access methods
+	pgDumpVersion1_15 = pgDumpVersion(1, 15, 0) // compression algorithm in the header
+	pgDumpVersion1_16 = pgDumpVersion(1, 16, 0) // relation kinds
+)
+
+func pgDumpVersion(major, minor, rev int) int {
+	return (major*256+minor)*256 + rev
+}
+
+// PgDumpHeader is the header of pg_dump archive (custom or directory format)
+type PgDumpHeader struct {
+	Version       int
+	Format        int
+	Compression   int
+	CreateDate    time.Time
+	DatabaseName  string
+	ServerVersion string
+	DumpVersion   string
+
+	intSize int
+	offSize int
+}
+
+// PgDumpTocEntry is the entry of the table of contents of pg_dump archive
+type PgDumpTocEntry struct {
+	DumpId       int
+	HadDumper    bool
+	TableOid     string
+	Oid          string
+	Tag          string
+	Desc         string
+	Section      int
+	Defn         string
+	DropStmt     string
+	CopyStmt     string
+	Namespace    string
+	Tablespace   string
+	TableAm      string
+	Owner        string
+	Dependencies []int
+
+	// Custom format: the data offset flag
+	dataState int
+	// Directory format: the data file name
+	fileName string
+}
+
+// HasData reports whether the data of the entry is stored in the archive
+func (tocEntry *PgDumpTocEntry) HasData() bool {
+	return tocEntry.HadDumper && tocEntry.dataState != pgDumpOffsetNoData
+}
+
+// pgDumpArchiveReader reads the header and the table of contents of pg_dump archive
+type pgDumpArchiveReader struct {
+	reader *bufio.Reader
+	header PgDumpHeader
+}
+
+func (archiveReader *pgDumpArchiveReader) readByte() (int, error) {
+	b, err := archiveReader.reader.ReadByte()
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(b), err
+}
+
+func (archiveReader *pgDumpArchiveReader) readInt() (int, error) {
+	sign, err := archiveReader.readByte()
+	if err != nil {
+		return 0, err
+	}
+	result := 0
+	for i := 0; i < archiveReader.header.intSize; i++ {
+		b, err := archiveReader.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if i < 8 {
+			result |= b << (8 * i)
+		}
+	}
+	if sign != 0 {
+		result = -result
+	}
+	return result, nil
+}
+
+// readString returns the string and the flag the string is defined (not NULL)
+func (archiveReader *pgDumpArchiveReader) readString() (string, bool, error) {
+	length, err := archiveReader.readInt()
+	if err != nil {
+		return "", false, err
+	}
+	if length < 0 {
+		return "", false, nil
+	}
+	if length > pgDumpMaxStringLen {
+		return "", false, fmt.Errorf("pg_dump archive string is too long (%v bytes)", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(archiveReader.reader, buf); err != nil {
+		return "", false, err
+	}
+	return string(buf), true, nil
+}
+
+func (archiveReader *pgDumpArchiveReader) readStrings(values ...*string) error {
+	for _, value := range values {
+		var err error
+		if *value, _, err = archiveReader.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readOffset reads the offset of data block and returns the offset flag
+func (archiveReader *pgDumpArchiveReader) readOffset() (int, error) {
+	flag, err := archiveReader.readByte()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := archiveReader.reader.Discard(archiveReader.header.offSize); err != nil {
+		return 0, err
+	}
+	return flag, nil
+}
+
+// readHeader reads the header of pg_dump archive
+func (archiveReader *pgDumpArchiveReader) readHeader() error {
+	magic := make([]byte, len(pgDumpMagic))
+	if _, err := io.ReadFull(archiveReader.reader, magic); err != nil {
+		return err
+	}
+	if string(magic) != pgDumpMagic {
+		return fmt.Errorf("magic string %s not found in the pg_dump archive header", pgDumpMagic)
+	}
+
+	header := &archiveReader.header
+	versionBytes := make([]byte, 3)
+	if _, err := io.ReadFull(archiveReader.reader, versionBytes[:2]); err != nil {
+		return err
+	}
+	if versionBytes[0] > 1 || versionBytes[1] > 0 {
+		if _, err := io.ReadFull(archiveReader.reader, versionBytes[2:]); err != nil {
+			return err
+		}
+	}
+	header.Version = pgDumpVersion(int(versionBytes[0]), int(versionBytes[1]), int(versionBytes[2]))
+	if header.Version < pgDumpVersion1_10 || header.Version > pgDumpVersion1_16 {
+		return fmt.Errorf("unsupported pg_dump archive version %d.%d.%d", versionBytes[0], versionBytes[1], versionBytes[2])
+	}
+
+	var err error
+	if header.intSize, err = archiveReader.readByte(); err != nil {
+		return err
+	}
+	if header.intSize == 0 || header.intSize > 32 {
+		return fmt.Errorf("unsupported integer size %d of pg_dump archive", header.intSize)
+	}
+	if header.offSize, err = archiveReader.readByte(); err != nil {
+		return err
+	}
+	if header.Format, err = archiveReader.readByte(); err != nil {
+		return err
+	}
+
+	if header.Version >= pgDumpVersion1_15 {
+		if header.Compression, err = archiveReader.readByte(); err != nil {
+			return err
+		}
+	} else {
+		level, err := archiveReader.readInt()
+		if err != nil {
+			return err
+		}
+		header.Compression = pgDumpCompressionNone
+		if level != 0 {
+			header.Compression = pgDumpCompressionGzip
+		}
+	}
+
+	createDate := make([]int, 7) // sec, min, hour, mday, mon, year, isdst
+	for i := range createDate {
+		if createDate[i], err = archiveReader.readInt(); err != nil {
+			return err
+		}
+	}
+	header.CreateDate = time.Date(createDate[5]+1900, time.Month(createDate[4]+1), createDate[3],
+		createDate[2], createDate[1], createDate[0], 0, time.Local)
+
+	return archiveReader.readStrings(&header.DatabaseName, &header.ServerVersion, &header.DumpVersion)
+}
+
+// readToc reads the table of contents of pg_dump archive
+func (archiveReader *pgDumpArchiveReader) readToc() ([]*PgDumpTocEntry, error) {
+	tocCount, err := archiveReader.readInt()
+	if err != nil {
+		return nil, err
+	}
+	if tocCount < 0 {
+		return nil, fmt.Errorf("wrong count of pg_dump archive entries %v", tocCount)
+	}
+
+	toc := make([]*PgDumpTocEntry, 0, min(tocCount, 1024))
+	for i := 0; i < tocCount; i++ {
+		tocEntry, err := archiveReader.readTocEntry()
+		if err != nil {
+			return nil, fmt.Errorf("read entry %v of pg_dump archive fail: %w", i, err)
+		}
+		toc = append(toc, tocEntry)
+	}
+	return toc, nil
+}
+
+func (archiveReader *pgDumpArchiveReader) readTocEntry() (*PgDumpTocEntry, error) {
+	version := archiveReader.header.Version
+	tocEntry := &PgDumpTocEntry{}
+
+	var err error
+	if tocEntry.DumpId, err = archiveReader.readInt(); err != nil {
+		return nil, err
+	}
+	hadDumper, err := archiveReader.readInt()
+	if err != nil {
+		return nil, err
+	}
+	tocEntry.HadDumper = hadDumper != 0
+	if err := archiveReader.readStrings(&tocEntry.TableOid, &tocEntry.Oid, &tocEntry.Tag, &tocEntry.Desc); err != nil {
+		return nil, err
+	}
+	if version >= pgDumpVersion1_11 {
+		if tocEntry.Section, err = archiveReader.readInt(); err != nil {
+			return nil, err
+		}
+	}
+	if err := archiveReader.readStrings(&tocEntry.Defn, &tocEntry.DropStmt, &tocEntry.CopyStmt,
+		&tocEntry.Namespace, &tocEntry.Tablespace); err != nil {
+		return nil, err
+	}
+	if version >= pgDumpVersion1_14 {
+		if err := archiveReader.readStrings(&tocEntry.TableAm); err != nil {
+			return nil, err
+		}
+	}
+	if version >= pgDumpVersion1_16 {
+		if _, err := archiveReader.readInt(); err != nil { // relkind
+			return nil, err
+		}
+	}
+	var withOids string
+	if err := archiveReader.readStrings(&tocEntry.Owner, &withOids); err != nil {
+		return nil, err
+	}
+
+	// Dependencies are terminated by NULL string
+	for {
+		dependency, defined, err := archiveReader.readString()
+		if err != nil {
+			return nil, err
+		}
+		if !defined {
+			break
+		}
+		dumpId, err := strconv.Atoi(dependency)
+		if err != nil {
+			return nil, fmt.Errorf("wrong dependency %q of entry %v", dependency, tocEntry.DumpId)
+		}
+		tocEntry.Dependencies = append(tocEntry.Dependencies, dumpId)
+	}
+
+	switch archiveReader.header.Format {
+	case pgDumpFormatCustom:
+		if tocEntry.dataState, err = archiveReader.readOffset(); err != nil {
+			return nil, err
+		}
+	case pgDumpFormatDirectory:
+		if tocEntry.fileName, _, err = archiveReader.readString(); err != nil {
+			return nil, err
+		}
+		if tocEntry.fileName == "" {
+			tocEntry.dataState = pgDumpOffsetNoData
+		}
+	}
+	return tocEntry, nil
+}
+
+// Restore passes of the entries (see _tocEntryRestorePass of pg_restore)
+const (
+	pgDumpRestorePassMain = iota
+	pgDumpRestorePassAcl
+	pgDumpRestorePassPostAcl
+)
+
+func pgDumpRestorePass(tocEntry *PgDumpTocEntry) int {
+	switch tocEntry.Desc {
+	case "ACL", "ACL LANGUAGE", "DEFAULT ACL":
+		return pgDumpRestorePassAcl
+	case "EVENT TRIGGER", "MATERIALIZED VIEW DATA":
+		return pgDumpRestorePassPostAcl
+	case "COMMENT":
+		if strings.HasPrefix(tocEntry.Tag, "EVENT TRIGGER ") {
+			return pgDumpRestorePassPostAcl
+		}
+	}
+	return pgDumpRestorePassMain
+}
+
+// pgDumpRestoreOrder returns the entries in the order of pg_restore,
+// the database entries are skipped (they are restored with --create option only)
+func pgDumpRestoreOrder(toc []*PgDumpTocEntry) []*PgDumpTocEntry {
+	entries := make([]*PgDumpTocEntry, 0, len(toc))
+	for _, tocEntry := range toc {
+		if tocEntry.Desc == "DATABASE" || tocEntry.Desc == "DATABASE PROPERTIES" {
+			continue
+		}
+		if tocEntry.Defn == "" && !tocEntry.HasData() {
+			continue
+		}
+		entries = append(entries, tocEntry)
+	}
+	slices.SortStableFunc(entries, func(a, b *PgDumpTocEntry) int {
+		return pgDumpRestorePass(a) - pgDumpRestorePass(b)
+	})
+	return entries
+}
+
+// PgDumpArchive reads the entries of pg_dump custom format archive (pg_dump -Fc)
+// or directory format archive (pg_dump -Fd) in the restore order. The data blocks
+// of custom format are read sequentially, so the archive can be read from the stream.
+type PgDumpArchive struct {
+	pgDumpArchiveReader
+	entries      []*PgDumpTocEntry
+	currentEntry *PgDumpEntry
+	directory    string // the directory of directory format archive
+}
+
+func newPgDumpArchive(reader io.Reader) (*PgDumpArchive, error) {
+	archive := &PgDumpArchive{
+		pgDumpArchiveReader: pgDumpArchiveReader{reader: bufio.NewReader(reader)},
+	}
+	if err := archive.readHeader(); err != nil {
+		return nil, fmt.Errorf("read pg_dump archive header fail: %w", err)
+	}
+	if archive.header.Format != pgDumpFormatCustom {
+		return nil, fmt.Errorf("unsupported pg_dump archive format %d", archive.header.Format)
+	}
+	toc, err := archive.readToc()
+	if err != nil {
+		return nil, fmt.Errorf("read pg_dump archive table of contents fail: %w", err)
+	}
+	archive.entries = pgDumpRestoreOrder(toc)
+	return archive, nil
+}
+
+func newPgDumpDirectoryArchive(dirName string) (*PgDumpArchive, error) {
+	tocFile, err := os.Open(filepath.Join(dirName, pgDumpTocFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer tocFile.Close()
+
+	archive := &PgDumpArchive{
+		pgDumpArchiveReader: pgDumpArchiveReader{reader: bufio.NewReader(tocFile)},
+		directory:           dirName,
+	}
+	if err := archive.readHeader(); err != nil {
+		return nil, fmt.Errorf("read pg_dump archive header fail: %w", err)
+	}
+	if archive.header.Format != pgDumpFormatDirectory {
+		return nil, fmt.Errorf("unsupported pg_dump archive format %d", archive.header.Format)
+	}
+	toc, err := archive.readToc()
+	if err != nil {
+		return nil, fmt.Errorf("read pg_dump archive table of contents fail: %w", err)
+	}
+	archive.entries = pgDumpRestoreOrder(toc)
+	archive.reader = nil
+	return archive, nil
+}
+
+// Header returns the header of the archive
+func (archive *PgDumpArchive) Header() PgDumpHeader {
+	return archive.header
+}
+
+func (archive *PgDumpArchive) nextEntry() (ArchiveEntry, error) {
+	// Skip the rest of data of the previous entry
+	if archive.currentEntry != nil && archive.currentEntry.chunks != nil {
+		if _, err := io.Copy(io.Discard, archive.currentEntry.chunks); err != nil {
+			return nil, fmt.Errorf("read previous entry data fail: %w", err)
+		}
+	}
+	archive.currentEntry = nil
+
+	if len(archive.entries) == 0 {
+		return nil, io.EOF
+	}
+	tocEntry := archive.entries[0]
+	archive.entries = archive.entries[1:]
+
+	entry := &PgDumpEntry{
+		PgDumpTocEntry: *tocEntry,
+		Modified:       archive.header.CreateDate,
+		compression:    archive.header.Compression,
+	}
+	if archive.directory != "" {
+		// The large objects aren't supported, skip them
+		if tocEntry.HasData() && tocEntry.Desc != "BLOBS" {
+			entry.dataFile = filepath.Join(archive.directory, tocEntry.fileName)
+		}
+	} else if tocEntry.HasData() {
+		blockType, err := archive.readByte()
+		if err != nil {
+			return nil, fmt.Errorf("read data block of entry %v fail: %w", tocEntry.DumpId, err)
+		}
+		dumpId, err := archive.readInt()
+		if err != nil {
+			return nil, fmt.Errorf("read data block of entry %v fail: %w", tocEntry.DumpId, err)
+		}
+		if dumpId != tocEntry.DumpId {
+			return nil, fmt.Errorf("data block of entry %v found, but entry %v is expected (the data blocks are out of order)", dumpId, tocEntry.DumpId)
+		}
+		switch blockType {
+		case pgDumpBlockData:
+			entry.chunks = &pgDumpChunkReader{archiveReader: &archive.pgDumpArchiveReader}
+		case pgDumpBlockBlobs:
+			// The large objects aren't supported, skip them
+			if err := archive.skipBlobs(); err != nil {
+				return nil, fmt.Errorf("skip large objects of entry %v fail: %w", tocEntry.DumpId, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown data block type %v of entry %v", blockType, tocEntry.DumpId)
+		}
+	}
+	archive.currentEntry = entry
+	return entry, nil
+}
+
+// skipBlobs skips the large objects block, the list of (oid, chunks) terminated by zero oid
+func (archive *PgDumpArchive) skipBlobs() error {
+	for {
+		oid, err := archive.readInt()
+		if err != nil {
+			return err
+		}
+		if oid == 0 {
+			return nil
+		}
+		if _, err := io.Copy(io.Discard, &pgDumpChunkReader{archiveReader: &archive.pgDumpArchiveReader}); err != nil {
+			return err
+		}
+	}
+}
+
+// pgDumpChunkReader reads the data chunks of custom format,
+// every chunk is the length and the bytes, zero length terminates the data
+type pgDumpChunkReader struct {
+	archiveReader *pgDumpArchiveReader
+	remaining     int
+	done          bool
+}
+
+func (chunkReader *pgDumpChunkReader) Read(p []byte) (int, error) {
+	for chunkReader.remaining == 0 {
+		if chunkReader.done {
+			return 0, io.EOF
+		}
+		length, err := chunkReader.archiveReader.readInt()
+		if err != nil {
+			return 0, err
+		}
+		if length < 0 {
+			return 0, fmt.Errorf("wrong length %v of pg_dump data chunk", length)
+		}
+		chunkReader.remaining = length
+		chunkReader.done = length == 0
+	}
+	n, err := chunkReader.archiveReader.reader.Read(p[:min(len(p), chunkReader.remaining)])
+	chunkReader.remaining -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// openPgDumpDataFile opens the data file of directory format archive, the compressed
+// file has the extension of the compression algorithm (see InitDiscoverCompressFileHandle)
+func openPgDumpDataFile(fileName string) (io.ReadCloser, error) {
+	for _, extension := range []string{"", ".gz", ".lz4", ".zst"} {
+		file, err := os.Open(fileName + extension)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var dataReader io.ReadCloser
+		switch extension {
+		case "":
+			return file, nil
+		case ".gz":
+			dataReader, err = gzip.NewReader(file)
+		case ".lz4":
+			dataReader, err = newLz4Reader(file)
+		case ".zst":
+			dataReader, err = newZstdReader(file)
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &pgDumpDataFile{ReadCloser: dataReader, file: file}, nil
+	}
+	return nil, fmt.Errorf("data file %s not found", fileName)
+}
+
+// pgDumpDataFile closes the decompressor and the file
+type pgDumpDataFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (dataFile *pgDumpDataFile) Close() error {
+	return errors.Join(dataFile.ReadCloser.Close(), dataFile.file.Close())
+}
+
+// newPgDumpDataReader returns the reader of decompressed data
+func newPgDumpDataReader(compression int, reader io.Reader) (io.ReadCloser, error) {
+	var (
+		dataReader io.ReadCloser
+		err        error
+	)
+	switch compression {
+	case pgDumpCompressionNone:
+		return io.NopCloser(reader), nil
+	case pgDumpCompressionGzip:
+		dataReader, err = zlib.NewReader(reader)
+	case pgDumpCompressionLz4:
+		dataReader, err = newLz4Reader(reader)
+	case pgDumpCompressionZstd:
+		dataReader, err = newZstdReader(reader)
+	default:
+		return nil, fmt.Errorf("unsupported compression %v of pg_dump archive", compression)
+	}
+	if errors.Is(err, io.EOF) {
+		// No data
+		return io.NopCloser(reader), nil
+	}
+	return dataReader, err
+}
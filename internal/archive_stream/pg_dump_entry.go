@@ -0,0 +1,125 @@
+package archive_stream
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PgDumpEntry is the entry of pg_dump archive, the text of entry is
+// the DDL of the object or the COPY statement with the data of the table
+type PgDumpEntry struct {
+	PgDumpTocEntry
+	ArchiveEntryState
+	Modified    time.Time
+	compression int
+	chunks      io.Reader // data chunks of custom format
+	dataFile    string    // data file of directory format
+}
+
+type PgDumpEntryCloser struct {
+	io.Reader
+	pgDumpEntry *PgDumpEntry
+	dataReader  io.Closer
+}
+
+func (pgDumpEntryCloser PgDumpEntryCloser) Close() error {
+	pgDumpEntryCloser.pgDumpEntry.eof = true
+	if pgDumpEntryCloser.dataReader != nil {
+		return pgDumpEntryCloser.dataReader.Close()
+	}
+	return nil
+}
+
+// GetName implements ArchiveEntry.
+// The name is the same as in the list of pg_restore -l
+func (entry *PgDumpEntry) GetName() string {
+	namespace := entry.Namespace
+	if namespace == "" {
+		namespace = "-"
+	}
+	return fmt.Sprintf("%d; %s %s %s", entry.DumpId, entry.Desc, namespace, entry.Tag)
+}
+
+// IsDir implements ArchiveEntry.
+func (entry *PgDumpEntry) IsDir() bool {
+	return false
+}
+
+// Open implements ArchiveEntry.
+func (entry *PgDumpEntry) Open() (io.ReadCloser, error) {
+	readers := []io.Reader{strings.NewReader(entry.Defn)}
+	var (
+		dataReader io.ReadCloser
+		err        error
+	)
+	switch {
+	case entry.chunks != nil:
+		dataReader, err = newPgDumpDataReader(entry.compression, entry.chunks)
+	case entry.dataFile != "":
+		dataReader, err = openPgDumpDataFile(entry.dataFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open data of entry %v fail: %w", entry.DumpId, err)
+	}
+	if dataReader != nil {
+		readers = append(readers, strings.NewReader(entry.CopyStmt), dataReader)
+	}
+	return PgDumpEntryCloser{
+		Reader:      io.MultiReader(readers...),
+		pgDumpEntry: entry,
+		dataReader:  dataReader,
+	}, nil
+}
+
+// addReadNum implements ArchiveEntry.
+func (entry *PgDumpEntry) addReadNum(n uint64) {
+	entry.readNum += n
+}
+
+// getCrc32 implements ArchiveEntry.
+func (entry *PgDumpEntry) getCrc32() uint32 {
+	return 0
+}
+
+// getLimitedReader implements ArchiveEntry.
+// The rest of entry data is skipped by the PgDumpArchive itself.
+func (entry *PgDumpEntry) getLimitedReader() io.Reader {
+	return io.LimitReader(entry.reader, 0)
+}
+
+// getReadNum implements ArchiveEntry.
+func (entry *PgDumpEntry) getReadNum() uint64 {
+	return entry.readNum
+}
+
+// getReader implements ArchiveEntry.
+func (entry *PgDumpEntry) getReader() io.Reader {
+	return entry.reader
+}
+
+// getUncompressedSize64 implements ArchiveEntry.
+func (entry *PgDumpEntry) getUncompressedSize64() uint64 {
+	return 0
+}
+
+// isEof implements ArchiveEntry.
+func (entry *PgDumpEntry) isEof() bool {
+	return entry.eof
+}
+
+// isHasDataDescriptorSignature implements ArchiveEntry.
+func (entry *PgDumpEntry) isHasDataDescriptorSignature() bool {
+	return false
+}
+
+// readDataDescriptor implements ArchiveEntry.
+func (entry *PgDumpEntry) readDataDescriptor(r io.Reader) error {
+	return nil
+}
+
+// setEof implements ArchiveEntry.
+func (entry *PgDumpEntry) setEof(eof bool) {
+	entry.eof = eof
+}
@@ -1,8 +1,105 @@
 package archive_stream
 
-import "archive/tar"
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+)
+
+const (
+	tarBlockSize    = 512
+	tarMagicOffset  = 257
+	tarMagicPattern = "ustar" // POSIX "ustar\x00" and GNU "ustar  " magics
+)
 
 type TarEntry struct {
 	tar.Header // Entry Header
 	ArchiveEntryState
 }
+
+type TarEntryCloser struct {
+	io.Reader
+	tarEntry *TarEntry
+}
+
+func (tarEntryCloser TarEntryCloser) Close() error {
+	tarEntryCloser.tarEntry.eof = true
+	return nil
+}
+
+// Check the block is the tar header block
+func isTarHeader(block []byte) bool {
+	if len(block) < tarBlockSize {
+		return false
+	}
+	return bytes.HasPrefix(block[tarMagicOffset:], []byte(tarMagicPattern))
+}
+
+// GetName implements ArchiveEntry.
+func (entry *TarEntry) GetName() string {
+	return entry.Header.Name
+}
+
+// IsDir implements ArchiveEntry.
+func (entry *TarEntry) IsDir() bool {
+	return entry.Typeflag == tar.TypeDir
+}
+
+// Open implements ArchiveEntry.
+func (entry *TarEntry) Open() (io.ReadCloser, error) {
+	return TarEntryCloser{
+		Reader:   entry.reader,
+		tarEntry: entry,
+	}, nil
+}
+
+// addReadNum implements ArchiveEntry.
+func (entry *TarEntry) addReadNum(n uint64) {
+	entry.readNum += n
+}
+
+// getCrc32 implements ArchiveEntry.
+func (entry *TarEntry) getCrc32() uint32 {
+	return 0
+}
+
+// getLimitedReader implements ArchiveEntry.
+// The rest of entry data is skipped by the tar.Reader itself.
+func (entry *TarEntry) getLimitedReader() io.Reader {
+	return io.LimitReader(entry.reader, 0)
+}
+
+// getReadNum implements ArchiveEntry.
+func (entry *TarEntry) getReadNum() uint64 {
+	return entry.readNum
+}
+
+// getReader implements ArchiveEntry.
+func (entry *TarEntry) getReader() io.Reader {
+	return entry.reader
+}
+
+// getUncompressedSize64 implements ArchiveEntry.
+func (entry *TarEntry) getUncompressedSize64() uint64 {
+	return uint64(entry.Size)
+}
+
+// isEof implements ArchiveEntry.
+func (entry *TarEntry) isEof() bool {
+	return entry.eof
+}
+
+// isHasDataDescriptorSignature implements ArchiveEntry.
+func (entry *TarEntry) isHasDataDescriptorSignature() bool {
+	return false
+}
+
+// readDataDescriptor implements ArchiveEntry.
+func (entry *TarEntry) readDataDescriptor(r io.Reader) error {
+	return nil
+}
+
+// setEof implements ArchiveEntry.
+func (entry *TarEntry) setEof(eof bool) {
+	entry.eof = eof
+}
@@ -70,7 +70,7 @@ func (entry *ZipEntry) getReader() io.Reader {
 
 // getUncompressedSize64 implements ArchiveEntry.
 func (entry *ZipEntry) getUncompressedSize64() uint64 {
-	return entry.CompressedSize64
+	return entry.UncompressedSize64
 }
 
 // isEof implements ArchiveEntry.
@@ -158,6 +158,9 @@ const (
 const (
 	CompressMethodStored   = 0
 	CompressMethodDeflated = 8
+	CompressMethodBzip2    = 12
+	CompressMethodZstd     = 93
+	CompressMethodXz       = 95
 )
 
 var (
@@ -169,6 +172,11 @@ func init() {
 	decompressors.Store(zip.Deflate, zip.Decompressor(newFlateReader))
 }
 
+// RegisterDecompressor registers the decompressor for the zip compression method
+func RegisterDecompressor(method uint16, dcomp zip.Decompressor) {
+	decompressors.Store(method, dcomp)
+}
+
 func decompressor(method uint16) zip.Decompressor {
 	di, ok := decompressors.Load(method)
 	if !ok {
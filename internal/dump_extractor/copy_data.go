@@ -0,0 +1,21 @@
+package dump_extractor
+
+import (
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// copyValue decodes the raw field of COPY text format, the value is made by the column type.
+// The value is the text if the type is unknown or the field doesn't match the type.
+func copyValue(field string, sqlType sql_types.Type) sql_types.Value {
+	text, valid := sql_parser.DecodeCopyTextField(field)
+	if !valid {
+		return sql_types.NULL
+	}
+	if sqlType != sql_types.Null {
+		if value, err := sql_types.NewValue(sqlType, []byte(text)); err == nil {
+			return value
+		}
+	}
+	return sql_types.NewVarChar(text)
+}
@@ -0,0 +1,292 @@
+package dump_extractor
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// tableColumn is the column of CREATE TABLE statement
+type tableColumn struct {
+	name    string
+	sqlType sql_types.Type // sql_types.Null if the type is unknown
+}
+
+// Extractor writes the rows of INSERT ... VALUES statements and of COPY ... FROM stdin
+// data (the text format) to the file per table. The header of the file is the column
+// list of CREATE TABLE statement, the column list of the first data statement if
+// the table isn't created in the dump or the column names column1, column2 etc.
+type Extractor struct {
+	sqlDialect  dialect.SqlDialect
+	filter      *dump_rewriter.TableFilter // nil if all tables are extracted
+	format      ExtractFormat
+	outputDir   string
+	columns     map[string][]tableColumn // Columns of created tables by the table name
+	writers     map[string]*tableWriter  // Writers by the table name
+	tables      []string                 // Tables in the order of extraction
+	parseErrors int
+}
+
+// NewExtractor makes the extractor of the tables selected by the filter (nil for all tables),
+// the files are written to the output directory
+func NewExtractor(sqlDialect dialect.SqlDialect, filter *dump_rewriter.TableFilter, format ExtractFormat, outputDir string) *Extractor {
+	return &Extractor{
+		sqlDialect: sqlDialect,
+		filter:     filter,
+		format:     format,
+		outputDir:  outputDir,
+		columns:    make(map[string][]tableColumn),
+		writers:    make(map[string]*tableWriter),
+		tables:     make([]string, 0),
+	}
+}
+
+// Extract walks the archive entries and writes the rows of selected tables
+func (extractor *Extractor) Extract(reader *archive_stream.ArchiveStreamReader) error {
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to get next entry (%v)", err)
+		}
+
+		if entry.IsDir() {
+			continue
+		}
+		if err := extractor.extractEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (extractor *Extractor) extractEntry(entry archive_stream.ArchiveEntry) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("unable to open entry %s (%v)", entry.GetName(), err)
+	}
+	defer rc.Close()
+
+	var extractErr error
+	err = sql_parser.StatementStreamWithCopy(rc, extractor.sqlDialect,
+		func(statementText string, statement ast.Statement, parseError error) {
+			if parseError != nil {
+				// The other statements (CREATE FUNCTION etc.) haven't the rows
+				if sql_connection.DetectStatementType(statementText, nil) == ast.StmtInsert {
+					extractor.parseErrors++
+				}
+				return
+			}
+			if err := extractor.extractStatement(statement); err != nil && extractErr == nil {
+				extractErr = err
+			}
+		},
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			copyFrom, ok := statement.(*ast.CopyFrom)
+			if parseError != nil || !ok {
+				extractor.parseErrors++
+				return
+			}
+			if err := extractor.extractCopyData(copyFrom, data); err != nil && extractErr == nil {
+				extractErr = err
+			}
+		})
+	if err == nil {
+		err = extractErr
+	}
+	if err != nil {
+		return fmt.Errorf("process entry %s fail (%v)", entry.GetName(), err)
+	}
+	return nil
+}
+
+func (extractor *Extractor) selected(table ast.TableName) bool {
+	return extractor.filter == nil || extractor.filter.Match(table)
+}
+
+func (extractor *Extractor) extractStatement(statement ast.Statement) error {
+	switch node := statement.(type) {
+	case *ast.CreateTable:
+		if !extractor.selected(node.Table) || node.TableSpec == nil {
+			return nil
+		}
+		columns := make([]tableColumn, 0, len(node.TableSpec.Columns))
+		for _, column := range node.TableSpec.Columns {
+			columns = append(columns, tableColumn{name: column.Name.String(), sqlType: column.Type.SQLType()})
+		}
+		name := tableName(node.Table)
+		extractor.columns[name] = columns
+		// The file of the table without rows has the header only
+		_, err := extractor.writer(name, nil, 0)
+		return err
+	case *ast.Insert:
+		values, ok := node.Rows.(ast.Values)
+		if !ok || !extractor.selected(node.Table) || len(values) == 0 {
+			return nil
+		}
+		columns := columnNames(node.Columns)
+		writer, err := extractor.writer(tableName(node.Table), columns, len(values[0]))
+		if err != nil {
+			return err
+		}
+		for _, tuple := range values {
+			row := make([]sql_types.Value, 0, len(tuple))
+			for _, expr := range tuple {
+				row = append(row, extractor.exprValue(expr))
+			}
+			if err := writer.writeRow(columns, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (extractor *Extractor) extractCopyData(copyFrom *ast.CopyFrom, data io.Reader) error {
+	if !extractor.selected(copyFrom.Table) {
+		return nil
+	}
+	name := tableName(copyFrom.Table)
+	columns := columnNames(copyFrom.Columns)
+	types := make([]sql_types.Type, len(columns))
+	for i, column := range columns {
+		types[i] = extractor.columnType(name, column)
+	}
+	var writer *tableWriter
+	return sql_parser.ReadCopyLines(data, func(line string) error {
+		fields := sql_parser.SplitCopyTextLine(strings.TrimSuffix(line, "\n"))
+		if writer == nil {
+			var err error
+			if writer, err = extractor.writer(name, columns, len(fields)); err != nil {
+				return err
+			}
+		}
+		row := make([]sql_types.Value, 0, len(fields))
+		for i, field := range fields {
+			sqlType := sql_types.Null
+			if i < len(types) {
+				sqlType = types[i]
+			} else if len(columns) == 0 {
+				sqlType = extractor.columnType(name, writer.columnName(i))
+			}
+			row = append(row, copyValue(field, sqlType))
+		}
+		return writer.writeRow(columns, row)
+	})
+}
+
+// writer returns the writer of the table, the writer is created by the first call,
+// the columns and the count of values of the data statement are used for the header
+// if the table isn't created in the dump
+func (extractor *Extractor) writer(name string, columns []string, valuesCount int) (*tableWriter, error) {
+	if writer, ok := extractor.writers[name]; ok {
+		return writer, nil
+	}
+	header := make([]string, 0)
+	if tableColumns, ok := extractor.columns[name]; ok {
+		for _, column := range tableColumns {
+			header = append(header, column.name)
+		}
+	} else if len(columns) > 0 {
+		header = columns
+	} else {
+		for i := 0; i < valuesCount; i++ {
+			header = append(header, defaultColumnName(i))
+		}
+	}
+	fileName := filepath.Join(extractor.outputDir, strings.ReplaceAll(name, string(filepath.Separator), "_")+extractor.format.Extension())
+	writer, err := newTableWriter(fileName, extractor.format, header)
+	if err != nil {
+		return nil, err
+	}
+	extractor.writers[name] = writer
+	extractor.tables = append(extractor.tables, name)
+	return writer, nil
+}
+
+// columnType returns the type of the column of the created table, sql_types.Null if the type is unknown
+func (extractor *Extractor) columnType(name string, column string) sql_types.Type {
+	for _, tableColumn := range extractor.columns[name] {
+		if strings.EqualFold(tableColumn.name, column) {
+			return tableColumn.sqlType
+		}
+	}
+	return sql_types.Null
+}
+
+// exprValue decodes the value of INSERT ... VALUES tuple, the expressions which aren't
+// literals (the function calls etc.) are kept as the sql text
+func (extractor *Extractor) exprValue(expr ast.Expr) sql_types.Value {
+	if value, ok := ast.ExprToValue(expr); ok {
+		return value
+	}
+	return sql_types.MakeTrusted(sql_types.Expression, []byte(ast.DialectString(expr, extractor.sqlDialect)))
+}
+
+// Close closes the written files
+func (extractor *Extractor) Close() error {
+	var err error
+	for _, name := range extractor.tables {
+		if closeErr := extractor.writers[name].close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Tables returns the extracted tables in the order of extraction
+func (extractor *Extractor) Tables() []string {
+	return extractor.tables
+}
+
+// Rows returns the count of rows written for the table
+func (extractor *Extractor) Rows(name string) uint64 {
+	if writer, ok := extractor.writers[name]; ok {
+		return writer.rows
+	}
+	return 0
+}
+
+// FileName returns the name of the file written for the table
+func (extractor *Extractor) FileName(name string) string {
+	if writer, ok := extractor.writers[name]; ok {
+		return writer.fileName
+	}
+	return ""
+}
+
+// ParseErrors returns the count of INSERT and COPY statements which can't be parsed,
+// the rows of these statements aren't extracted
+func (extractor *Extractor) ParseErrors() int {
+	return extractor.parseErrors
+}
+
+func tableName(table ast.TableName) string {
+	if table.Qualifier.IsEmpty() {
+		return table.Name.String()
+	}
+	return table.Qualifier.String() + "." + table.Name.String()
+}
+
+func columnNames(columns ast.Columns) []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.String())
+	}
+	return names
+}
+
+func defaultColumnName(i int) string {
+	return fmt.Sprintf("column%v", i+1)
+}
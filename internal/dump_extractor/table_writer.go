@@ -0,0 +1,153 @@
+package dump_extractor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// Size of the write buffer of the table file
+const TABLE_FILE_BUFFER_SIZE = 256 * 1024
+
+// ExtractFormat is the format of the extracted table file
+type ExtractFormat string
+
+const (
+	// The comma separated values with the header line, NULL is the empty field
+	CSV_FORMAT ExtractFormat = "csv"
+	// The JSON object per line, the keys are the column names
+	JSONL_FORMAT ExtractFormat = "jsonl"
+)
+
+// ParseExtractFormat returns the format by the name: csv or jsonl
+func ParseExtractFormat(name string) (ExtractFormat, error) {
+	switch format := ExtractFormat(strings.ToLower(name)); format {
+	case CSV_FORMAT, JSONL_FORMAT:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %v, the format should be csv or jsonl", name)
+}
+
+// Extension returns the file extension of the format
+func (format ExtractFormat) Extension() string {
+	return "." + string(format)
+}
+
+// tableWriter writes the rows of the table to the file
+type tableWriter struct {
+	fileName  string
+	format    ExtractFormat
+	file      *os.File
+	writer    *bufio.Writer
+	csvWriter *csv.Writer // nil for the jsonl format
+	columns   []string
+	rows      uint64
+}
+
+func newTableWriter(fileName string, format ExtractFormat, columns []string) (*tableWriter, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	writer := &tableWriter{
+		fileName: fileName,
+		format:   format,
+		file:     file,
+		writer:   bufio.NewWriterSize(file, TABLE_FILE_BUFFER_SIZE),
+		columns:  columns,
+	}
+	if format == CSV_FORMAT {
+		writer.csvWriter = csv.NewWriter(writer.writer)
+		if err := writer.csvWriter.Write(columns); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+// columnName returns the name of the column by the position in the header,
+// the values out of the header are named column<n>
+func (writer *tableWriter) columnName(i int) string {
+	if i < len(writer.columns) {
+		return writer.columns[i]
+	}
+	return defaultColumnName(i)
+}
+
+// writeRow writes the values of the columns (the values are in the order of header if the columns
+// are empty), the values of the columns which aren't in the header are skipped
+func (writer *tableWriter) writeRow(columns []string, values []sql_types.Value) error {
+	row := values
+	if len(columns) > 0 && !slicesEqualFold(columns, writer.columns) {
+		row = make([]sql_types.Value, len(writer.columns))
+		for i, column := range columns {
+			for j, headerColumn := range writer.columns {
+				if i < len(values) && strings.EqualFold(column, headerColumn) {
+					row[j] = values[i]
+				}
+			}
+		}
+	}
+	writer.rows++
+	if writer.csvWriter != nil {
+		record := make([]string, 0, len(row))
+		for _, value := range row {
+			record = append(record, value.RawStr())
+		}
+		return writer.csvWriter.Write(record)
+	}
+
+	writer.writer.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			writer.writer.WriteByte(',')
+		}
+		key, _ := json.Marshal(writer.columnName(i))
+		writer.writer.Write(key)
+		writer.writer.WriteByte(':')
+		writer.writer.Write(jsonValue(value))
+	}
+	_, err := writer.writer.WriteString("}\n")
+	return err
+}
+
+func (writer *tableWriter) close() error {
+	if writer.csvWriter != nil {
+		writer.csvWriter.Flush()
+	}
+	err := writer.writer.Flush()
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// jsonValue returns the number as is, NULL as null and the other values as strings
+func jsonValue(value sql_types.Value) []byte {
+	if value.IsNull() {
+		return []byte("null")
+	}
+	if sql_types.IsNumber(value.Type()) && json.Valid(value.Raw()) {
+		return value.Raw()
+	}
+	text, _ := json.Marshal(value.RawStr())
+	return text
+}
+
+func slicesEqualFold(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
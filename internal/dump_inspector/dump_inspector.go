@@ -0,0 +1,171 @@
+package dump_inspector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+const STATEMENT_PREVIEW_SIZE = 80
+
+// ParseError is the statement which can't be parsed
+type ParseError struct {
+	Statement string `json:"statement"` // The beginning of the statement text
+	Offset    int64  `json:"offset"`    // Byte offset of the statement in the entry
+	Error     string `json:"error"`
+}
+
+// EntryReport keeps the statistics of statements of the archive entry
+type EntryReport struct {
+	Name           string            `json:"name"`
+	Size           uint64            `json:"size"` // Uncompressed size of the entry
+	Modified       time.Time         `json:"modified"`
+	StatementTypes map[string]int    `json:"statementTypes"` // Count of statements by the ast.StatementType
+	Tables         []string          `json:"tables"`         // Tables created in the entry
+	Rows           map[string]uint64 `json:"rows"`           // Count of rows by the table for INSERT and COPY statements
+	ParseErrors    []ParseError      `json:"parseErrors"`
+}
+
+// Inspect walks the archive entries and collects statistics of statements
+// without loading. The statements are passed to the no-op connection.
+func Inspect(reader *archive_stream.ArchiveStreamReader, sqlDialect dialect.SqlDialect) ([]*EntryReport, error) {
+	connection := &sql_connection.NopConnection{}
+	reports := make([]*EntryReport, 0)
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return reports, fmt.Errorf("unable to get next entry (%v)", err)
+		}
+
+		if entry.IsDir() {
+			continue
+		}
+		report, err := inspectEntry(entry, sqlDialect, connection)
+		if report != nil {
+			reports = append(reports, report)
+		}
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+func inspectEntry(entry archive_stream.ArchiveEntry, sqlDialect dialect.SqlDialect, connection sql_connection.SqlConnection) (*EntryReport, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open entry %s (%v)", entry.GetName(), err)
+	}
+	defer rc.Close()
+
+	report := &EntryReport{
+		Name:           entry.GetName(),
+		Modified:       entryModified(entry),
+		StatementTypes: make(map[string]int),
+		Tables:         make([]string, 0),
+		Rows:           make(map[string]uint64),
+		ParseErrors:    make([]ParseError, 0),
+	}
+	collectStatement := func(statementText string, statement ast.Statement, parseError error) {
+		if parseError != nil {
+			offset := int64(-1)
+			var statementError sql_parser.StatementError
+			if errors.As(parseError, &statementError) {
+				offset = statementError.Offset
+			}
+			report.ParseErrors = append(report.ParseErrors, ParseError{
+				Statement: statementPreview(statementText),
+				Offset:    offset,
+				Error:     parseError.Error(),
+			})
+			return
+		}
+		report.StatementTypes[ast.ASTToStatementType(statement).String()]++
+		switch node := statement.(type) {
+		case *ast.CreateTable:
+			report.Tables = append(report.Tables, tableName(node.Table))
+		case *ast.Insert:
+			if values, ok := node.Rows.(ast.Values); ok {
+				report.Rows[tableName(node.Table)] += uint64(len(values))
+			}
+		}
+	}
+
+	counter := &countingReader{reader: rc}
+	err = sql_parser.StatementStreamWithCopy(counter, sqlDialect,
+		func(statementText string, statement ast.Statement, parseError error) {
+			collectStatement(statementText, statement, parseError)
+			connection.Execute(statementText)
+		},
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			collectStatement(statementText, statement, parseError)
+			rowCounter := sql_parser.NewCopyDataRowCounter(data)
+			connection.CopyFrom(statementText, rowCounter)
+			if copyFrom, ok := statement.(*ast.CopyFrom); ok {
+				report.Rows[tableName(copyFrom.Table)] += rowCounter.Rows()
+			}
+		})
+	report.Size = counter.readNum
+	if zipEntry, ok := entry.(*archive_stream.ZipEntry); ok && zipEntry.UncompressedSize64 > 0 {
+		report.Size = zipEntry.UncompressedSize64
+	}
+	if err != nil {
+		return report, fmt.Errorf("process entry %s fail (%v)", entry.GetName(), err)
+	}
+	return report, nil
+}
+
+// entryModified returns the modification time of the entry if the archive keeps it
+func entryModified(entry archive_stream.ArchiveEntry) time.Time {
+	switch entry := entry.(type) {
+	case *archive_stream.ZipEntry:
+		if !entry.Modified.IsZero() {
+			return entry.Modified
+		}
+		return entry.ModTime()
+	case *archive_stream.GzipEntry:
+		return entry.ModTime
+	case *archive_stream.TarEntry:
+		return entry.ModTime
+	case *archive_stream.PgDumpEntry:
+		return entry.Modified
+	}
+	return time.Time{}
+}
+
+func tableName(table ast.TableName) string {
+	if table.Qualifier.IsEmpty() {
+		return table.Name.String()
+	}
+	return table.Qualifier.String() + "." + table.Name.String()
+}
+
+func statementPreview(statementText string) string {
+	preview := []rune(strings.Join(strings.Fields(statementText), " "))
+	if len(preview) > STATEMENT_PREVIEW_SIZE {
+		return string(preview[:STATEMENT_PREVIEW_SIZE]) + "..."
+	}
+	return string(preview)
+}
+
+type countingReader struct {
+	reader  io.Reader
+	readNum uint64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.readNum += uint64(n)
+	return n, err
+}
@@ -0,0 +1,395 @@
+package dump_rewriter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// MaskStrategy is the way to mask the value of the column
+type MaskStrategy string
+
+const (
+	// The hex of HMAC-SHA256 of the value (HASH_MASK_SIZE characters)
+	HASH_MASK MaskStrategy = "hash"
+	// The fake email user_<hash>@example.com (EMAIL_MASK_SIZE characters of the hash)
+	EMAIL_MASK MaskStrategy = "email"
+	// The fake first and last name
+	NAME_MASK MaskStrategy = "name"
+	// NULL
+	NULL_MASK MaskStrategy = "null"
+	// The value of the rule
+	FIXED_MASK MaskStrategy = "fixed"
+	// The digits are replaced by the random digits, the other characters are kept (phones, cards)
+	DIGITS_MASK MaskStrategy = "digits"
+	// The integer is replaced by the integer of the same count of digits (the keyed permutation),
+	// the other values are replaced by tok_<hash>. The token of the value is the same for all
+	// tables and columns, the foreign keys match the masked primary keys.
+	TOKEN_MASK MaskStrategy = "token"
+)
+
+const (
+	HASH_MASK_SIZE    = 32
+	EMAIL_MASK_SIZE   = 24 // 12 bytes of the hash, the fake emails of millions of rows don't collide
+	TOKEN_MASK_PREFIX = "tok_"
+	MASK_EMAIL_DOMAIN = "example.com"
+	MASK_SECRET_SIZE  = 32
+	// Rounds of the Feistel network of the integer token
+	TOKEN_FEISTEL_ROUNDS = 4
+	// The integers with more digits are masked by the random digits
+	TOKEN_MAX_DIGITS = 18
+)
+
+var (
+	integerRegexp = regexp.MustCompile(`^-?[0-9]+$`)
+
+	maskFirstNames = []string{"Alex", "Blake", "Casey", "Drew", "Elliot", "Frankie", "Glenn", "Harper",
+		"Jamie", "Jordan", "Kendall", "Logan", "Morgan", "Quinn", "Riley", "Taylor"}
+	maskLastNames = []string{"Adams", "Baker", "Clark", "Davis", "Evans", "Fisher", "Green", "Hill",
+		"Irwin", "Jones", "King", "Lewis", "Moore", "Nash", "Owens", "Parker"}
+)
+
+// MaskRule is the rule of the masked column
+type MaskRule struct {
+	Strategy MaskStrategy `json:"strategy"`
+	Value    *string      `json:"value,omitempty"` // The value of the fixed strategy
+}
+
+// MaskRules is the content of the rules file, for example:
+//
+//	{
+//	  "secret": "the key of hashes and tokens",
+//	  "columns": {
+//	    "users.email": {"strategy": "email"},
+//	    "users.id": {"strategy": "token"},
+//	    "orders.user_id": {"strategy": "token"},
+//	    "public.users.note": {"strategy": "fixed", "value": "redacted"}
+//	  }
+//	}
+type MaskRules struct {
+	Secret  string              `json:"secret,omitempty"`
+	Columns map[string]MaskRule `json:"columns"` // The rules by table.column (or schema.table.column)
+}
+
+// ReadMaskRules reads the rules file (json)
+func ReadMaskRules(fileName string) (*MaskRules, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	rules := &MaskRules{}
+	if err := decoder.Decode(rules); err != nil {
+		return nil, fmt.Errorf("rules file %v is wrong (%v)", fileName, err)
+	}
+	return rules, nil
+}
+
+// DataMasker masks the values of INSERT ... VALUES tuples and COPY ... FROM stdin data (the text format)
+// by the rules of columns. The positions of columns are resolved by the column list of the statement
+// or by the preceding CREATE TABLE statement. The masked values are derived from the value and the secret
+// by HMAC-SHA256, the same value is masked the same way in all tables. The statements which can't be
+// masked (the columns of the table aren't known or the statement isn't parsed) are refused by the error.
+type DataMasker struct {
+	sqlDialect dialect.SqlDialect
+	secret     []byte
+	rules      map[string]map[string]MaskRule // The rules by the table (or schema.table) and the column
+	columns    tableColumns
+}
+
+// NewDataMasker makes the masker of the statements of the dialect, the random secret is made
+// if the rules don't define it (the masked values differ between the loads)
+func NewDataMasker(rules *MaskRules, sqlDialect dialect.SqlDialect) (*DataMasker, error) {
+	masker := &DataMasker{
+		sqlDialect: sqlDialect,
+		secret:     []byte(rules.Secret),
+		rules:      make(map[string]map[string]MaskRule),
+		columns:    make(tableColumns),
+	}
+	if len(masker.secret) == 0 {
+		masker.secret = make([]byte, MASK_SECRET_SIZE)
+		if _, err := rand.Read(masker.secret); err != nil {
+			return nil, err
+		}
+	}
+	for name, rule := range rules.Columns {
+		dot := strings.LastIndexByte(name, '.')
+		if dot <= 0 || dot == len(name)-1 {
+			return nil, fmt.Errorf("rule %v is wrong, the rule should be defined for table.column", name)
+		}
+		switch rule.Strategy {
+		case HASH_MASK, EMAIL_MASK, NAME_MASK, NULL_MASK, DIGITS_MASK, TOKEN_MASK:
+		case FIXED_MASK:
+			if rule.Value == nil {
+				return nil, fmt.Errorf("rule %v is wrong, the value of fixed strategy isn't defined", name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %v is wrong, unknown strategy %v (hash, email, name, null, fixed, digits or token)", name, rule.Strategy)
+		}
+		table, column := strings.ToLower(name[:dot]), strings.ToLower(name[dot+1:])
+		if masker.rules[table] == nil {
+			masker.rules[table] = make(map[string]MaskRule)
+		}
+		masker.rules[table][column] = rule
+	}
+	return masker, nil
+}
+
+// positions returns the rules by the positions of values, the columns are the column list of the statement
+func (masker *DataMasker) positions(table ast.TableName, columns ast.Columns) (map[int]MaskRule, error) {
+	var rules map[string]MaskRule
+	for _, name := range tableNames(table) {
+		if rules == nil {
+			rules = masker.rules[name]
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	tableColumns := masker.columns.resolve(table, columns)
+	if tableColumns == nil {
+		return nil, fmt.Errorf("columns of table %v are unknown (CREATE TABLE statement isn't found), the masking rules can't be applied", ast.DialectString(table, masker.sqlDialect))
+	}
+	positions := make(map[int]MaskRule)
+	for i, column := range tableColumns {
+		if rule, ok := rules[column]; ok {
+			positions[i] = rule
+		}
+	}
+	return positions, nil
+}
+
+// Mask returns the statement with the masked values of INSERT ... VALUES tuples, the columns
+// of CREATE TABLE statements are remembered for the following statements
+func (masker *DataMasker) Mask(statementText string, statement ast.Statement) (string, ast.Statement, error) {
+	switch node := statement.(type) {
+	case nil:
+		if len(masker.rules) > 0 && sql_connection.DetectStatementType(statementText, nil) == ast.StmtInsert {
+			return statementText, statement, fmt.Errorf("INSERT statement isn't parsed, the masking rules can't be applied")
+		}
+	case *ast.CreateTable:
+		masker.RememberColumns(statement)
+	case *ast.Insert:
+		positions, err := masker.positions(node.Table, node.Columns)
+		if err != nil || len(positions) == 0 {
+			return statementText, statement, err
+		}
+		if _, ok := node.Rows.(ast.Values); !ok {
+			return statementText, statement, fmt.Errorf("INSERT ... SELECT into table %v can't be masked", ast.DialectString(node.Table, masker.sqlDialect))
+		}
+		insert := ast.CloneRefOfInsert(node)
+		ast.Rewrite(insert.Rows, func(cursor *ast.Cursor) bool {
+			tuple, ok := cursor.Node().(ast.ValTuple)
+			if !ok {
+				return true
+			}
+			cursor.Replace(masker.maskTuple(tuple, positions))
+			return false
+		}, nil)
+		return ast.DialectString(insert, masker.sqlDialect), insert, nil
+	}
+	return statementText, statement, nil
+}
+
+// RememberColumns remembers the columns of CREATE TABLE statement for the following statements,
+// the columns of the skipped statements (for example, the pre-data section) are remembered as well
+func (masker *DataMasker) RememberColumns(statement ast.Statement) {
+	masker.columns.remember(statement)
+}
+
+func (masker *DataMasker) maskTuple(tuple ast.ValTuple, positions map[int]MaskRule) ast.ValTuple {
+	masked := make(ast.ValTuple, len(tuple))
+	copy(masked, tuple)
+	for i, rule := range positions {
+		if i >= len(masked) {
+			continue
+		}
+		value, ok := ast.ExprToValue(masked[i])
+		if !ok {
+			// The expression (the function call etc.) is masked by the sql text
+			value = sql_types.NewVarChar(ast.DialectString(masked[i], masker.sqlDialect))
+		}
+		masked[i] = valueExpr(masker.maskValue(rule, value))
+	}
+	return masked
+}
+
+// valueExpr makes the literal of the value
+func valueExpr(value sql_types.Value) ast.Expr {
+	switch {
+	case value.IsNull():
+		return &ast.NullVal{}
+	case value.IsIntegral():
+		return ast.NewIntLiteral(value.RawStr())
+	case value.Type() == sql_types.Decimal:
+		return ast.NewDecimalLiteral(value.RawStr())
+	case value.IsFloat():
+		return ast.NewFloatLiteral(value.RawStr())
+	}
+	return ast.NewStrLiteral(value.RawStr())
+}
+
+// MaskCopyData returns the reader of the masked data of COPY ... FROM stdin statement,
+// the data is returned as is if the columns of the table aren't masked
+func (masker *DataMasker) MaskCopyData(statementText string, statement ast.Statement, data io.Reader) (io.Reader, error) {
+	copyFrom, ok := statement.(*ast.CopyFrom)
+	if !ok {
+		if len(masker.rules) > 0 {
+			return data, fmt.Errorf("COPY statement isn't parsed, the masking rules can't be applied")
+		}
+		return data, nil
+	}
+	positions, err := masker.positions(copyFrom.Table, copyFrom.Columns)
+	if err != nil || len(positions) == 0 {
+		return data, err
+	}
+	return sql_parser.NewCopyLineReader(data, func(line string) (string, error) {
+		return masker.maskLine(positions, line), nil
+	}), nil
+}
+
+// maskLine masks the fields of COPY data line
+func (masker *DataMasker) maskLine(positions map[int]MaskRule, line string) string {
+	content, lineEnd := line, ""
+	if strings.HasSuffix(content, "\n") {
+		content, lineEnd = content[:len(content)-1], "\n"
+	}
+	fields := sql_parser.SplitCopyTextLine(content)
+	for i, rule := range positions {
+		if i >= len(fields) {
+			continue
+		}
+		value := sql_types.NULL
+		if text, valid := sql_parser.DecodeCopyTextField(fields[i]); valid {
+			value = sql_types.NewVarChar(text)
+		}
+		masked := masker.maskValue(rule, value)
+		fields[i] = sql_parser.EncodeCopyTextField(masked.RawStr(), !masked.IsNull())
+	}
+	return strings.Join(fields, string(sql_parser.COPY_TEXT_DELIMITER)) + lineEnd
+}
+
+// maskValue masks the value by the rule, NULL isn't masked
+func (masker *DataMasker) maskValue(rule MaskRule, value sql_types.Value) sql_types.Value {
+	if value.IsNull() {
+		return value
+	}
+	text := value.RawStr()
+	switch rule.Strategy {
+	case NULL_MASK:
+		return sql_types.NULL
+	case FIXED_MASK:
+		return sql_types.NewVarChar(*rule.Value)
+	case HASH_MASK:
+		return sql_types.NewVarChar(hex.EncodeToString(masker.hash(string(HASH_MASK), text))[:HASH_MASK_SIZE])
+	case EMAIL_MASK:
+		return sql_types.NewVarChar("user_" + hex.EncodeToString(masker.hash(string(EMAIL_MASK), text))[:EMAIL_MASK_SIZE] + "@" + MASK_EMAIL_DOMAIN)
+	case NAME_MASK:
+		hash := masker.hash(string(NAME_MASK), text)
+		return sql_types.NewVarChar(maskFirstNames[int(hash[0])%len(maskFirstNames)] + " " + maskLastNames[int(hash[1])%len(maskLastNames)])
+	case DIGITS_MASK:
+		return sql_types.MakeTrusted(value.Type(), []byte(masker.randomDigits(text)))
+	case TOKEN_MASK:
+		if integerRegexp.MatchString(text) {
+			return sql_types.MakeTrusted(value.Type(), []byte(masker.integerToken(text)))
+		}
+		return sql_types.NewVarChar(TOKEN_MASK_PREFIX + hex.EncodeToString(masker.hash(string(TOKEN_MASK), text))[:16])
+	}
+	return value
+}
+
+// hash returns HMAC-SHA256 of the labeled text
+func (masker *DataMasker) hash(label string, text string) []byte {
+	mac := hmac.New(sha256.New, masker.secret)
+	mac.Write([]byte(label))
+	mac.Write([]byte{0})
+	mac.Write([]byte(text))
+	return mac.Sum(nil)
+}
+
+// randomDigits replaces the digits of the text by the digits derived from the text,
+// the first digit of the number isn't zero if it isn't zero in the text
+func (masker *DataMasker) randomDigits(text string) string {
+	masked := []byte(text)
+	var stream []byte
+	for i, c := range masked {
+		if c < '0' || c > '9' {
+			continue
+		}
+		if len(stream) == 0 {
+			stream = masker.hash(string(DIGITS_MASK)+strconv.Itoa(i), text)
+		}
+		random := stream[0]
+		stream = stream[1:]
+		if c != '0' && (i == 0 || masked[i-1] < '0' || masked[i-1] > '9') {
+			masked[i] = '1' + random%9
+		} else {
+			masked[i] = '0' + random%10
+		}
+	}
+	return string(masked)
+}
+
+// integerToken replaces the integer by the integer of the same count of digits, the replacement
+// is the keyed permutation, the different integers have the different tokens
+func (masker *DataMasker) integerToken(text string) string {
+	sign, digits := "", text
+	if strings.HasPrefix(text, "-") {
+		sign, digits = "-", text[1:]
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		digits = "0"
+	}
+	if len(digits) > TOKEN_MAX_DIGITS {
+		return sign + masker.randomDigits(digits)
+	}
+	value, _ := strconv.ParseUint(digits, 10, 64)
+	low, high := uint64(0), uint64(10)
+	for i := 1; i < len(digits); i++ {
+		low, high = high, high*10
+	}
+	return sign + strconv.FormatUint(low+masker.permute(value-low, high-low), 10)
+}
+
+// permute is the keyed permutation of [0, size): the Feistel network over the bits of size
+// with the cycle walking (the network is applied again until the result is less than the size)
+func (masker *DataMasker) permute(value uint64, size uint64) uint64 {
+	width := bits.Len64(size - 1)
+	if width%2 == 1 {
+		width++
+	}
+	half := width / 2
+	mask := uint64(1)<<half - 1
+	round := make([]byte, 9)
+	for {
+		left, right := value>>half, value&mask
+		for i := 0; i < TOKEN_FEISTEL_ROUNDS; i++ {
+			round[0] = byte(i)
+			binary.BigEndian.PutUint64(round[1:], right)
+			left, right = right, left^(binary.BigEndian.Uint64(masker.hash(string(TOKEN_MASK), string(round)))&mask)
+		}
+		value = left<<half | right
+		if value < size {
+			return value
+		}
+	}
+}
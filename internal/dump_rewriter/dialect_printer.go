@@ -0,0 +1,177 @@
+package dump_rewriter
+
+import (
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/cache"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// The functions which are called without parentheses in pg and sqlite3
+var niladicTimeFunctions = map[string]bool{
+	"current_timestamp": true,
+	"current_date":      true,
+	"current_time":      true,
+	"localtime":         true,
+	"localtimestamp":    true,
+}
+
+// dialectPrinter formats the mysql statement for the target dialect (pg or sqlite3) on top of
+// the TrackedBuffer of the target dialect: the identifiers with upper case letters are quoted
+// (they are case-sensitive in mysql), the comments are removed and the column types are printed
+// without mysql options. The other nodes are formatted by the ast.
+type dialectPrinter struct {
+	target        dialect.SqlDialect
+	identityStart string // The start of identity column of the formatted CREATE TABLE (AUTO_INCREMENT option)
+}
+
+// String formats the node for the target dialect
+func (printer *dialectPrinter) String(node ast.SQLNode) string {
+	buf := ast.NewTrackedBuffer(printer.format, printer.target)
+	buf.Myprintf("%v", node)
+	return buf.String()
+}
+
+func (printer *dialectPrinter) format(buf *ast.TrackedBuffer, node ast.SQLNode) {
+	switch node := node.(type) {
+	case ast.ColIdent:
+		if node.At != ast.NoAt {
+			node.Format(buf)
+			return
+		}
+		printer.writeIdentifier(buf, node.String())
+	case ast.TableIdent:
+		printer.writeIdentifier(buf, node.String())
+	case *ast.ParsedComments:
+		// The comments (and the mysql conditional comments /*!40101 ... */) are removed
+	case *ast.CurTimeFuncExpr:
+		if node.Fsp == nil && niladicTimeFunctions[node.Name.Lowered()] {
+			buf.WriteString(node.Name.Lowered())
+			return
+		}
+		node.Format(buf)
+	case *ast.ColumnType:
+		printer.formatColumnType(buf, node)
+	case *ast.IndexDefinition:
+		printer.formatIndex(buf, node)
+	case *ast.ForeignKeyDefinition:
+		buf.Myprintf("foreign key %v %v", node.Source, node.ReferenceDefinition)
+	default:
+		node.Format(buf)
+	}
+}
+
+// writeIdentifier quotes the identifier if it isn't the lower case name or it's the keyword
+func (printer *dialectPrinter) writeIdentifier(buf *ast.TrackedBuffer, identifier string) {
+	_, isKeyword := cache.KeywordLookup(identifier, printer.target)
+	if !isKeyword && isSimpleIdentifier(identifier) {
+		buf.WriteString(identifier)
+		return
+	}
+	buf.WriteString(`"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`)
+}
+
+func isSimpleIdentifier(identifier string) bool {
+	for i, c := range identifier {
+		if !(c >= 'a' && c <= 'z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return identifier != ""
+}
+
+// formatColumnType prints the type, nullability, default, generated expression, identity and keys,
+// the other options of mysql (unsigned, charset, collate, on update, comment etc.) are skipped
+func (printer *dialectPrinter) formatColumnType(buf *ast.TrackedBuffer, columnType *ast.ColumnType) {
+	typeName, length, scale := buf.ColumnType(columnType)
+	buf.WriteString(typeName)
+	if length != nil && scale != nil {
+		buf.Myprintf("(%v,%v)", length, scale)
+	} else if length != nil {
+		buf.Myprintf("(%v)", length)
+	}
+
+	options := columnType.Options
+	if options == nil {
+		return
+	}
+	if options.Null != nil {
+		if *options.Null {
+			buf.WriteString(" null")
+		} else {
+			buf.WriteString(" not null")
+		}
+	}
+	if options.Default != nil {
+		buf.Myprintf(" default %v", options.Default)
+	}
+	if options.As != nil {
+		buf.Myprintf(" generated always as (%v) stored", options.As)
+	}
+	if options.Autoincrement && printer.target == dialect.PSQL {
+		buf.WriteString(" generated by default as identity")
+		if printer.identityStart != "" {
+			buf.WriteString(" (start with " + printer.identityStart + ")")
+		}
+	}
+	switch options.KeyOpt {
+	case ast.ColKeyPrimary:
+		buf.WriteString(" primary key")
+	case ast.ColKeyUnique, ast.ColKeyUniqueKey:
+		buf.WriteString(" unique")
+	}
+	if options.Reference != nil {
+		buf.Myprintf(" %v", options.Reference)
+	}
+}
+
+// formatIndex prints the primary key or the unique constraint, the other indexes are created
+// by CREATE INDEX statements (see createIndex)
+func (printer *dialectPrinter) formatIndex(buf *ast.TrackedBuffer, index *ast.IndexDefinition) {
+	if !index.Info.ConstraintName.IsEmpty() {
+		buf.Myprintf("constraint %v ", index.Info.ConstraintName)
+	} else if !index.Info.Primary && !index.Info.Name.IsEmpty() {
+		buf.Myprintf("constraint %v ", index.Info.Name)
+	}
+	if index.Info.Primary {
+		buf.WriteString("primary key ")
+	} else {
+		buf.WriteString("unique ")
+	}
+	printer.formatIndexColumns(buf, index)
+}
+
+func (printer *dialectPrinter) formatIndexColumns(buf *ast.TrackedBuffer, index *ast.IndexDefinition) {
+	buf.WriteString("(")
+	for i, column := range index.Columns {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		if column.Expression != nil {
+			buf.Myprintf("(%v)", column.Expression)
+		} else {
+			buf.Myprintf("%v", column.Column)
+		}
+		if column.Direction == ast.DescOrder {
+			buf.WriteString(" desc")
+		}
+	}
+	buf.WriteString(")")
+}
+
+// createIndex formats the CREATE INDEX statement of the index
+func (printer *dialectPrinter) createIndex(table ast.TableName, index *ast.IndexDefinition) string {
+	buf := ast.NewTrackedBuffer(printer.format, printer.target)
+	buf.WriteString("create ")
+	if index.Info.Unique {
+		buf.WriteString("unique ")
+	}
+	buf.WriteString("index ")
+	if !index.Info.Name.IsEmpty() {
+		buf.Myprintf("%v ", index.Info.Name)
+	}
+	buf.Myprintf("on %v ", table)
+	printer.formatIndexColumns(buf, index)
+	return buf.String()
+}
@@ -0,0 +1,439 @@
+package dump_rewriter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+var (
+	// The statement which consists of the mysql conditional comments only (/*!40101 ... */)
+	conditionalCommentRegexp = regexp.MustCompile(`^(\s*/\*!\d*.*?\*/\s*;?)+\s*$`)
+)
+
+// DialectTranslator translates the statements of the mysql dump into the statements
+// of pg or sqlite3. The statement is rewritten by ast.Rewrite (column types, literals etc.)
+// and formatted by the printer of the target dialect. The session statements (SET),
+// LOCK TABLES and DISABLE KEYS are removed, the secondary indexes of CREATE TABLE
+// are created by the separate CREATE INDEX statements.
+type DialectTranslator struct {
+	source         dialect.SqlDialect
+	target         dialect.SqlDialect
+	printer        *dialectPrinter
+	booleanColumns map[string]map[string]bool // The boolean columns (tinyint(1) of mysql) of the translated tables
+	columns        map[string][]string        // The columns of the translated tables in order of definition
+	conflictKeys   map[string][]ast.ColIdent  // The primary (or the first unique) key columns of the translated tables
+}
+
+// NewDialectTranslator makes the translator, only the translation of mysql into pg or sqlite3 is supported
+func NewDialectTranslator(source dialect.SqlDialect, target dialect.SqlDialect) (*DialectTranslator, error) {
+	if source != dialect.MYSQL || (target != dialect.PSQL && target != dialect.SQLITE3) {
+		return nil, fmt.Errorf("translation of %v into %v isn't supported, the source dialect should be mysql and the target dialect should be pg or sqlite3", source.String(), target.String())
+	}
+	return &DialectTranslator{
+		source:         source,
+		target:         target,
+		printer:        &dialectPrinter{target: target},
+		booleanColumns: make(map[string]map[string]bool),
+		columns:        make(map[string][]string),
+		conflictKeys:   make(map[string][]ast.ColIdent),
+	}, nil
+}
+
+// Translate returns the statements of the target dialect, the result is empty if the statement
+// is removed. The statements which aren't parsed (statement is nil) are returned as is.
+// The error is returned if the statement can't be translated (INSERT ... ON DUPLICATE KEY UPDATE
+// into the table which keys are unknown).
+func (translator *DialectTranslator) Translate(statementText string, statement ast.Statement) ([]RewrittenStatement, error) {
+	switch node := statement.(type) {
+	case nil:
+		if conditionalCommentRegexp.MatchString(statementText) {
+			return []RewrittenStatement{}, nil
+		}
+		return []RewrittenStatement{{Text: statementText}}, nil
+	case *ast.Set, *ast.LockTables, *ast.UnlockTables:
+		return []RewrittenStatement{}, nil
+	case *ast.AlterTable:
+		if isKeyStateOnly(node) {
+			return []RewrittenStatement{}, nil
+		}
+	}
+
+	translated := translator.rewrite(ast.CloneStatement(statement))
+	switch node := translated.(type) {
+	case *ast.CreateTable:
+		return translator.createTable(node), nil
+	case *ast.AlterTable:
+		return translator.alterTable(node), nil
+	case *ast.Insert:
+		insert, err := translator.insert(node)
+		if err != nil {
+			return nil, err
+		}
+		return []RewrittenStatement{insert}, nil
+	}
+	return []RewrittenStatement{{Text: translator.printer.String(translated), Statement: translated}}, nil
+}
+
+// rewrite translates the expressions of the statement: the character set introducers
+// are removed and the hexadecimal literals are converted to bytea (pg) or blob (sqlite3) literals
+func (translator *DialectTranslator) rewrite(statement ast.Statement) ast.Statement {
+	return ast.Rewrite(statement, nil, func(cursor *ast.Cursor) bool {
+		switch node := cursor.Node().(type) {
+		case *ast.IntroducerExpr:
+			cursor.Replace(node.Expr)
+		case *ast.Literal:
+			if node.Type != ast.HexNum && node.Type != ast.HexVal {
+				break
+			}
+			hex := strings.ToLower(node.Val)
+			if node.Type == ast.HexNum {
+				hex = strings.TrimPrefix(hex, "0x")
+			}
+			if translator.target == dialect.PSQL {
+				cursor.Replace(&ast.Literal{Type: ast.StrVal, Val: `\x` + hex})
+			} else {
+				cursor.Replace(&ast.Literal{Type: ast.HexVal, Val: hex})
+			}
+		}
+		return true
+	}).(ast.Statement)
+}
+
+// createTable translates the columns and returns CREATE TABLE with the primary and unique keys
+// followed by CREATE INDEX statements of the other indexes, the fulltext and spatial indexes are removed
+func (translator *DialectTranslator) createTable(createTable *ast.CreateTable) []RewrittenStatement {
+	if createTable.TableSpec == nil {
+		return []RewrittenStatement{{Text: translator.printer.String(createTable), Statement: createTable}}
+	}
+	tableSpec := createTable.TableSpec
+	tableName := createTable.Table.Name.String()
+
+	identityStart := ""
+	for _, option := range tableSpec.Options {
+		if strings.EqualFold(option.Name, "AUTO_INCREMENT") && option.Value != nil {
+			identityStart = option.Value.Val
+		}
+	}
+	tableSpec.Options = nil
+	tableSpec.PartitionOption = nil
+
+	translator.RememberColumns(createTable)
+	for _, column := range tableSpec.Columns {
+		translator.columnType(&column.Type)
+		if column.Type.Type == "boolean" && column.Type.Options != nil && column.Type.Options.Default != nil {
+			column.Type.Options.Default = booleanValue(column.Type.Options.Default)
+		}
+	}
+
+	keptIndexes := make([]*ast.IndexDefinition, 0, len(tableSpec.Indexes))
+	indexes := make([]RewrittenStatement, 0)
+	for _, index := range tableSpec.Indexes {
+		if index.Info.Fulltext || index.Info.Spatial {
+			continue
+		}
+		// The names of indexes are unique in the schema of pg and sqlite3
+		if !index.Info.Name.IsEmpty() && !index.Info.Primary {
+			index.Info.Name = ast.NewColIdent(tableName + "_" + index.Info.Name.String())
+		}
+		if index.Info.Primary || index.Info.Unique {
+			keptIndexes = append(keptIndexes, index)
+			continue
+		}
+		indexes = append(indexes, RewrittenStatement{Text: translator.printer.createIndex(createTable.Table, index)})
+	}
+	tableSpec.Indexes = keptIndexes
+	if translator.target == dialect.SQLITE3 {
+		translator.inlinePrimaryKey(tableSpec)
+	}
+	for _, constraint := range tableSpec.Constraints {
+		if foreignKey, ok := constraint.Details.(*ast.ForeignKeyDefinition); ok {
+			foreignKey.IndexName = ast.NewColIdent("")
+		}
+	}
+
+	translator.printer.identityStart = identityStart
+	text := translator.printer.String(createTable)
+	translator.printer.identityStart = ""
+	return append([]RewrittenStatement{{Text: text, Statement: createTable}}, indexes...)
+}
+
+// RememberColumns remembers the columns and the boolean columns of CREATE TABLE statement
+// which isn't translated (e.g. it's skipped by the section), the values of INSERT statements
+// of the table are converted by them
+func (translator *DialectTranslator) RememberColumns(statement ast.Statement) {
+	createTable, ok := statement.(*ast.CreateTable)
+	if !ok || createTable.TableSpec == nil {
+		return
+	}
+	table := tableKey(createTable.Table)
+	translator.booleanColumns[table] = make(map[string]bool)
+	translator.columns[table] = make([]string, 0, len(createTable.TableSpec.Columns))
+	for _, column := range createTable.TableSpec.Columns {
+		columnName := strings.ToLower(column.Name.String())
+		translator.columns[table] = append(translator.columns[table], columnName)
+		if isBooleanType(&column.Type) {
+			translator.booleanColumns[table][columnName] = true
+		}
+	}
+	translator.conflictKeys[table] = conflictKey(createTable.TableSpec)
+}
+
+// conflictKey returns the columns of the primary key or of the first unique key of the table,
+// the key is the conflict target of the translated INSERT ... ON DUPLICATE KEY UPDATE
+func conflictKey(tableSpec *ast.TableSpec) []ast.ColIdent {
+	var uniqueKey []ast.ColIdent
+	for _, column := range tableSpec.Columns {
+		if column.Type.Options == nil {
+			continue
+		}
+		switch column.Type.Options.KeyOpt {
+		case ast.ColKeyPrimary:
+			return []ast.ColIdent{column.Name}
+		case ast.ColKeyUnique, ast.ColKeyUniqueKey:
+			if uniqueKey == nil {
+				uniqueKey = []ast.ColIdent{column.Name}
+			}
+		}
+	}
+	for _, index := range tableSpec.Indexes {
+		if !index.Info.Primary && (!index.Info.Unique || uniqueKey != nil) {
+			continue
+		}
+		columns := make([]ast.ColIdent, 0, len(index.Columns))
+		for _, column := range index.Columns {
+			if column.Expression != nil {
+				// The key of expressions isn't the conflict target
+				columns = nil
+				break
+			}
+			columns = append(columns, column.Column)
+		}
+		if index.Info.Primary && columns != nil {
+			return columns
+		}
+		if uniqueKey == nil {
+			uniqueKey = columns
+		}
+	}
+	return uniqueKey
+}
+
+// isBooleanType checks the mysql column type is boolean (tinyint(1), bit(1) or bool)
+func isBooleanType(columnType *ast.ColumnType) bool {
+	typeName := strings.ToLower(columnType.Type)
+	return typeName == "tinyint" && columnType.Length != nil && columnType.Length.Val == "1" ||
+		typeName == "bit" && (columnType.Length == nil || columnType.Length.Val == "1") ||
+		typeName == "bool" || typeName == "boolean"
+}
+
+// columnType maps the mysql column type to the type of the target dialect
+func (translator *DialectTranslator) columnType(columnType *ast.ColumnType) {
+	typeName := strings.ToLower(columnType.Type)
+	autoincrement := columnType.Options != nil && columnType.Options.Autoincrement
+
+	switch {
+	case isBooleanType(columnType):
+		typeName = "boolean"
+		columnType.Length = nil
+	case typeName == "datetime":
+		typeName = "timestamp"
+	case typeName == "enum" || typeName == "set":
+		typeName = "text"
+	case translator.target == dialect.SQLITE3:
+		if autoincrement {
+			// The integer primary key is the alias of rowid which is generated by sqlite3
+			typeName = "integer"
+			columnType.Length = nil
+		}
+	default:
+		typeName = pgType(typeName, columnType, autoincrement)
+	}
+	columnType.Type = typeName
+	columnType.EnumValues = nil
+	columnType.Unsigned = false
+	columnType.Zerofill = false
+}
+
+// pgType maps the mysql type which has the other meaning in pg, the types which pg doesn't know
+// (tinyint, datetime, longtext, blob etc.) are renamed by the printer (see ast.TrackedBuffer.ColumnType)
+func pgType(typeName string, columnType *ast.ColumnType, autoincrement bool) string {
+	switch typeName {
+	case "float":
+		columnType.Length, columnType.Scale = nil, nil
+		return "real"
+	case "real":
+		return "double"
+	}
+	if !columnType.Unsigned {
+		return typeName
+	}
+	// pg doesn't have the unsigned types
+	switch typeName {
+	case "smallint":
+		return "integer"
+	case "int", "integer":
+		return "bigint"
+	case "bigint":
+		if autoincrement {
+			// The identity column of pg is an integer, the generated values don't reach the sign bit
+			columnType.Length = nil
+			return "bigint"
+		}
+		columnType.Length = ast.NewIntLiteral("20")
+		return "numeric"
+	}
+	return typeName
+}
+
+// inlinePrimaryKey moves the primary key of the integer column into the column definition,
+// the integer primary key of sqlite3 is generated as auto increment column of mysql
+func (translator *DialectTranslator) inlinePrimaryKey(tableSpec *ast.TableSpec) {
+	for i, index := range tableSpec.Indexes {
+		if !index.Info.Primary || len(index.Columns) != 1 {
+			continue
+		}
+		for _, column := range tableSpec.Columns {
+			if !column.Name.Equal(index.Columns[0].Column) || column.Type.Type != "integer" {
+				continue
+			}
+			if column.Type.Options == nil {
+				column.Type.Options = &ast.ColumnTypeOptions{}
+			}
+			column.Type.Options.KeyOpt = ast.ColKeyPrimary
+			tableSpec.Indexes = append(tableSpec.Indexes[:i], tableSpec.Indexes[i+1:]...)
+			return
+		}
+	}
+}
+
+// alterTable translates ADD INDEX into CREATE INDEX, the other options are printed as is
+func (translator *DialectTranslator) alterTable(alterTable *ast.AlterTable) []RewrittenStatement {
+	result := make([]RewrittenStatement, 0)
+	options := make([]ast.AlterOption, 0, len(alterTable.AlterOptions))
+	for _, option := range alterTable.AlterOptions {
+		switch option := option.(type) {
+		case *ast.AddIndexDefinition:
+			index := option.IndexDefinition
+			if index.Info.Fulltext || index.Info.Spatial {
+				continue
+			}
+			if !index.Info.Primary {
+				if !index.Info.Name.IsEmpty() {
+					index.Info.Name = ast.NewColIdent(alterTable.Table.Name.String() + "_" + index.Info.Name.String())
+				}
+				result = append(result, RewrittenStatement{Text: translator.printer.createIndex(alterTable.Table, index)})
+				continue
+			}
+		case *ast.KeyState:
+			continue
+		case *ast.AddConstraintDefinition:
+			if foreignKey, ok := option.ConstraintDefinition.Details.(*ast.ForeignKeyDefinition); ok {
+				foreignKey.IndexName = ast.NewColIdent("")
+			}
+		}
+		options = append(options, option)
+	}
+	if len(options) > 0 {
+		alterTable.AlterOptions = options
+		result = append([]RewrittenStatement{{Text: translator.printer.String(alterTable), Statement: alterTable}}, result...)
+	}
+	return result
+}
+
+// insert converts the values of boolean columns and translates INSERT IGNORE and
+// INSERT ... ON DUPLICATE KEY UPDATE into INSERT ... ON CONFLICT
+func (translator *DialectTranslator) insert(insert *ast.Insert) (RewrittenStatement, error) {
+	table := tableKey(insert.Table)
+	if rows, ok := insert.Rows.(ast.Values); ok && translator.target == dialect.PSQL && len(translator.booleanColumns[table]) > 0 {
+		columns := translator.columns[table]
+		if len(insert.Columns) > 0 {
+			columns = make([]string, 0, len(insert.Columns))
+			for _, column := range insert.Columns {
+				columns = append(columns, column.Lowered())
+			}
+		}
+		for _, row := range rows {
+			for i, value := range row {
+				if i < len(columns) && translator.booleanColumns[table][columns[i]] {
+					row[i] = booleanValue(value)
+				}
+			}
+		}
+	}
+
+	if len(insert.OnDup) > 0 {
+		return translator.upsert(insert, table)
+	}
+	ignore := bool(insert.Ignore)
+	insert.Ignore = false
+	text := translator.printer.String(insert)
+	if ignore && translator.target == dialect.PSQL {
+		text += " on conflict do nothing"
+	} else if ignore {
+		text = "insert or ignore " + strings.TrimPrefix(text, "insert ")
+	}
+	return RewrittenStatement{Text: text, Statement: insert}, nil
+}
+
+// upsert translates INSERT ... ON DUPLICATE KEY UPDATE into INSERT ... ON CONFLICT (key) DO UPDATE,
+// the key is the primary or unique key of CREATE TABLE and VALUES(column) becomes excluded.column
+func (translator *DialectTranslator) upsert(insert *ast.Insert, table string) (RewrittenStatement, error) {
+	key := translator.conflictKeys[table]
+	if len(key) == 0 {
+		return RewrittenStatement{}, fmt.Errorf("INSERT ... ON DUPLICATE KEY UPDATE isn't translated, the primary or unique key of table %v is unknown", ast.String(insert.Table))
+	}
+	updates := ast.Rewrite(ast.UpdateExprs(insert.OnDup), nil, func(cursor *ast.Cursor) bool {
+		if values, ok := cursor.Node().(*ast.ValuesFuncExpr); ok {
+			cursor.Replace(&ast.ColName{Name: values.Name.Name, Qualifier: ast.TableName{Name: ast.NewTableIdent("excluded")}})
+		}
+		return true
+	}).(ast.UpdateExprs)
+	insert.OnDup = nil
+	insert.Ignore = false
+
+	buf := ast.NewTrackedBuffer(translator.printer.format, translator.target)
+	buf.Myprintf("%v on conflict (", insert)
+	for i, column := range key {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.Myprintf("%v", column)
+	}
+	buf.Myprintf(") do update set %v", updates)
+	return RewrittenStatement{Text: buf.String(), Statement: insert}, nil
+}
+
+// booleanValue converts the integer (0, 1), string ('0', '1') or bit (b'1') literal into the boolean
+func booleanValue(value ast.Expr) ast.Expr {
+	literal, ok := value.(*ast.Literal)
+	if !ok || literal.Val == "" {
+		return value
+	}
+	switch literal.Type {
+	case ast.IntVal, ast.StrVal, ast.BitVal:
+		switch strings.TrimLeft(literal.Val, "0") {
+		case "":
+			return ast.BoolVal(false)
+		case "1":
+			return ast.BoolVal(true)
+		}
+	}
+	return value
+}
+
+// isKeyStateOnly checks the statement is ALTER TABLE ... DISABLE KEYS (or ENABLE KEYS) of mysqldump
+func isKeyStateOnly(alterTable *ast.AlterTable) bool {
+	if len(alterTable.AlterOptions) == 0 {
+		return false
+	}
+	for _, option := range alterTable.AlterOptions {
+		if _, ok := option.(*ast.KeyState); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+package dump_rewriter
+
+import "github.com/usalko/prodl/internal/sql_parser/ast"
+
+// RewrittenStatement is the statement made by the rewriter, the text is formatted from the statement
+type RewrittenStatement struct {
+	Text      string
+	Statement ast.Statement
+}
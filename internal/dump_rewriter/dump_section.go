@@ -0,0 +1,102 @@
+package dump_rewriter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+)
+
+// DumpSection is the section of dump like the sections of pg_restore
+type DumpSection string
+
+const (
+	// Schema statements: CREATE TABLE, SEQUENCE, TYPE, FUNCTION, VIEW etc.
+	PRE_DATA_SECTION DumpSection = "pre-data"
+	// Data statements: INSERT, COPY, setval
+	DATA_SECTION DumpSection = "data"
+	// Statements which follow the data: CREATE INDEX, ADD CONSTRAINT, triggers and rules
+	POST_DATA_SECTION DumpSection = "post-data"
+	// Session statements (SET, set_config and transactions) belong to every section
+	SESSION_SECTION DumpSection = "session"
+)
+
+var (
+	// Post-data statements which the parser doesn't recognize
+	postDataRegexp = regexp.MustCompile(`(?is)^(create\s+(unique\s+)?index|create\s+(constraint\s+|event\s+)?trigger|create\s+(or\s+replace\s+)?rule|create\s+policy|alter\s+table\s.*\sadd\s+constraint)\b`)
+)
+
+// ParseDumpSection returns the section by the name: pre-data, data or post-data
+func ParseDumpSection(name string) (DumpSection, error) {
+	switch section := DumpSection(name); section {
+	case PRE_DATA_SECTION, DATA_SECTION, POST_DATA_SECTION:
+		return section, nil
+	}
+	return "", fmt.Errorf("unknown section %v, the section should be pre-data, data or post-data", name)
+}
+
+// StatementSection classifies the statement by the type, the statement is nil if it wasn't parsed
+func StatementSection(statementText string, statement ast.Statement) DumpSection {
+	if IsSessionStatement(statementText, statement) {
+		return SESSION_SECTION
+	}
+	switch sql_connection.DetectStatementType(statementText, statement) {
+	case ast.StmtBegin, ast.StmtCommit, ast.StmtRollback:
+		return SESSION_SECTION
+	}
+
+	switch node := statement.(type) {
+	case nil:
+		sql, _ := ast.SplitMarginComments(ast.StripLeadingComments(statementText))
+		if postDataRegexp.MatchString(sql) {
+			return POST_DATA_SECTION
+		}
+		return PRE_DATA_SECTION
+	case *ast.Insert, *ast.CopyFrom, *ast.LockTables, *ast.UnlockTables:
+		return DATA_SECTION
+	case *ast.Select:
+		if callsFunction(node, "setval") {
+			return DATA_SECTION
+		}
+	case *ast.AlterTable:
+		return alterTableSection(node)
+	}
+	return PRE_DATA_SECTION
+}
+
+// alterTableSection classifies ALTER TABLE: the indexes and constraints are post-data,
+// DISABLE KEYS and ENABLE KEYS of mysqldump surround the data
+func alterTableSection(alterTable *ast.AlterTable) DumpSection {
+	section := PRE_DATA_SECTION
+	for _, option := range alterTable.AlterOptions {
+		switch option.(type) {
+		case *ast.AddIndexDefinition, *ast.AddConstraintDefinition:
+			return POST_DATA_SECTION
+		case *ast.KeyState:
+			section = DATA_SECTION
+		}
+	}
+	return section
+}
+
+// IsSessionStatement checks the statement changes the session (SET or set_config)
+func IsSessionStatement(statementText string, statement ast.Statement) bool {
+	if sql_connection.DetectStatementType(statementText, statement) == ast.StmtSet {
+		return true
+	}
+	selectStatement, ok := statement.(*ast.Select)
+	return ok && callsFunction(selectStatement, "set_config")
+}
+
+// callsFunction checks the statement calls the function
+func callsFunction(statement ast.Statement, name string) bool {
+	found := false
+	ast.Walk(func(node ast.SQLNode) (bool, error) {
+		if funcExpr, ok := node.(*ast.FuncExpr); ok && funcExpr.Name.EqualString(name) {
+			found = true
+		}
+		return !found, nil
+	}, statement)
+	return found
+}
@@ -0,0 +1,194 @@
+package dump_rewriter
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// IndexDeferrer removes the secondary indexes and foreign keys from the CREATE TABLE statements.
+// The removed definitions are released as ALTER TABLE ... ADD (or CREATE INDEX) statements
+// when the data of the table is loaded: before the next statement which references the table
+// or at the end of the dump. The primary keys and the check constraints are kept.
+type IndexDeferrer struct {
+	sqlDialect  dialect.SqlDialect
+	tables      []string // Tables with deferred statements in order of creation
+	indexes     map[string][]RewrittenStatement
+	foreignKeys map[string][]RewrittenStatement
+}
+
+// NewIndexDeferrer makes the deferrer for the dialect, only mysql and pg support
+// adding of indexes and foreign keys to the existing table
+func NewIndexDeferrer(sqlDialect dialect.SqlDialect) *IndexDeferrer {
+	return &IndexDeferrer{
+		sqlDialect:  sqlDialect,
+		tables:      make([]string, 0),
+		indexes:     make(map[string][]RewrittenStatement),
+		foreignKeys: make(map[string][]RewrittenStatement),
+	}
+}
+
+// Defer removes the secondary indexes and foreign keys from the CREATE TABLE statement
+// and returns the text of the statement without them. The result is false if the statement
+// isn't changed.
+func (deferrer *IndexDeferrer) Defer(statement ast.Statement) (string, ast.Statement, bool) {
+	createTable, ok := statement.(*ast.CreateTable)
+	if !ok || !createTable.FullyParsed || createTable.TableSpec == nil {
+		return "", nil, false
+	}
+	if deferrer.sqlDialect != dialect.MYSQL && deferrer.sqlDialect != dialect.PSQL {
+		return "", nil, false
+	}
+
+	stripped := ast.CloneRefOfCreateTable(createTable)
+	indexes := make([]RewrittenStatement, 0)
+	keptIndexes := make([]*ast.IndexDefinition, 0, len(stripped.TableSpec.Indexes))
+	for _, index := range stripped.TableSpec.Indexes {
+		if index.Info.Primary {
+			keptIndexes = append(keptIndexes, index)
+			continue
+		}
+		indexes = append(indexes, deferrer.addIndex(stripped.Table, index))
+	}
+	foreignKeys := make([]RewrittenStatement, 0)
+	keptConstraints := make([]*ast.ConstraintDefinition, 0, len(stripped.TableSpec.Constraints))
+	for _, constraint := range stripped.TableSpec.Constraints {
+		if _, ok := constraint.Details.(*ast.ForeignKeyDefinition); !ok {
+			keptConstraints = append(keptConstraints, constraint)
+			continue
+		}
+		foreignKeys = append(foreignKeys, deferrer.addConstraint(stripped.Table, constraint))
+	}
+	if len(indexes) == 0 && len(foreignKeys) == 0 {
+		return "", nil, false
+	}
+	stripped.TableSpec.Indexes = keptIndexes
+	stripped.TableSpec.Constraints = keptConstraints
+
+	text := ast.DialectString(stripped, deferrer.sqlDialect)
+	table := tableKey(stripped.Table)
+	if _, ok := deferrer.indexes[table]; !ok {
+		if _, ok := deferrer.foreignKeys[table]; !ok {
+			deferrer.tables = append(deferrer.tables, table)
+		}
+	}
+	deferrer.indexes[table] = append(deferrer.indexes[table], indexes...)
+	deferrer.foreignKeys[table] = append(deferrer.foreignKeys[table], foreignKeys...)
+	return text, stripped, true
+}
+
+// Release returns the deferred statements of the tables referenced by the statement.
+// The data statements (INSERT ... VALUES, COPY) and the CREATE TABLE, LOCK TABLES and
+// ALTER TABLE ... DISABLE KEYS statements which precede the data of the table don't release
+// the deferred statements.
+func (deferrer *IndexDeferrer) Release(statement ast.Statement) []RewrittenStatement {
+	if len(deferrer.tables) == 0 || !needsData(statement) {
+		return nil
+	}
+	tables := make([]string, 0)
+	ast.Walk(func(node ast.SQLNode) (bool, error) {
+		if tableName, ok := node.(ast.TableName); ok {
+			table := tableKey(tableName)
+			if _, ok := deferrer.indexes[table]; ok && !slices.Contains(tables, table) {
+				tables = append(tables, table)
+			}
+		}
+		return true, nil
+	}, statement)
+	return deferrer.release(tables)
+}
+
+// ReleaseAll returns all deferred statements, the indexes of all tables are created
+// before the foreign keys
+func (deferrer *IndexDeferrer) ReleaseAll() []RewrittenStatement {
+	return deferrer.release(deferrer.tables)
+}
+
+func (deferrer *IndexDeferrer) release(tables []string) []RewrittenStatement {
+	statements := make([]RewrittenStatement, 0)
+	for _, table := range tables {
+		statements = append(statements, deferrer.indexes[table]...)
+	}
+	for _, table := range tables {
+		statements = append(statements, deferrer.foreignKeys[table]...)
+	}
+	for _, table := range tables {
+		delete(deferrer.indexes, table)
+		delete(deferrer.foreignKeys, table)
+	}
+	deferrer.tables = slices.DeleteFunc(deferrer.tables, func(table string) bool {
+		return slices.Contains(tables, table)
+	})
+	return statements
+}
+
+// addIndex makes the statement which adds the index to the table:
+// ALTER TABLE ... ADD for mysql and for the unique constraints of pg, CREATE INDEX for the other pg indexes
+func (deferrer *IndexDeferrer) addIndex(table ast.TableName, index *ast.IndexDefinition) RewrittenStatement {
+	alterTable := &ast.AlterTable{
+		Table:        table,
+		AlterOptions: []ast.AlterOption{&ast.AddIndexDefinition{IndexDefinition: index}},
+		FullyParsed:  true,
+	}
+	if deferrer.sqlDialect == dialect.MYSQL {
+		return RewrittenStatement{Text: ast.DialectString(alterTable, deferrer.sqlDialect), Statement: alterTable}
+	}
+
+	if index.Info.Unique {
+		unique := ast.CloneRefOfIndexDefinition(index)
+		unique.Info.Type = "unique"
+		// pg names the unique constraint by CONSTRAINT only, the key name becomes the constraint name
+		if unique.Info.ConstraintName.IsEmpty() {
+			unique.Info.ConstraintName = unique.Info.Name
+		}
+		unique.Info.Name = ast.NewColIdent("")
+		alterTable.AlterOptions = []ast.AlterOption{&ast.AddIndexDefinition{IndexDefinition: unique}}
+		return RewrittenStatement{Text: ast.DialectString(alterTable, deferrer.sqlDialect), Statement: alterTable}
+	}
+	columns := ast.CloneRefOfIndexDefinition(index)
+	columns.Info = &ast.IndexInfo{}
+	columns.Options = nil
+	buf := ast.NewTrackedBuffer(nil, deferrer.sqlDialect)
+	buf.Myprintf("create index ")
+	if !index.Info.Name.IsEmpty() {
+		buf.Myprintf("%v ", index.Info.Name)
+	}
+	buf.Myprintf("on %v %s", table, strings.TrimSpace(ast.DialectString(columns, deferrer.sqlDialect)))
+	return RewrittenStatement{Text: buf.String(), Statement: alterTable}
+}
+
+// addConstraint makes the ALTER TABLE ... ADD CONSTRAINT statement
+func (deferrer *IndexDeferrer) addConstraint(table ast.TableName, constraint *ast.ConstraintDefinition) RewrittenStatement {
+	alterTable := &ast.AlterTable{
+		Table:        table,
+		AlterOptions: []ast.AlterOption{&ast.AddConstraintDefinition{ConstraintDefinition: constraint}},
+		FullyParsed:  true,
+	}
+	return RewrittenStatement{Text: ast.DialectString(alterTable, deferrer.sqlDialect), Statement: alterTable}
+}
+
+// needsData checks the statement should be executed after the data of referenced tables
+func needsData(statement ast.Statement) bool {
+	switch node := statement.(type) {
+	case nil, *ast.CreateTable, *ast.CopyFrom, *ast.LockTables, *ast.UnlockTables:
+		return false
+	case *ast.Insert:
+		_, isValues := node.Rows.(ast.Values)
+		return !isValues
+	case *ast.AlterTable:
+		for _, option := range node.AlterOptions {
+			if keyState, ok := option.(*ast.KeyState); !ok || keyState.Enable {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// tableKey is the qualified name of the table in lower case
+func tableKey(tableName ast.TableName) string {
+	return strings.ToLower(ast.String(tableName))
+}
@@ -0,0 +1,396 @@
+package dump_rewriter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+var (
+	trueValue  = sql_types.NewInt64(1)
+	falseValue = sql_types.NewInt64(0)
+)
+
+// rowEvaluator evaluates the expression over the values of the row (by the lower case column names)
+// with the sql logic of NULL: the comparisons, AND, OR, XOR, NOT, IN, BETWEEN, LIKE, REGEXP, IS,
+// the arithmetic. The number is compared with the text as the number if the text is the number,
+// the other values are compared as the text. The result of logical expressions is 1, 0 or NULL.
+type rowEvaluator struct {
+	patterns map[string]*regexp.Regexp // The compiled patterns of LIKE and REGEXP
+}
+
+func newRowEvaluator() *rowEvaluator {
+	return &rowEvaluator{patterns: make(map[string]*regexp.Regexp)}
+}
+
+// match checks the expression is true for the row
+func (evaluator *rowEvaluator) match(expr ast.Expr, row map[string]sql_types.Value) (bool, error) {
+	value, err := evaluator.evaluate(expr, row)
+	if err != nil {
+		return false, err
+	}
+	result, known := truth(value)
+	return known && result, nil
+}
+
+func (evaluator *rowEvaluator) evaluate(expr ast.Expr, row map[string]sql_types.Value) (sql_types.Value, error) {
+	if value, ok := ast.ExprToValue(expr); ok {
+		return value, nil
+	}
+	switch node := expr.(type) {
+	case *ast.ColName:
+		value, ok := row[node.Name.Lowered()]
+		if !ok {
+			return sql_types.NULL, fmt.Errorf("column %v isn't found", node.Name.String())
+		}
+		return value, nil
+	case *ast.AndExpr, *ast.OrExpr, *ast.XorExpr:
+		return evaluator.logical(node, row)
+	case *ast.NotExpr:
+		value, err := evaluator.evaluate(node.Expr, row)
+		if err != nil {
+			return sql_types.NULL, err
+		}
+		result, known := truth(value)
+		if !known {
+			return sql_types.NULL, nil
+		}
+		return boolValue(!result), nil
+	case *ast.ComparisonExpr:
+		return evaluator.comparison(node, row)
+	case *ast.BetweenExpr:
+		values, err := evaluator.evaluateAll(row, node.Left, node.From, node.To)
+		if err != nil || values == nil {
+			return sql_types.NULL, err
+		}
+		between := compareValues(values[0], values[1]) >= 0 && compareValues(values[0], values[2]) <= 0
+		return boolValue(between == node.IsBetween), nil
+	case *ast.IsExpr:
+		value, err := evaluator.evaluate(node.Left, row)
+		if err != nil {
+			return sql_types.NULL, err
+		}
+		result, known := truth(value)
+		switch node.Right {
+		case ast.IsNullOp:
+			return boolValue(value.IsNull()), nil
+		case ast.IsNotNullOp:
+			return boolValue(!value.IsNull()), nil
+		case ast.IsTrueOp:
+			return boolValue(known && result), nil
+		case ast.IsNotTrueOp:
+			return boolValue(!(known && result)), nil
+		case ast.IsFalseOp:
+			return boolValue(known && !result), nil
+		case ast.IsNotFalseOp:
+			return boolValue(!(known && !result)), nil
+		}
+	case *ast.BinaryExpr:
+		values, err := evaluator.evaluateAll(row, node.Left, node.Right)
+		if err != nil || values == nil {
+			return sql_types.NULL, err
+		}
+		return arithmetic(node.Operator, values[0], values[1])
+	case *ast.UnaryExpr:
+		value, err := evaluator.evaluate(node.Expr, row)
+		if err != nil || value.IsNull() {
+			return sql_types.NULL, err
+		}
+		switch node.Operator {
+		case ast.UPlusOp:
+			return value, nil
+		case ast.UMinusOp:
+			return arithmetic(ast.MinusOp, sql_types.NewInt64(0), value)
+		case ast.BangOp:
+			result, _ := truth(value)
+			return boolValue(!result), nil
+		}
+	}
+	return sql_types.NULL, fmt.Errorf("expression %v isn't supported", ast.DialectString(expr, dialect.MYSQL))
+}
+
+// evaluateAll evaluates the expressions, the result is nil if any value is NULL
+func (evaluator *rowEvaluator) evaluateAll(row map[string]sql_types.Value, exprs ...ast.Expr) ([]sql_types.Value, error) {
+	values := make([]sql_types.Value, 0, len(exprs))
+	isNull := false
+	for _, expr := range exprs {
+		value, err := evaluator.evaluate(expr, row)
+		if err != nil {
+			return nil, err
+		}
+		isNull = isNull || value.IsNull()
+		values = append(values, value)
+	}
+	if isNull {
+		return nil, nil
+	}
+	return values, nil
+}
+
+func (evaluator *rowEvaluator) logical(expr ast.Expr, row map[string]sql_types.Value) (sql_types.Value, error) {
+	var left, right ast.Expr
+	switch node := expr.(type) {
+	case *ast.AndExpr:
+		left, right = node.Left, node.Right
+	case *ast.OrExpr:
+		left, right = node.Left, node.Right
+	case *ast.XorExpr:
+		left, right = node.Left, node.Right
+	}
+	leftValue, err := evaluator.evaluate(left, row)
+	if err != nil {
+		return sql_types.NULL, err
+	}
+	rightValue, err := evaluator.evaluate(right, row)
+	if err != nil {
+		return sql_types.NULL, err
+	}
+	leftResult, leftKnown := truth(leftValue)
+	rightResult, rightKnown := truth(rightValue)
+	switch expr.(type) {
+	case *ast.AndExpr:
+		if (leftKnown && !leftResult) || (rightKnown && !rightResult) {
+			return falseValue, nil
+		}
+		if leftKnown && rightKnown {
+			return trueValue, nil
+		}
+	case *ast.OrExpr:
+		if (leftKnown && leftResult) || (rightKnown && rightResult) {
+			return trueValue, nil
+		}
+		if leftKnown && rightKnown {
+			return falseValue, nil
+		}
+	case *ast.XorExpr:
+		if leftKnown && rightKnown {
+			return boolValue(leftResult != rightResult), nil
+		}
+	}
+	return sql_types.NULL, nil
+}
+
+func (evaluator *rowEvaluator) comparison(node *ast.ComparisonExpr, row map[string]sql_types.Value) (sql_types.Value, error) {
+	if node.Escape != nil {
+		return sql_types.NULL, fmt.Errorf("escape of LIKE isn't supported")
+	}
+	left, err := evaluator.evaluate(node.Left, row)
+	if err != nil {
+		return sql_types.NULL, err
+	}
+	switch node.Operator {
+	case ast.InOp, ast.NotInOp:
+		tuple, ok := node.Right.(ast.ValTuple)
+		if !ok {
+			return sql_types.NULL, fmt.Errorf("IN expects the list of values")
+		}
+		if left.IsNull() {
+			return sql_types.NULL, nil
+		}
+		found, hasNull := false, false
+		for _, expr := range tuple {
+			value, err := evaluator.evaluate(expr, row)
+			if err != nil {
+				return sql_types.NULL, err
+			}
+			if value.IsNull() {
+				hasNull = true
+			} else if compareValues(left, value) == 0 {
+				found = true
+			}
+		}
+		if !found && hasNull {
+			return sql_types.NULL, nil
+		}
+		return boolValue(found == (node.Operator == ast.InOp)), nil
+	}
+
+	right, err := evaluator.evaluate(node.Right, row)
+	if err != nil {
+		return sql_types.NULL, err
+	}
+	if node.Operator == ast.NullSafeEqualOp {
+		if left.IsNull() || right.IsNull() {
+			return boolValue(left.IsNull() && right.IsNull()), nil
+		}
+		return boolValue(compareValues(left, right) == 0), nil
+	}
+	if left.IsNull() || right.IsNull() {
+		return sql_types.NULL, nil
+	}
+	switch node.Operator {
+	case ast.EqualOp:
+		return boolValue(compareValues(left, right) == 0), nil
+	case ast.NotEqualOp:
+		return boolValue(compareValues(left, right) != 0), nil
+	case ast.LessThanOp:
+		return boolValue(compareValues(left, right) < 0), nil
+	case ast.LessEqualOp:
+		return boolValue(compareValues(left, right) <= 0), nil
+	case ast.GreaterThanOp:
+		return boolValue(compareValues(left, right) > 0), nil
+	case ast.GreaterEqualOp:
+		return boolValue(compareValues(left, right) >= 0), nil
+	case ast.LikeOp, ast.NotLikeOp:
+		pattern := evaluator.pattern("like:"+right.RawStr(), func() (*regexp.Regexp, error) {
+			return sql_parser.LikeToRegexp(right.RawStr()), nil
+		})
+		return boolValue(pattern.MatchString(left.RawStr()) == (node.Operator == ast.LikeOp)), nil
+	case ast.RegexpOp, ast.NotRegexpOp:
+		var compileErr error
+		pattern := evaluator.pattern("regexp:"+right.RawStr(), func() (*regexp.Regexp, error) {
+			pattern, err := regexp.Compile(right.RawStr())
+			compileErr = err
+			return pattern, err
+		})
+		if pattern == nil {
+			return sql_types.NULL, compileErr
+		}
+		return boolValue(pattern.MatchString(left.RawStr()) == (node.Operator == ast.RegexpOp)), nil
+	}
+	return sql_types.NULL, fmt.Errorf("operator %v isn't supported", node.Operator.ToString())
+}
+
+// pattern returns the compiled pattern by the key, the pattern is compiled by the first call
+func (evaluator *rowEvaluator) pattern(key string, compile func() (*regexp.Regexp, error)) *regexp.Regexp {
+	if pattern, ok := evaluator.patterns[key]; ok {
+		return pattern
+	}
+	pattern, err := compile()
+	if err != nil {
+		return nil
+	}
+	evaluator.patterns[key] = pattern
+	return pattern
+}
+
+// truth returns the logical value of the value (the number or the boolean isn't zero), the result is unknown for NULL
+func truth(value sql_types.Value) (bool, bool) {
+	if value.IsNull() {
+		return false, false
+	}
+	number, ok := toNumber(value)
+	if !ok {
+		return false, true
+	}
+	result, _ := number.ToFloat64()
+	return result != 0, true
+}
+
+func boolValue(value bool) sql_types.Value {
+	if value {
+		return trueValue
+	}
+	return falseValue
+}
+
+// toNumber returns the number as is and parses the number of the text, the booleans
+// of pg COPY data (t, f) and the boolean literals (true, false) are 1 and 0
+func toNumber(value sql_types.Value) (sql_types.Value, bool) {
+	if sql_types.IsNumber(value.Type()) {
+		return value, true
+	}
+	text := strings.TrimSpace(value.RawStr())
+	switch strings.ToLower(text) {
+	case "t", "true":
+		return trueValue, true
+	case "f", "false":
+		return falseValue, true
+	}
+	if signed, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return sql_types.NewInt64(signed), true
+	}
+	if float, err := strconv.ParseFloat(text, 64); err == nil {
+		return sql_types.NewFloat64(float), true
+	}
+	return sql_types.NULL, false
+}
+
+// compareValues compares the values as numbers if any of them is the number and the other is
+// the number too (or the text of the number), the other values are compared as the text
+func compareValues(left sql_types.Value, right sql_types.Value) int {
+	if sql_types.IsNumber(left.Type()) || sql_types.IsNumber(right.Type()) {
+		leftNumber, leftOk := toNumber(left)
+		rightNumber, rightOk := toNumber(right)
+		if leftOk && rightOk {
+			if leftNumber.IsSigned() && rightNumber.IsSigned() {
+				leftInt, _ := leftNumber.ToInt64()
+				rightInt, _ := rightNumber.ToInt64()
+				return compareOrdered(leftInt, rightInt)
+			}
+			leftFloat, _ := leftNumber.ToFloat64()
+			rightFloat, _ := rightNumber.ToFloat64()
+			return compareOrdered(leftFloat, rightFloat)
+		}
+	}
+	return strings.Compare(left.RawStr(), right.RawStr())
+}
+
+func compareOrdered[T int64 | float64](left T, right T) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
+
+// arithmetic calculates the operation over the numbers, the result is NULL if the value
+// isn't the number or the divisor is zero
+func arithmetic(operator ast.BinaryExprOperator, left sql_types.Value, right sql_types.Value) (sql_types.Value, error) {
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	if !leftOk || !rightOk {
+		return sql_types.NULL, nil
+	}
+	if leftNumber.IsSigned() && rightNumber.IsSigned() && operator != ast.DivOp {
+		leftInt, _ := leftNumber.ToInt64()
+		rightInt, _ := rightNumber.ToInt64()
+		switch operator {
+		case ast.PlusOp:
+			return sql_types.NewInt64(leftInt + rightInt), nil
+		case ast.MinusOp:
+			return sql_types.NewInt64(leftInt - rightInt), nil
+		case ast.MultOp:
+			return sql_types.NewInt64(leftInt * rightInt), nil
+		case ast.IntDivOp, ast.ModOp:
+			if rightInt == 0 {
+				return sql_types.NULL, nil
+			}
+			if operator == ast.IntDivOp {
+				return sql_types.NewInt64(leftInt / rightInt), nil
+			}
+			return sql_types.NewInt64(leftInt % rightInt), nil
+		}
+	}
+	leftFloat, _ := leftNumber.ToFloat64()
+	rightFloat, _ := rightNumber.ToFloat64()
+	switch operator {
+	case ast.PlusOp:
+		return sql_types.NewFloat64(leftFloat + rightFloat), nil
+	case ast.MinusOp:
+		return sql_types.NewFloat64(leftFloat - rightFloat), nil
+	case ast.MultOp:
+		return sql_types.NewFloat64(leftFloat * rightFloat), nil
+	case ast.DivOp, ast.IntDivOp, ast.ModOp:
+		if rightFloat == 0 {
+			return sql_types.NULL, nil
+		}
+		switch operator {
+		case ast.DivOp:
+			return sql_types.NewFloat64(leftFloat / rightFloat), nil
+		case ast.IntDivOp:
+			return sql_types.NewInt64(int64(leftFloat / rightFloat)), nil
+		}
+		return sql_types.NewFloat64(math.Mod(leftFloat, rightFloat)), nil
+	}
+	return sql_types.NULL, fmt.Errorf("operator %v isn't supported", operator.ToString())
+}
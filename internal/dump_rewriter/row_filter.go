@@ -0,0 +1,180 @@
+package dump_rewriter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// The dialect of the conditions of rows (the grammar of expressions is the most complete)
+const ROW_FILTER_DIALECT = dialect.MYSQL
+
+// RowFilter keeps the rows of INSERT ... VALUES and COPY ... FROM stdin data matching
+// the condition of the table, the rows of the other tables are kept
+type RowFilter struct {
+	sqlDialect dialect.SqlDialect
+	conditions map[string]ast.Expr
+	columns    tableColumns
+	evaluator  *rowEvaluator
+}
+
+// NewRowFilter makes the filter by the conditions 'table: expression' (or 'schema.table: expression'),
+// the conditions of the same table are combined by AND
+func NewRowFilter(conditions []string, sqlDialect dialect.SqlDialect) (*RowFilter, error) {
+	filter := &RowFilter{
+		sqlDialect: sqlDialect,
+		conditions: make(map[string]ast.Expr),
+		columns:    make(tableColumns),
+		evaluator:  newRowEvaluator(),
+	}
+	for _, condition := range conditions {
+		table, text, ok := strings.Cut(condition, ":")
+		table = strings.ToLower(strings.TrimSpace(table))
+		if !ok || table == "" || strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("condition %v isn't 'table: expression'", condition)
+		}
+		expr, err := sql_parser.ParseExpr(text, ROW_FILTER_DIALECT)
+		if err != nil {
+			return nil, fmt.Errorf("condition of table %v isn't parsed (%v)", table, err)
+		}
+		if previous, ok := filter.conditions[table]; ok {
+			expr = &ast.AndExpr{Left: previous, Right: expr}
+		}
+		filter.conditions[table] = expr
+	}
+	return filter, nil
+}
+
+// condition returns the condition of the table, the condition of the qualified name goes first
+func (filter *RowFilter) condition(table ast.TableName) ast.Expr {
+	for _, name := range tableNames(table) {
+		if expr, ok := filter.conditions[name]; ok {
+			return expr
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the columns of the statement with the condition, nil if the table hasn't the condition
+func (filter *RowFilter) tableColumns(table ast.TableName, columns ast.Columns) (ast.Expr, []string, error) {
+	condition := filter.condition(table)
+	if condition == nil {
+		return nil, nil, nil
+	}
+	names := filter.columns.resolve(table, columns)
+	if names == nil {
+		return nil, nil, fmt.Errorf("columns of table %v are unknown (CREATE TABLE statement isn't found), the condition can't be applied", ast.DialectString(table, filter.sqlDialect))
+	}
+	return condition, names, nil
+}
+
+// Filter returns the statement with the rows of INSERT ... VALUES matching the condition of the table,
+// the result is false if no row matches (the statement is skipped). The columns of CREATE TABLE
+// statements are remembered for the following statements.
+func (filter *RowFilter) Filter(statementText string, statement ast.Statement) (string, ast.Statement, bool, error) {
+	switch node := statement.(type) {
+	case nil:
+		if len(filter.conditions) > 0 && sql_connection.DetectStatementType(statementText, nil) == ast.StmtInsert {
+			return statementText, statement, true, fmt.Errorf("INSERT statement isn't parsed, the row conditions can't be applied")
+		}
+	case *ast.CreateTable:
+		filter.RememberColumns(statement)
+	case *ast.Insert:
+		condition, columns, err := filter.tableColumns(node.Table, node.Columns)
+		if err != nil || condition == nil {
+			return statementText, statement, true, err
+		}
+		rows, ok := node.Rows.(ast.Values)
+		if !ok {
+			return statementText, statement, true, fmt.Errorf("INSERT ... SELECT into table %v can't be filtered", ast.DialectString(node.Table, filter.sqlDialect))
+		}
+		selected := make(ast.Values, 0, len(rows))
+		for _, tuple := range rows {
+			row := make(map[string]sql_types.Value, len(columns))
+			for i, column := range columns {
+				if i >= len(tuple) {
+					break
+				}
+				value, ok := ast.ExprToValue(tuple[i])
+				if !ok {
+					// The expression (the function call etc.) is compared by the sql text
+					value = sql_types.NewVarChar(ast.DialectString(tuple[i], filter.sqlDialect))
+				}
+				row[column] = value
+			}
+			match, err := filter.evaluator.match(condition, row)
+			if err != nil {
+				return statementText, statement, true, fmt.Errorf("condition of table %v isn't evaluated (%v)", ast.DialectString(node.Table, filter.sqlDialect), err)
+			}
+			if match {
+				selected = append(selected, tuple)
+			}
+		}
+		switch len(selected) {
+		case 0:
+			return statementText, statement, false, nil
+		case len(rows):
+			return statementText, statement, true, nil
+		}
+		insert := ast.CloneRefOfInsert(node)
+		insert.Rows = selected
+		return ast.DialectString(insert, filter.sqlDialect), insert, true, nil
+	}
+	return statementText, statement, true, nil
+}
+
+// RememberColumns remembers the columns of CREATE TABLE statement for the following statements,
+// the columns of the skipped statements (for example, the pre-data section) are remembered as well
+func (filter *RowFilter) RememberColumns(statement ast.Statement) {
+	filter.columns.remember(statement)
+}
+
+// FilterCopyData returns the reader of the data lines of COPY ... FROM stdin statement matching
+// the condition of the table, the data is returned as is if the table hasn't the condition
+func (filter *RowFilter) FilterCopyData(statementText string, statement ast.Statement, data io.Reader) (io.Reader, error) {
+	copyFrom, ok := statement.(*ast.CopyFrom)
+	if !ok {
+		if len(filter.conditions) > 0 {
+			return data, fmt.Errorf("COPY statement isn't parsed, the row conditions can't be applied")
+		}
+		return data, nil
+	}
+	condition, columns, err := filter.tableColumns(copyFrom.Table, copyFrom.Columns)
+	if err != nil || condition == nil {
+		return data, err
+	}
+	table := ast.DialectString(copyFrom.Table, filter.sqlDialect)
+	return sql_parser.NewCopyLineReader(data, func(line string) (string, error) {
+		match, err := filter.matchLine(condition, columns, line)
+		if err != nil {
+			return "", fmt.Errorf("condition of table %v isn't evaluated (%v)", table, err)
+		}
+		if !match {
+			return "", nil
+		}
+		return line, nil
+	}), nil
+}
+
+// matchLine checks the line of COPY data matches the condition
+func (filter *RowFilter) matchLine(condition ast.Expr, columns []string, line string) (bool, error) {
+	fields := sql_parser.SplitCopyTextLine(strings.TrimSuffix(line, "\n"))
+	row := make(map[string]sql_types.Value, len(columns))
+	for i, column := range columns {
+		if i >= len(fields) {
+			break
+		}
+		value := sql_types.NULL
+		if text, valid := sql_parser.DecodeCopyTextField(fields[i]); valid {
+			value = sql_types.NewVarChar(text)
+		}
+		row[column] = value
+	}
+	return filter.evaluator.match(condition, row)
+}
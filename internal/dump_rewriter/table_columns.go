@@ -0,0 +1,53 @@
+package dump_rewriter
+
+import (
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+)
+
+// tableColumns keeps the columns (lower case) of created tables by the table name
+// and by the name qualified by the schema
+type tableColumns map[string][]string
+
+// remember remembers the columns of CREATE TABLE statement, the other statements are ignored
+func (columns tableColumns) remember(statement ast.Statement) {
+	createTable, ok := statement.(*ast.CreateTable)
+	if !ok || createTable.TableSpec == nil {
+		return
+	}
+	names := make([]string, 0, len(createTable.TableSpec.Columns))
+	for _, column := range createTable.TableSpec.Columns {
+		names = append(names, column.Name.Lowered())
+	}
+	for _, name := range tableNames(createTable.Table) {
+		columns[name] = names
+	}
+}
+
+// resolve returns the columns of the statement, the columns of the created table if the statement
+// doesn't list the columns or nil if the columns aren't known
+func (columns tableColumns) resolve(table ast.TableName, statementColumns ast.Columns) []string {
+	if len(statementColumns) > 0 {
+		names := make([]string, 0, len(statementColumns))
+		for _, column := range statementColumns {
+			names = append(names, column.Lowered())
+		}
+		return names
+	}
+	for _, name := range tableNames(table) {
+		if names, ok := columns[name]; ok {
+			return names
+		}
+	}
+	return nil
+}
+
+// tableNames returns the keys of the table: the name qualified by the schema and the name
+func tableNames(table ast.TableName) []string {
+	name := strings.ToLower(table.Name.String())
+	if table.Qualifier.IsEmpty() {
+		return []string{name}
+	}
+	return []string{strings.ToLower(table.Qualifier.String()) + "." + name, name}
+}
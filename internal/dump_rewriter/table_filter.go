@@ -0,0 +1,149 @@
+package dump_rewriter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// Characters of the glob pattern, the other patterns are LIKE patterns
+const GLOB_PATTERN_CHARS = "*?["
+
+// tablePattern matches the table name by the LIKE pattern (% and _) or by the glob pattern (*, ? and [...])
+type tablePattern struct {
+	glob string
+	like *regexp.Regexp
+}
+
+func newTablePattern(pattern string) (tablePattern, error) {
+	pattern = strings.ToLower(pattern)
+	if !strings.ContainsAny(pattern, GLOB_PATTERN_CHARS) {
+		return tablePattern{like: sql_parser.LikeToRegexp(pattern)}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return tablePattern{}, fmt.Errorf("pattern %v is wrong (%v)", pattern, err)
+	}
+	return tablePattern{glob: pattern}, nil
+}
+
+func (pattern tablePattern) match(name string) bool {
+	if pattern.like != nil {
+		return pattern.like.MatchString(name)
+	}
+	matched, _ := path.Match(pattern.glob, name)
+	return matched
+}
+
+// TableFilter selects the statements by the table names. The table is selected if
+// it matches any of the include patterns (or the include patterns aren't defined)
+// and doesn't match the exclude patterns. The patterns are matched case-insensitively
+// against the table name and against the name qualified by the schema.
+type TableFilter struct {
+	include    []tablePattern
+	exclude    []tablePattern
+	sqlDialect dialect.SqlDialect // Dialect of the rewritten statements
+}
+
+// NewTableFilter makes the filter, the patterns are LIKE patterns (users%)
+// or glob patterns (users*) if they contain *, ? or [
+func NewTableFilter(include []string, exclude []string, sqlDialect dialect.SqlDialect) (*TableFilter, error) {
+	filter := &TableFilter{
+		include:    make([]tablePattern, 0, len(include)),
+		exclude:    make([]tablePattern, 0, len(exclude)),
+		sqlDialect: sqlDialect,
+	}
+	for _, pattern := range include {
+		tablePattern, err := newTablePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, tablePattern)
+	}
+	for _, pattern := range exclude {
+		tablePattern, err := newTablePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, tablePattern)
+	}
+	return filter, nil
+}
+
+// Match checks the table is selected by the filter
+func (filter *TableFilter) Match(tableName ast.TableName) bool {
+	names := []string{strings.ToLower(tableName.Name.String())}
+	if !tableName.Qualifier.IsEmpty() {
+		names = append(names, strings.ToLower(tableName.Qualifier.String()+"."+tableName.Name.String()))
+	}
+	matchAny := func(patterns []tablePattern) bool {
+		for _, pattern := range patterns {
+			for _, name := range names {
+				if pattern.match(name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return (len(filter.include) == 0 || matchAny(filter.include)) && !matchAny(filter.exclude)
+}
+
+// Filter checks the tables of CREATE, ALTER, DROP, TRUNCATE, INSERT, COPY and LOCK TABLES statements.
+// The statement is skipped (the result is false) if its tables aren't selected. The DROP TABLE and
+// LOCK TABLES statements with several tables are rewritten with the selected tables only.
+// The other statements (and the statements which aren't parsed) are selected as is.
+func (filter *TableFilter) Filter(statementText string, statement ast.Statement) (string, ast.Statement, bool) {
+	switch node := statement.(type) {
+	case *ast.CreateTable:
+		return statementText, statement, filter.Match(node.Table)
+	case *ast.AlterTable:
+		return statementText, statement, filter.Match(node.Table)
+	case *ast.TruncateTable:
+		return statementText, statement, filter.Match(node.Table)
+	case *ast.Insert:
+		return statementText, statement, filter.Match(node.Table)
+	case *ast.CopyFrom:
+		return statementText, statement, filter.Match(node.Table)
+	case *ast.DropTable:
+		selected := make(ast.TableNames, 0, len(node.FromTables))
+		for _, tableName := range node.FromTables {
+			if filter.Match(tableName) {
+				selected = append(selected, tableName)
+			}
+		}
+		if len(selected) == len(node.FromTables) {
+			return statementText, statement, true
+		}
+		if len(selected) == 0 {
+			return statementText, statement, false
+		}
+		dropTable := ast.CloneRefOfDropTable(node)
+		dropTable.FromTables = selected
+		return ast.DialectString(dropTable, filter.sqlDialect), dropTable, true
+	case *ast.LockTables:
+		selected := make(ast.TableAndLockTypes, 0, len(node.Tables))
+		for _, table := range node.Tables {
+			if tableExpr, ok := table.Table.(*ast.AliasedTableExpr); ok {
+				if tableName, ok := tableExpr.Expr.(ast.TableName); ok && !filter.Match(tableName) {
+					continue
+				}
+			}
+			selected = append(selected, table)
+		}
+		if len(selected) == len(node.Tables) {
+			return statementText, statement, true
+		}
+		if len(selected) == 0 {
+			return statementText, statement, false
+		}
+		lockTables := ast.CloneRefOfLockTables(node)
+		lockTables.Tables = selected
+		return ast.DialectString(lockTables, filter.sqlDialect), lockTables, true
+	}
+	return statementText, statement, true
+}
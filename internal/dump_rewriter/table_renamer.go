@@ -0,0 +1,470 @@
+package dump_rewriter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// Functions which take the name of the sequence or of the table as the string
+var renamedNameFunctions = map[string]bool{"nextval": true, "setval": true, "currval": true}
+
+// TableRenamer renames the tables and maps the schemas of the statements. The names of indexes,
+// constraints and sequences which start with the renamed table name and '_' (users_pkey,
+// users_id_seq) are renamed too, the search_path of SET and set_config is mapped.
+//
+// The statements which are printed back without losses (INSERT, UPDATE, DELETE, DROP, TRUNCATE,
+// LOCK TABLES, USE and the fully parsed CREATE TABLE) are rewritten by the table names of the AST,
+// the other statements (COPY, ALTER TABLE ONLY, CREATE SEQUENCE, CREATE INDEX ... USING etc.) are
+// rewritten by the names of the sql tokens.
+type TableRenamer struct {
+	sqlDialect dialect.SqlDialect
+	tables     map[string]ast.TableName // New names by the old name or the name qualified by the schema (lower case)
+	schemas    map[string]string        // New schemas by the old schema (lower case)
+}
+
+// NewTableRenamer makes the renamer by the renames 'old=new' of tables (users=members,
+// public.users=archive.users) and of schemas (public=tenant_a)
+func NewTableRenamer(tableRenames []string, schemaMaps []string, sqlDialect dialect.SqlDialect) (*TableRenamer, error) {
+	renamer := &TableRenamer{
+		sqlDialect: sqlDialect,
+		tables:     make(map[string]ast.TableName),
+		schemas:    make(map[string]string),
+	}
+	for _, rename := range tableRenames {
+		from, to, err := splitRename(rename)
+		if err != nil {
+			return nil, err
+		}
+		if len(to) > 2 || len(from) > 2 {
+			return nil, fmt.Errorf("table name of rename %v isn't 'table' or 'schema.table'", rename)
+		}
+		newName := ast.TableName{Name: ast.NewTableIdent(to[len(to)-1])}
+		if len(to) == 2 {
+			newName.Qualifier = ast.NewTableIdent(to[0])
+		}
+		renamer.tables[strings.ToLower(strings.Join(from, "."))] = newName
+	}
+	for _, schemaMap := range schemaMaps {
+		from, to, err := splitRename(schemaMap)
+		if err != nil {
+			return nil, err
+		}
+		if len(to) > 1 || len(from) > 1 {
+			return nil, fmt.Errorf("schema of map %v isn't the name", schemaMap)
+		}
+		renamer.schemas[strings.ToLower(from[0])] = to[0]
+	}
+	return renamer, nil
+}
+
+// splitRename splits 'old=new' into the parts of the old and of the new names
+func splitRename(rename string) ([]string, []string, error) {
+	from, to, ok := strings.Cut(rename, "=")
+	fromParts := strings.Split(strings.TrimSpace(from), ".")
+	toParts := strings.Split(strings.TrimSpace(to), ".")
+	if !ok {
+		return nil, nil, fmt.Errorf("rename %v isn't 'old=new'", rename)
+	}
+	for _, part := range append(fromParts, toParts...) {
+		if part == "" {
+			return nil, nil, fmt.Errorf("rename %v isn't 'old=new'", rename)
+		}
+	}
+	return fromParts, toParts, nil
+}
+
+// renameTable returns the new schema and the new name of the table, the schema is mapped
+// if the table isn't renamed into the other schema
+func (renamer *TableRenamer) renameTable(qualifier string, name string) (string, string) {
+	newQualifier, newName := qualifier, name
+	key := strings.ToLower(name)
+	if qualifier != "" {
+		key = strings.ToLower(qualifier) + "." + key
+	}
+	to, ok := renamer.tables[key]
+	if !ok && qualifier != "" {
+		to, ok = renamer.tables[strings.ToLower(name)]
+	}
+	if ok {
+		newName = to.Name.String()
+		if !to.Qualifier.IsEmpty() {
+			return to.Qualifier.String(), newName
+		}
+	}
+	return renamer.mapSchema(newQualifier), newName
+}
+
+// renameDerived returns the new schema and the new name of the index, the constraint or
+// the sequence which name starts with the name of the renamed table and '_'
+func (renamer *TableRenamer) renameDerived(qualifier string, name string) (string, string) {
+	lowerName := strings.ToLower(name)
+	for key, to := range renamer.tables {
+		keyQualifier, keyName, qualified := strings.Cut(key, ".")
+		if !qualified {
+			keyQualifier, keyName = "", key
+		} else if keyQualifier != strings.ToLower(qualifier) {
+			continue
+		}
+		if strings.HasPrefix(lowerName, keyName+"_") {
+			return renamer.mapSchema(qualifier), to.Name.String() + name[len(keyName):]
+		}
+	}
+	return renamer.mapSchema(qualifier), name
+}
+
+func (renamer *TableRenamer) mapSchema(schema string) string {
+	if to, ok := renamer.schemas[strings.ToLower(schema)]; ok {
+		return to
+	}
+	return schema
+}
+
+// mapSearchPath maps the schemas of the comma separated list
+func (renamer *TableRenamer) mapSearchPath(searchPath string) string {
+	schemas := strings.Split(searchPath, ",")
+	for i, schema := range schemas {
+		trimmed := strings.TrimSpace(schema)
+		if trimmed == "" {
+			continue
+		}
+		schemas[i] = strings.Replace(schema, trimmed, renamer.mapSchema(trimmed), 1)
+	}
+	return strings.Join(schemas, ",")
+}
+
+// Rename returns the statement with the renamed tables and the mapped schemas,
+// the statement is returned as is if nothing is renamed
+func (renamer *TableRenamer) Rename(statementText string, statement ast.Statement) (string, ast.Statement) {
+	if renamer.printable(statement) {
+		renamed, changed := renamer.renameNodes(statement)
+		if !changed {
+			return statementText, statement
+		}
+		return ast.DialectString(renamed, renamer.sqlDialect), renamed
+	}
+	text := renamer.renameTokens(statementText, unqualifiedTables(statement))
+	if text == statementText {
+		return statementText, statement
+	}
+	// The statement which isn't printed back (partially parsed) is parsed again
+	renamed, err := sql_parser.Parse(text, renamer.sqlDialect)
+	if err != nil {
+		return text, nil
+	}
+	return text, renamed
+}
+
+// printable checks the statement is printed back without losses
+func (renamer *TableRenamer) printable(statement ast.Statement) bool {
+	switch node := statement.(type) {
+	case *ast.Insert, *ast.Update, *ast.Delete, *ast.DropTable, *ast.TruncateTable, *ast.LockTables, *ast.Use:
+		return true
+	case *ast.CreateTable:
+		return node.IsFullyParsed() && node.TableSpec != nil
+	}
+	return false
+}
+
+// renameNodes renames the table names, the names of indexes and constraints and the names
+// of the sequences (the string argument of nextval, setval and currval) of the cloned statement
+func (renamer *TableRenamer) renameNodes(statement ast.Statement) (ast.Statement, bool) {
+	renamed := ast.CloneStatement(statement)
+	changed := false
+	if use, ok := renamed.(*ast.Use); ok {
+		if schema := renamer.mapSchema(use.DBName.String()); schema != use.DBName.String() {
+			use.DBName = ast.NewTableIdent(schema)
+			changed = true
+		}
+		return renamed, changed
+	}
+	var rename ast.ApplyFunc
+	rename = func(cursor *ast.Cursor) bool {
+		switch node := cursor.Node().(type) {
+		case *ast.LockTables:
+			// The tables of LOCK TABLES aren't visited by the generated functions of the AST
+			for _, table := range node.Tables {
+				table.Table = ast.Rewrite(table.Table, rename, nil).(ast.TableExpr)
+			}
+		case ast.TableName:
+			if node.IsEmpty() {
+				return false
+			}
+			qualifier, name := renamer.renameTable(node.Qualifier.String(), node.Name.String())
+			if qualifier != node.Qualifier.String() || name != node.Name.String() {
+				cursor.Replace(ast.TableName{Name: ast.NewTableIdent(name), Qualifier: ast.NewTableIdent(qualifier)})
+				changed = true
+			}
+			return false
+		case *ast.IndexInfo:
+			for _, indexName := range []*ast.ColIdent{&node.Name, &node.ConstraintName} {
+				if _, name := renamer.renameDerived("", indexName.String()); name != indexName.String() {
+					*indexName = ast.NewColIdent(name)
+					changed = true
+				}
+			}
+		case *ast.ConstraintDefinition:
+			if _, name := renamer.renameDerived("", node.Name.String()); name != node.Name.String() {
+				node.Name = ast.NewColIdent(name)
+				changed = true
+			}
+		case *ast.FuncExpr:
+			if !renamedNameFunctions[node.Name.Lowered()] || len(node.Exprs) == 0 {
+				return true
+			}
+			if argument, ok := node.Exprs[0].(*ast.AliasedExpr); ok {
+				if literal, ok := argument.Expr.(*ast.Literal); ok && literal.Type == ast.StrVal {
+					if name := renamer.renameSequence(literal.Val); name != literal.Val {
+						argument.Expr = ast.NewStrLiteral(name)
+						changed = true
+					}
+				}
+			}
+		}
+		return true
+	}
+	renamed = ast.Rewrite(renamed, rename, nil).(ast.Statement)
+	return renamed, changed
+}
+
+// renameSequence renames the sequence (or the table) of the string 'schema.name'
+func (renamer *TableRenamer) renameSequence(text string) string {
+	parts := strings.Split(text, ".")
+	if len(parts) > 2 {
+		return text
+	}
+	qualifier, name := "", parts[len(parts)-1]
+	if len(parts) == 2 {
+		qualifier = parts[0]
+	}
+	newQualifier, newName := renamer.renameTable(unquoteName(qualifier), unquoteName(name))
+	if newName == unquoteName(name) {
+		newQualifier, newName = renamer.renameDerived(unquoteName(qualifier), unquoteName(name))
+	}
+	if newQualifier == unquoteName(qualifier) && newName == unquoteName(name) {
+		return text
+	}
+	if newQualifier == "" {
+		return newName
+	}
+	return newQualifier + "." + newName
+}
+
+func unquoteName(name string) string {
+	if len(name) >= 2 && (name[0] == '"' || name[0] == '`') && name[len(name)-1] == name[0] {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+// unqualifiedTables returns the names (lower case) of the tables without the schema of the statement
+func unqualifiedTables(statement ast.Statement) map[string]bool {
+	tables := make(map[string]bool)
+	if statement == nil {
+		return tables
+	}
+	addTable := func(table ast.TableName) {
+		if table.Qualifier.IsEmpty() && !table.Name.IsEmpty() {
+			tables[strings.ToLower(table.Name.String())] = true
+		}
+	}
+	// COPY isn't visited by the generated functions of the AST
+	if copyFrom, ok := statement.(*ast.CopyFrom); ok {
+		addTable(copyFrom.Table)
+		return tables
+	}
+	ast.Rewrite(statement, func(cursor *ast.Cursor) bool {
+		if table, ok := cursor.Node().(ast.TableName); ok {
+			addTable(table)
+			return false
+		}
+		return true
+	}, nil)
+	return tables
+}
+
+// Kinds of the sql tokens of the renamer
+const (
+	OTHER_TOKEN = iota
+	NAME_TOKEN
+	STRING_TOKEN
+	DOT_TOKEN
+)
+
+// Keywords which are followed by the name of the index, the constraint, the sequence or the schema
+var renamedNameKeywords = map[string]bool{"index": true, "constraint": true, "sequence": true, "schema": true}
+
+// Keywords between the keyword of the name and the name (CREATE INDEX IF NOT EXISTS name)
+var skippedNameKeywords = map[string]bool{"if": true, "not": true, "exists": true, "concurrently": true}
+
+// sqlToken is the token of the statement text
+type sqlToken struct {
+	kind  int
+	start int
+	end   int
+	value string // The name or the string without the quotes, the lower case text of the other token
+	quote byte   // The quote of the name or of the string, 0 if the name isn't quoted
+}
+
+// tokens splits the statement text into the tokens, the rest of the text isn't split
+// if the tokenizer fails
+func (renamer *TableRenamer) tokens(statementText string) []sqlToken {
+	tokenizer, err := sql_parser.NewStringTokenizer(statementText, renamer.sqlDialect)
+	if err != nil {
+		return nil
+	}
+	tokens := make([]sqlToken, 0)
+	for {
+		tokenizer.SkipBlank()
+		start := tokenizer.GetPos()
+		tokenID, value := tokenizer.Scan()
+		end := tokenizer.GetPos()
+		if tokenID == 0 || tokenID == ';' || end <= start || end > len(statementText) || tokenizer.GetLastError() != nil {
+			return tokens
+		}
+		token := sqlToken{kind: OTHER_TOKEN, start: start, end: end, value: strings.ToLower(statementText[start:end])}
+		switch first := statementText[start]; {
+		case first == '.' && end == start+1:
+			token.kind = DOT_TOKEN
+		case first == '`' || (first == '"' && renamer.sqlDialect != dialect.MYSQL):
+			token.kind, token.value, token.quote = NAME_TOKEN, value, first
+		case first == '\'' || first == '"':
+			token.kind, token.value, token.quote = STRING_TOKEN, value, first
+		case first == '_' || (first >= 'a' && first <= 'z') || (first >= 'A' && first <= 'Z'):
+			token.kind, token.value = NAME_TOKEN, statementText[start:end]
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// renameTokens renames the names of the statement text: the names qualified by the schema,
+// the unqualified tables of the statement, the names of indexes, constraints, sequences and
+// schemas after the keywords, the names of the string arguments of nextval, setval, currval
+// and of ::regclass casts and the schemas of the search_path
+func (renamer *TableRenamer) renameTokens(statementText string, tables map[string]bool) string {
+	tokens := renamer.tokens(statementText)
+	var renamed strings.Builder
+	position := 0
+	replace := func(token sqlToken, text string) {
+		renamed.WriteString(statementText[position:token.start])
+		renamed.WriteString(text)
+		position = token.end
+	}
+	searchPath := setSearchPath(tokens)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token.kind {
+		case NAME_TOKEN:
+			if searchPath {
+				if strings.EqualFold(token.value, "search_path") {
+					continue
+				}
+				if schema := renamer.mapSchema(token.value); schema != token.value {
+					replace(token, quoteToken(token, schema))
+				}
+				continue
+			}
+			// The chain of names: name, schema.name or schema.table.column
+			chain := []sqlToken{token}
+			for i+2 < len(tokens) && tokens[i+1].kind == DOT_TOKEN && tokens[i+2].kind == NAME_TOKEN {
+				chain = append(chain, tokens[i+2])
+				i += 2
+			}
+			keyword := previousKeyword(tokens, i-2*(len(chain)-1))
+			qualifier, name := "", chain[0].value
+			if len(chain) > 1 {
+				qualifier, name = chain[0].value, chain[1].value
+			}
+			var newQualifier, newName string
+			switch {
+			case keyword == "schema" && len(chain) == 1:
+				newName = renamer.mapSchema(name)
+			case renamedNameKeywords[keyword]:
+				newQualifier, newName = renamer.renameDerived(qualifier, name)
+			case len(chain) > 1 || tables[strings.ToLower(name)]:
+				newQualifier, newName = renamer.renameTable(qualifier, name)
+			default:
+				continue
+			}
+			if len(chain) == 1 {
+				if newQualifier != "" {
+					// The table is moved to the schema
+					replace(chain[0], quoteToken(chain[0], newQualifier)+"."+quoteToken(chain[0], newName))
+				} else if newName != name {
+					replace(chain[0], quoteToken(chain[0], newName))
+				}
+				continue
+			}
+			if newQualifier != qualifier {
+				replace(chain[0], quoteToken(chain[0], newQualifier))
+			}
+			if newName != name {
+				replace(chain[1], quoteToken(chain[1], newName))
+			}
+		case STRING_TOKEN:
+			var text string
+			switch {
+			case searchPath || stringArgument(tokens, i, "set_config", 1) && strings.EqualFold(tokens[i-2].value, "search_path"):
+				text = renamer.mapSearchPath(token.value)
+			case stringArgument(tokens, i, "", 0) || (i+1 < len(tokens) && tokens[i+1].value == "::regclass"):
+				text = renamer.renameSequence(token.value)
+			default:
+				continue
+			}
+			if text != token.value {
+				replace(token, string(token.quote)+strings.ReplaceAll(text, string(token.quote), strings.Repeat(string(token.quote), 2))+string(token.quote))
+			}
+		}
+	}
+	renamed.WriteString(statementText[position:])
+	return renamed.String()
+}
+
+// setSearchPath checks the statement is SET [SESSION | LOCAL] search_path
+func setSearchPath(tokens []sqlToken) bool {
+	if len(tokens) < 2 || !strings.EqualFold(tokens[0].value, "set") {
+		return false
+	}
+	name := strings.ToLower(tokens[1].value)
+	if (name == "session" || name == "local") && len(tokens) > 2 {
+		name = tokens[2].value
+	}
+	return strings.EqualFold(name, "search_path")
+}
+
+// previousKeyword returns the lower case name before the token (the keywords IF NOT EXISTS
+// and CONCURRENTLY are skipped), the result is empty if the previous token isn't the name
+func previousKeyword(tokens []sqlToken, i int) string {
+	for i--; i >= 0 && tokens[i].kind == NAME_TOKEN && tokens[i].quote == 0; i-- {
+		keyword := strings.ToLower(tokens[i].value)
+		if !skippedNameKeywords[keyword] {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// stringArgument checks the string token is the argument of the function by the position
+// (0 is the first argument), any of nextval, setval and currval if the function is empty
+func stringArgument(tokens []sqlToken, i int, function string, position int) bool {
+	i -= 2 * position
+	if i < 2 || tokens[i-1].value != "(" || tokens[i-2].kind != NAME_TOKEN {
+		return false
+	}
+	name := strings.ToLower(tokens[i-2].value)
+	if function == "" {
+		return renamedNameFunctions[name]
+	}
+	return name == function
+}
+
+// quoteToken quotes the new name by the quote of the name token
+func quoteToken(token sqlToken, name string) string {
+	if token.quote == 0 {
+		return name
+	}
+	return string(token.quote) + name + string(token.quote)
+}
@@ -0,0 +1,481 @@
+package dump_sampler
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// Sampler selects the part of the dump which satisfies the foreign keys. The rows of the root
+// table are selected by the ratio, the rows of the child tables (transitively) are kept if they
+// reference the kept rows and the rows of the parent tables are kept if the kept rows reference
+// them. The tables which aren't linked with the root table by the foreign keys are kept as is.
+//
+// The foreign keys are read from CREATE TABLE and ALTER TABLE ... ADD CONSTRAINT statements.
+// The dump is scanned for the keys of rows (Scan), the rows are selected (Select) and
+// the dump is read again to write the selected rows (Write).
+type Sampler struct {
+	sqlDialect  dialect.SqlDialect
+	ratio       float64
+	root        ast.TableName
+	random      *rand.Rand
+	tables      map[string]*sampledTable // Tables by the name qualified by the schema and by the name
+	order       []*sampledTable          // Tables in the order of the dump
+	foreignKeys []*foreignKey
+	late        bool // The keys of the table are defined after the rows of the table
+	parseErrors int
+}
+
+// NewSampler makes the sampler of the root table ('table' or 'schema.table'), the ratio is
+// the part of the root rows (0 < ratio <= 1), the same seed selects the same rows
+func NewSampler(sqlDialect dialect.SqlDialect, ratio float64, root string, seed int64) (*Sampler, error) {
+	if ratio <= 0 || ratio > 1 {
+		return nil, fmt.Errorf("ratio %v isn't in (0, 1]", ratio)
+	}
+	root = strings.TrimSpace(root)
+	if root == "" {
+		return nil, fmt.Errorf("root table isn't defined")
+	}
+	rootTable := ast.TableName{Name: ast.NewTableIdent(root)}
+	if qualifier, name, ok := strings.Cut(root, "."); ok {
+		rootTable = ast.TableName{Name: ast.NewTableIdent(name), Qualifier: ast.NewTableIdent(qualifier)}
+	}
+	return &Sampler{
+		sqlDialect:  sqlDialect,
+		ratio:       ratio,
+		root:        rootTable,
+		random:      rand.New(rand.NewSource(seed)),
+		tables:      make(map[string]*sampledTable),
+		order:       make([]*sampledTable, 0),
+		foreignKeys: make([]*foreignKey, 0),
+	}, nil
+}
+
+// lookup returns the table by the name qualified by the schema or by the name, the qualified
+// name and the name are returned as well
+func (sampler *Sampler) lookup(tableName ast.TableName) (*sampledTable, string, string) {
+	name := strings.ToLower(tableName.Name.String())
+	qualifiedName := name
+	if !tableName.Qualifier.IsEmpty() {
+		qualifiedName = strings.ToLower(tableName.Qualifier.String()) + "." + name
+	}
+	table, ok := sampler.tables[qualifiedName]
+	if !ok {
+		table = sampler.tables[name]
+	}
+	return table, qualifiedName, name
+}
+
+// table returns the table by the name, the table is added if it isn't found
+func (sampler *Sampler) table(tableName ast.TableName) *sampledTable {
+	table, qualifiedName, name := sampler.lookup(tableName)
+	if table == nil {
+		table = newSampledTable(ast.String(tableName))
+		sampler.order = append(sampler.order, table)
+		sampler.tables[name] = table
+	}
+	sampler.tables[qualifiedName] = table
+	return table
+}
+
+// Scan walks the archive entries and remembers the foreign keys and the keys of rows
+func (sampler *Sampler) Scan(reader *archive_stream.ArchiveStreamReader) error {
+	return walkEntries(reader, func(entry archive_stream.ArchiveEntry) error {
+		var scanErr error
+		err := sampler.readEntry(entry, &sampler.parseErrors,
+			func(statementText string, statement ast.Statement) {
+				if err := sampler.scanStatement(statement); err != nil && scanErr == nil {
+					scanErr = err
+				}
+			},
+			func(statementText string, copyFrom *ast.CopyFrom, data io.Reader) {
+				if err := sampler.scanCopyData(copyFrom, data); err != nil && scanErr == nil {
+					scanErr = err
+				}
+			})
+		if err == nil {
+			err = scanErr
+		}
+		return err
+	})
+}
+
+// Rescan returns true if the keys of the table are defined after the rows of the table
+// (pg_dump adds the constraints after the data), the rows are forgotten and the dump
+// must be scanned again
+func (sampler *Sampler) Rescan() bool {
+	if !sampler.late {
+		return false
+	}
+	for _, table := range sampler.order {
+		table.reset()
+	}
+	sampler.late = false
+	sampler.parseErrors = 0
+	return true
+}
+
+func (sampler *Sampler) scanStatement(statement ast.Statement) error {
+	switch node := statement.(type) {
+	case *ast.CreateTable:
+		if node.TableSpec == nil {
+			return nil
+		}
+		table := sampler.table(node.Table)
+		table.columns = make([]string, 0, len(node.TableSpec.Columns))
+		for _, column := range node.TableSpec.Columns {
+			table.columns = append(table.columns, column.Name.Lowered())
+			if column.Type.Options != nil && column.Type.Options.Reference != nil {
+				sampler.addForeignKey(table, ast.Columns{column.Name}, column.Type.Options.Reference)
+			}
+		}
+		for _, constraint := range node.TableSpec.Constraints {
+			if foreignKey, ok := constraint.Details.(*ast.ForeignKeyDefinition); ok {
+				sampler.addForeignKey(table, foreignKey.Source, foreignKey.ReferenceDefinition)
+			}
+		}
+	case *ast.AlterTable:
+		for _, option := range node.AlterOptions {
+			if addConstraint, ok := option.(*ast.AddConstraintDefinition); ok {
+				if foreignKey, ok := addConstraint.ConstraintDefinition.Details.(*ast.ForeignKeyDefinition); ok {
+					sampler.addForeignKey(sampler.table(node.Table), foreignKey.Source, foreignKey.ReferenceDefinition)
+				}
+			}
+		}
+	case *ast.Insert:
+		values, ok := node.Rows.(ast.Values)
+		if !ok {
+			return nil
+		}
+		table := sampler.table(node.Table)
+		positions, err := sampler.positions(table, node.Columns)
+		if err != nil {
+			return err
+		}
+		for _, tuple := range values {
+			table.addRow(func(column string) *sql_types.Value {
+				position, ok := positions[column]
+				if !ok || position >= len(tuple) {
+					return nil
+				}
+				value, ok := ast.ExprToValue(tuple[position])
+				if !ok {
+					value = sql_types.NewVarChar(ast.DialectString(tuple[position], sampler.sqlDialect))
+				}
+				return &value
+			})
+		}
+	}
+	return nil
+}
+
+func (sampler *Sampler) scanCopyData(copyFrom *ast.CopyFrom, data io.Reader) error {
+	table := sampler.table(copyFrom.Table)
+	positions, err := sampler.positions(table, copyFrom.Columns)
+	if err != nil {
+		return err
+	}
+	return sql_parser.ReadCopyLines(data, func(line string) error {
+		fields := sql_parser.SplitCopyTextLine(strings.TrimSuffix(line, "\n"))
+		table.addRow(func(column string) *sql_types.Value {
+			position, ok := positions[column]
+			if !ok || position >= len(fields) {
+				return nil
+			}
+			value := sql_types.NULL
+			if text, valid := sql_parser.DecodeCopyTextField(fields[position]); valid {
+				value = sql_types.NewVarChar(text)
+			}
+			return &value
+		})
+		return nil
+	})
+}
+
+// positions returns the positions of values by the column names, the columns are the column list
+// of the statement or the columns of CREATE TABLE statement
+func (sampler *Sampler) positions(table *sampledTable, columns ast.Columns) (map[string]int, error) {
+	positions := make(map[string]int)
+	if len(table.keys) == 0 {
+		return positions, nil
+	}
+	if len(columns) > 0 {
+		for i, column := range columns {
+			positions[column.Lowered()] = i
+		}
+		return positions, nil
+	}
+	if table.columns == nil {
+		return nil, fmt.Errorf("columns of table %v are unknown (CREATE TABLE statement isn't found), the foreign keys can't be checked", table.name)
+	}
+	for i, column := range table.columns {
+		positions[column] = i
+	}
+	return positions, nil
+}
+
+func (sampler *Sampler) addForeignKey(child *sampledTable, source ast.Columns, reference *ast.ReferenceDefinition) {
+	if reference == nil || len(source) == 0 || len(source) != len(reference.ReferencedColumns) {
+		return
+	}
+	parent := sampler.table(reference.ReferencedTable)
+	childKey, childAdded := child.key(lowerColumns(source))
+	parentKey, parentAdded := parent.key(lowerColumns(reference.ReferencedColumns))
+	if (childAdded && child.rows > 0) || (parentAdded && parent.rows > 0) {
+		sampler.late = true
+	}
+	for _, foreignKey := range sampler.foreignKeys {
+		if foreignKey.child == child && foreignKey.childKey == childKey && foreignKey.parent == parent && foreignKey.parentKey == parentKey {
+			return
+		}
+	}
+	sampler.foreignKeys = append(sampler.foreignKeys, &foreignKey{child: child, childKey: childKey, parent: parent, parentKey: parentKey})
+}
+
+// Select selects the rows of the root table by the ratio, the child rows of the kept rows
+// and the parent rows referenced by the kept rows
+func (sampler *Sampler) Select() error {
+	root, _, _ := sampler.lookup(sampler.root)
+	if root == nil {
+		return fmt.Errorf("root table %v isn't found in the dump", ast.String(sampler.root))
+	}
+	// The tables linked with the root table: the root table and the child tables (transitively),
+	// the parent tables of the foreign keys
+	children := map[*sampledTable]bool{root: true}
+	parents := make(map[*sampledTable]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, foreignKey := range sampler.foreignKeys {
+			parents[foreignKey.parent] = true
+			if children[foreignKey.parent] && !children[foreignKey.child] {
+				children[foreignKey.child] = true
+				changed = true
+			}
+		}
+	}
+
+	queue := make([]keptRow, 0)
+	for _, table := range sampler.order {
+		table.kept = make([]bool, table.rows)
+		table.position = 0
+		for row := range table.kept {
+			switch {
+			case table == root:
+				table.kept[row] = sampler.random.Float64() < sampler.ratio
+			case !children[table] && !parents[table]:
+				table.kept[row] = true
+			}
+			if table.kept[row] {
+				queue = append(queue, keptRow{table: table, row: row})
+			}
+		}
+	}
+
+	// The child rows of the kept rows of the root table and of the child tables
+	rootQueue := make([]keptRow, 0)
+	for _, kept := range queue {
+		if kept.table == root {
+			rootQueue = append(rootQueue, kept)
+		}
+	}
+	sampler.keep(rootQueue, children, func(foreignKey *foreignKey) (*sampledTable, int, *sampledTable, int) {
+		return foreignKey.parent, foreignKey.parentKey, foreignKey.child, foreignKey.childKey
+	})
+
+	// The parent rows of all kept rows
+	queue = queue[:0]
+	for _, table := range sampler.order {
+		for row, kept := range table.kept {
+			if kept {
+				queue = append(queue, keptRow{table: table, row: row})
+			}
+		}
+	}
+	sampler.keep(queue, nil, func(foreignKey *foreignKey) (*sampledTable, int, *sampledTable, int) {
+		return foreignKey.child, foreignKey.childKey, foreignKey.parent, foreignKey.parentKey
+	})
+	return nil
+}
+
+type keptRow struct {
+	table *sampledTable
+	row   int
+}
+
+// keep keeps the rows linked with the kept rows of the queue by the foreign keys, the link
+// returns the table and the key of the kept row and the table and the key of the linked rows.
+// The linked rows are kept in the selected tables (all tables if the selected tables are nil).
+func (sampler *Sampler) keep(queue []keptRow, selected map[*sampledTable]bool,
+	link func(foreignKey *foreignKey) (*sampledTable, int, *sampledTable, int)) {
+	for len(queue) > 0 {
+		kept := queue[0]
+		queue = queue[1:]
+		for _, foreignKey := range sampler.foreignKeys {
+			from, fromKey, to, toKey := link(foreignKey)
+			if from != kept.table || (selected != nil && !selected[to]) {
+				continue
+			}
+			key := from.rowKeys[kept.row][fromKey]
+			if key == "" {
+				continue
+			}
+			for _, row := range to.index(toKey)[key] {
+				if !to.kept[row] {
+					to.kept[row] = true
+					queue = append(queue, keptRow{table: to, row: row})
+				}
+			}
+		}
+	}
+}
+
+// Write reads the archive entries again and executes the statements on the connection
+// (see sql_connection.FileConnection), the rows which aren't selected are skipped
+func (sampler *Sampler) Write(reader *archive_stream.ArchiveStreamReader, connection sql_connection.SqlConnection) error {
+	return walkEntries(reader, func(entry archive_stream.ArchiveEntry) error {
+		var writeErr error
+		skipped := 0
+		err := sampler.readEntry(entry, &skipped,
+			func(statementText string, statement ast.Statement) {
+				if writeErr == nil {
+					writeErr = sampler.writeStatement(connection, statementText, statement)
+				}
+			},
+			func(statementText string, copyFrom *ast.CopyFrom, data io.Reader) {
+				if writeErr == nil {
+					table := sampler.table(copyFrom.Table)
+					writeErr = connection.CopyFrom(statementText, sql_parser.NewCopyLineReader(data, table.sampleLine))
+				}
+			})
+		if err == nil {
+			err = writeErr
+		}
+		return err
+	})
+}
+
+func (sampler *Sampler) writeStatement(connection sql_connection.SqlConnection, statementText string, statement ast.Statement) error {
+	insert, ok := statement.(*ast.Insert)
+	if !ok {
+		return connection.Execute(statementText)
+	}
+	values, ok := insert.Rows.(ast.Values)
+	if !ok {
+		return connection.Execute(statementText)
+	}
+	table := sampler.table(insert.Table)
+	selected := make(ast.Values, 0, len(values))
+	for _, tuple := range values {
+		if table.position < len(table.kept) && table.kept[table.position] {
+			selected = append(selected, tuple)
+		}
+		table.position++
+	}
+	switch len(selected) {
+	case 0:
+		return nil
+	case len(values):
+		return connection.Execute(statementText)
+	}
+	sampled := ast.CloneRefOfInsert(insert)
+	sampled.Rows = selected
+	return connection.Execute(ast.DialectString(sampled, sampler.sqlDialect))
+}
+
+// readEntry reads the statements of the entry, INSERT and COPY statements which aren't parsed
+// are counted by the parse errors and skipped (the rows can't be checked)
+func (sampler *Sampler) readEntry(entry archive_stream.ArchiveEntry, parseErrors *int,
+	onStatement func(statementText string, statement ast.Statement),
+	onCopyData func(statementText string, copyFrom *ast.CopyFrom, data io.Reader)) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("unable to open entry %s (%v)", entry.GetName(), err)
+	}
+	defer rc.Close()
+
+	err = sql_parser.StatementStreamWithCopy(rc, sampler.sqlDialect,
+		func(statementText string, statement ast.Statement, parseError error) {
+			if parseError != nil {
+				if sql_connection.DetectStatementType(statementText, nil) == ast.StmtInsert {
+					*parseErrors++
+					return
+				}
+				statement = nil
+			}
+			onStatement(statementText, statement)
+		},
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			copyFrom, ok := statement.(*ast.CopyFrom)
+			if parseError != nil || !ok {
+				*parseErrors++
+				return
+			}
+			onCopyData(statementText, copyFrom, data)
+		})
+	if err != nil {
+		return fmt.Errorf("process entry %s fail (%v)", entry.GetName(), err)
+	}
+	return nil
+}
+
+// Tables returns the tables with rows in the order of the dump
+func (sampler *Sampler) Tables() []string {
+	tables := make([]string, 0, len(sampler.order))
+	for _, table := range sampler.order {
+		if table.rows > 0 {
+			tables = append(tables, table.name)
+		}
+	}
+	return tables
+}
+
+// Rows returns the count of rows and the count of selected rows of the table
+func (sampler *Sampler) Rows(name string) (int, int) {
+	for _, table := range sampler.order {
+		if table.name == name {
+			return table.rows, table.keptRows()
+		}
+	}
+	return 0, 0
+}
+
+// ParseErrors returns the count of INSERT and COPY statements which aren't parsed,
+// the statements are skipped
+func (sampler *Sampler) ParseErrors() int {
+	return sampler.parseErrors
+}
+
+// walkEntries calls the function for every file entry of the archive
+func walkEntries(reader *archive_stream.ArchiveStreamReader, onEntry func(entry archive_stream.ArchiveEntry) error) error {
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to get next entry (%v)", err)
+		}
+		if entry.IsDir() {
+			continue
+		}
+		if err := onEntry(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func lowerColumns(columns ast.Columns) []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Lowered())
+	}
+	return names
+}
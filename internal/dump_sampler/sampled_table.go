@@ -0,0 +1,121 @@
+package dump_sampler
+
+import (
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_types"
+)
+
+// sampledTable keeps the keys of the table rows: the values of columns of foreign keys and
+// of the referenced columns. The rows are identified by the order in the dump.
+type sampledTable struct {
+	name     string
+	columns  []string                 // Columns (lower case) of CREATE TABLE statement, nil if unknown
+	keys     [][]string               // Column sets of the keys
+	rows     int                      // Count of the rows
+	rowKeys  [][]string               // Keys of the rows by the column sets, empty if the table hasn't keys
+	kept     []bool                   // Selected rows
+	indexes  map[int]map[string][]int // Rows by the key of the column set
+	position int                      // Position of the written row
+}
+
+func newSampledTable(name string) *sampledTable {
+	return &sampledTable{name: name}
+}
+
+// key returns the index of the column set, the column set is added if it isn't found
+func (table *sampledTable) key(columns []string) (int, bool) {
+	for i, key := range table.keys {
+		if strings.Join(key, ",") == strings.Join(columns, ",") {
+			return i, false
+		}
+	}
+	table.keys = append(table.keys, columns)
+	return len(table.keys) - 1, true
+}
+
+// addRow remembers the keys of the row, the value of the column is returned by the column name
+// (nil if the column doesn't have the value)
+func (table *sampledTable) addRow(value func(column string) *sql_types.Value) {
+	table.rows++
+	if len(table.keys) == 0 {
+		return
+	}
+	keys := make([]string, len(table.keys))
+	for i, columns := range table.keys {
+		keys[i] = rowKey(columns, value)
+	}
+	table.rowKeys = append(table.rowKeys, keys)
+}
+
+// index returns the rows by the key of the column set
+func (table *sampledTable) index(key int) map[string][]int {
+	if table.indexes == nil {
+		table.indexes = make(map[int]map[string][]int)
+	}
+	index, ok := table.indexes[key]
+	if !ok {
+		index = make(map[string][]int)
+		for row, keys := range table.rowKeys {
+			if keys[key] != "" {
+				index[keys[key]] = append(index[keys[key]], row)
+			}
+		}
+		table.indexes[key] = index
+	}
+	return index
+}
+
+// reset forgets the rows of the table
+func (table *sampledTable) reset() {
+	table.rows = 0
+	table.rowKeys = nil
+	table.kept = nil
+	table.indexes = nil
+	table.position = 0
+}
+
+// keptRows returns the count of selected rows
+func (table *sampledTable) keptRows() int {
+	count := 0
+	for _, kept := range table.kept {
+		if kept {
+			count++
+		}
+	}
+	return count
+}
+
+// sampleLine returns the line of COPY data if the row is selected, the empty line otherwise
+func (table *sampledTable) sampleLine(line string) (string, error) {
+	kept := table.position < len(table.kept) && table.kept[table.position]
+	table.position++
+	if !kept {
+		return "", nil
+	}
+	return line, nil
+}
+
+// rowKey joins the values of the columns, the key is empty if any value is NULL
+// (the foreign key with NULL doesn't reference the row)
+func rowKey(columns []string, value func(column string) *sql_types.Value) string {
+	var key strings.Builder
+	for _, column := range columns {
+		columnValue := value(column)
+		if columnValue == nil || columnValue.IsNull() {
+			return ""
+		}
+		key.WriteByte('v')
+		key.WriteString(columnValue.RawStr())
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// foreignKey links the columns of the child table to the referenced columns of the parent table
+type foreignKey struct {
+	child     *sampledTable
+	childKey  int
+	parent    *sampledTable
+	parentKey int
+}
@@ -0,0 +1,137 @@
+package load_checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+const (
+	// Size of the beginning and the end of the file which are used for the fingerprint
+	FINGERPRINT_SAMPLE_SIZE = 1024 * 1024
+	// The pg_dump -Fd directory is fingerprinted by the table of contents
+	PG_DUMP_DIRECTORY_TOC = "toc.dat"
+)
+
+// Checkpoint is the position of the last committed statement of the load
+type Checkpoint struct {
+	File        string    `json:"file"`
+	Fingerprint string    `json:"fingerprint"` // Fingerprint of the file, see Fingerprint
+	EntryIndex  int       `json:"entryIndex"`  // Index of the archive entry (the directories aren't counted)
+	Entry       string    `json:"entry"`
+	Offset      int64     `json:"offset"`    // Byte offset of the statement end in the decompressed entry
+	Statement   int64     `json:"statement"` // Count of processed statements of the entry
+	Updated     time.Time `json:"updated"`
+}
+
+// Load reads the checkpoint file, nil is returned if the file doesn't exist
+func Load(fileName string) (*Checkpoint, error) {
+	content, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %v is broken (%v)", fileName, err)
+	}
+	return checkpoint, nil
+}
+
+// Save writes the checkpoint file, the file is replaced atomically
+func (checkpoint *Checkpoint) Save(fileName string) error {
+	checkpoint.Updated = time.Now()
+	content, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(content)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
+
+// Fingerprint returns the hash of the size, the beginning and the end of the file,
+// the whole file isn't read because the dump can be very large. The directory
+// of pg_dump -Fd is fingerprinted by its table of contents.
+func Fingerprint(fileName string) (string, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return Fingerprint(filepath.Join(fileName, PG_DUMP_DIRECTORY_TOC))
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	binary.Write(hash, binary.BigEndian, info.Size())
+	if _, err := io.CopyN(hash, file, FINGERPRINT_SAMPLE_SIZE); err != nil && err != io.EOF {
+		return "", err
+	}
+	if info.Size() > FINGERPRINT_SAMPLE_SIZE {
+		tailOffset := max(info.Size()-FINGERPRINT_SAMPLE_SIZE, FINGERPRINT_SAMPLE_SIZE)
+		if _, err := io.Copy(hash, io.NewSectionReader(file, tailOffset, info.Size()-tailOffset)); err != nil {
+			return "", err
+		}
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SkipStatements reads the statements of the entry up to the offset of the checkpoint, the session
+// statements (see dump_rewriter.IsSessionStatement) are passed to the processor to restore the session
+// of the skipped part on the resume. CREATE TABLE statements are passed too, the columns of the tables
+// are used by the later statements (INSERT without the columns). The other statements and the data
+// of COPY are discarded.
+func SkipStatements(reader io.Reader, sqlDialect dialect.SqlDialect, offset int64, processor sql_parser.StatementProcessor) error {
+	prefix := &io.LimitedReader{R: reader, N: offset}
+	err := sql_parser.StatementStreamWithCopy(prefix, sqlDialect,
+		func(statementText string, statement ast.Statement, parseError error) {
+			if _, ok := statement.(*ast.CreateTable); ok || dump_rewriter.IsSessionStatement(statementText, statement) {
+				processor(statementText, statement, parseError)
+			}
+		},
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			// The data is skipped by the statement stream
+		})
+	if err != nil {
+		return err
+	}
+	if prefix.N > 0 {
+		return fmt.Errorf("entry is shorter than the offset %v (%v bytes are missing)", offset, prefix.N)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package load_jobs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+)
+
+const (
+	// Count of tasks in the queue of the job
+	JOB_QUEUE_SIZE = 64
+	// The COPY data over this size is spooled to the temporary file
+	COPY_DATA_MEMORY_SIZE = 4 * 1024 * 1024
+)
+
+// LoadJobs executes the schema statements serially on the main connection and
+// routes the data statements (INSERT and COPY) by the table to the parallel jobs.
+// The statements of the same table are executed by the same job in order.
+// The statement which references the tables waits for the data of these tables.
+type LoadJobs struct {
+	connection   sql_connection.SqlConnection          // The main connection
+	errorHandler func(statementText string, err error) // Receives the errors of the statements executed by the jobs
+	workers      []*loadWorker
+	mutex        sync.Mutex
+	done         *sync.Cond
+	pending      map[string]int // Count of pending tasks by the table
+	pendingTotal int
+	waitGroup    sync.WaitGroup
+}
+
+type loadWorker struct {
+	connection sql_connection.SqlConnection
+	tasks      chan loadTask
+}
+
+type loadTask struct {
+	table string // The table of the data statement, empty for the other tasks
+	run   func(connection sql_connection.SqlConnection)
+}
+
+// NewLoadJobs makes count jobs with the connections made by connect, the errors of the session
+// statements and of the commits of jobs are passed to the errorHandler
+func NewLoadJobs(connection sql_connection.SqlConnection, count int, connect func() (sql_connection.SqlConnection, error), errorHandler func(statementText string, err error)) (*LoadJobs, error) {
+	jobs := &LoadJobs{
+		connection:   connection,
+		errorHandler: errorHandler,
+		workers:      make([]*loadWorker, 0, count),
+		pending:      make(map[string]int),
+	}
+	jobs.done = sync.NewCond(&jobs.mutex)
+	for range count {
+		connection, err := connect()
+		if err != nil {
+			return nil, errors.Join(err, jobs.Close())
+		}
+		worker := &loadWorker{
+			connection: connection,
+			tasks:      make(chan loadTask, JOB_QUEUE_SIZE),
+		}
+		jobs.workers = append(jobs.workers, worker)
+		jobs.waitGroup.Add(1)
+		go jobs.work(worker)
+	}
+	return jobs, nil
+}
+
+func (jobs *LoadJobs) work(worker *loadWorker) {
+	defer jobs.waitGroup.Done()
+	for task := range worker.tasks {
+		task.run(worker.connection)
+
+		jobs.mutex.Lock()
+		jobs.pendingTotal--
+		if task.table != "" {
+			jobs.pending[task.table]--
+			if jobs.pending[task.table] == 0 {
+				delete(jobs.pending, task.table)
+			}
+		}
+		jobs.done.Broadcast()
+		jobs.mutex.Unlock()
+	}
+}
+
+func (jobs *LoadJobs) enqueue(worker *loadWorker, task loadTask) {
+	jobs.mutex.Lock()
+	jobs.pendingTotal++
+	if task.table != "" {
+		jobs.pending[task.table]++
+	}
+	jobs.mutex.Unlock()
+	worker.tasks <- task
+}
+
+// workerOf returns the job of the table
+func (jobs *LoadJobs) workerOf(table string) *loadWorker {
+	hash := fnv.New32a()
+	hash.Write([]byte(table))
+	return jobs.workers[hash.Sum32()%uint32(len(jobs.workers))]
+}
+
+// Execute routes the data statement to the job of the table, the other statements
+// are executed on the main connection after the data of referenced tables
+func (jobs *LoadJobs) Execute(statementText string, statement ast.Statement, run func(connection sql_connection.SqlConnection)) {
+	if table := dataStatementTable(statement); table != "" {
+		// The schema of the table should be visible for the job connection
+		jobs.flush(jobs.connection)
+		jobs.enqueue(jobs.workerOf(table), loadTask{table: table, run: run})
+		return
+	}
+
+	switch sql_connection.DetectStatementType(statementText, statement) {
+	case ast.StmtBegin, ast.StmtCommit, ast.StmtRollback, ast.StmtLockTables, ast.StmtUnlockTables:
+		// The transactions and locks of the dump don't work across the connections
+		return
+	}
+	if dump_rewriter.IsSessionStatement(statementText, statement) {
+		run(jobs.connection)
+		for _, worker := range jobs.workers {
+			jobs.enqueue(worker, loadTask{run: func(connection sql_connection.SqlConnection) {
+				if err := connection.Execute(statementText); err != nil {
+					jobs.errorHandler(statementText, err)
+				}
+			}})
+		}
+		return
+	}
+
+	if statement == nil {
+		// The tables of the statement are unknown
+		jobs.WaitAll()
+	} else {
+		jobs.waitTables(referencedTables(statement))
+	}
+	run(jobs.connection)
+}
+
+// CopyFrom routes the COPY ... FROM stdin statement to the job of the table,
+// the data is spooled (in the memory or in the temporary file) for the job
+func (jobs *LoadJobs) CopyFrom(statementText string, statement ast.Statement, data io.Reader, run func(connection sql_connection.SqlConnection, data io.Reader)) error {
+	table := dataStatementTable(statement)
+	if table == "" {
+		jobs.WaitAll()
+		run(jobs.connection, data)
+		return nil
+	}
+
+	spooledData, err := SpoolCopyData(data)
+	if err != nil {
+		return fmt.Errorf("spool COPY data fail: %w", err)
+	}
+	jobs.flush(jobs.connection)
+	jobs.enqueue(jobs.workerOf(table), loadTask{table: table, run: func(connection sql_connection.SqlConnection) {
+		defer spooledData.Close()
+		run(connection, spooledData)
+	}})
+	return nil
+}
+
+// waitTables waits until the data of tables is loaded and committed
+func (jobs *LoadJobs) waitTables(tables []string) {
+	for _, table := range tables {
+		jobs.enqueue(jobs.workerOf(table), loadTask{table: table, run: jobs.flush})
+	}
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	for _, table := range tables {
+		for jobs.pending[table] > 0 {
+			jobs.done.Wait()
+		}
+	}
+}
+
+// WaitAll waits until all tasks are done and committed
+func (jobs *LoadJobs) WaitAll() {
+	for _, worker := range jobs.workers {
+		jobs.enqueue(worker, loadTask{run: jobs.flush})
+	}
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	for jobs.pendingTotal > 0 {
+		jobs.done.Wait()
+	}
+}
+
+// flush commits the batch of the connection
+func (jobs *LoadJobs) flush(connection sql_connection.SqlConnection) {
+	if batchConnection, ok := connection.(*sql_connection.BatchConnection); ok {
+		if err := batchConnection.Flush(); err != nil {
+			jobs.errorHandler("COMMIT", err)
+		}
+	}
+}
+
+// Close waits for all tasks and closes the connections of jobs
+func (jobs *LoadJobs) Close() error {
+	var errs []error
+	for _, worker := range jobs.workers {
+		close(worker.tasks)
+	}
+	jobs.waitGroup.Wait()
+	for _, worker := range jobs.workers {
+		errs = append(errs, worker.connection.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// dataStatementTable returns the table of INSERT ... VALUES or COPY statement,
+// the empty string is returned for the other statements
+func dataStatementTable(statement ast.Statement) string {
+	switch node := statement.(type) {
+	case *ast.Insert:
+		if _, ok := node.Rows.(ast.Values); ok {
+			return tableKey(node.Table)
+		}
+	case *ast.CopyFrom:
+		return tableKey(node.Table)
+	}
+	return ""
+}
+
+// referencedTables returns all tables of the statement
+func referencedTables(statement ast.Statement) []string {
+	tables := make([]string, 0)
+	ast.Walk(func(node ast.SQLNode) (bool, error) {
+		if tableName, ok := node.(ast.TableName); ok {
+			if table := tableKey(tableName); table != "" && table != "dual" {
+				tables = append(tables, table)
+			}
+		}
+		return true, nil
+	}, statement)
+	return tables
+}
+
+// tableKey is the name of table without the schema, the tables with
+// the same name in different schemas are loaded by the same job
+func tableKey(tableName ast.TableName) string {
+	return strings.ToLower(tableName.Name.String())
+}
+
+// spooledFile is the temporary file of COPY data, the file is removed on close
+type spooledFile struct {
+	*os.File
+}
+
+func (file spooledFile) Close() error {
+	return errors.Join(file.File.Close(), os.Remove(file.Name()))
+}
+
+// SpoolCopyData reads the COPY data to the memory or to the temporary file if the data is large
+func SpoolCopyData(data io.Reader) (io.ReadCloser, error) {
+	var buffer bytes.Buffer
+	// The byte over the size is read to check the end of data
+	_, err := io.CopyN(&buffer, data, COPY_DATA_MEMORY_SIZE+1)
+	if err == io.EOF {
+		return io.NopCloser(&buffer), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "prodl-copy-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := spooledFile{file}
+	if _, err := io.Copy(file, io.MultiReader(&buffer, data)); err != nil {
+		return nil, errors.Join(err, spooled.Close())
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Join(err, spooled.Close())
+	}
+	return spooled, nil
+}
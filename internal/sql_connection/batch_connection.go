@@ -0,0 +1,241 @@
+package sql_connection
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+)
+
+var (
+	// Fallback for the transaction statements which the parser doesn't recognize (sqlite3 dumps)
+	beginTransactionRegexp    = regexp.MustCompile(`(?i)^(begin|start)(\s+(deferred|immediate|exclusive))?(\s+(transaction|work))?$`)
+	commitTransactionRegexp   = regexp.MustCompile(`(?i)^(commit|end)(\s+(transaction|work))?$`)
+	rollbackTransactionRegexp = regexp.MustCompile(`(?i)^rollback(\s+(transaction|work))?$`)
+	// The pg statements which can't be executed in the transaction block
+	nonTransactionalRegexp = regexp.MustCompile(`(?is)^(vacuum|cluster|checkpoint|reindex)\b|^refresh\s+materialized\s+view\s+concurrently\b`)
+)
+
+// StatementExecutor is implemented by the connections which use the parsed statement
+// for the execution
+type StatementExecutor interface {
+	ExecuteStatement(rawSql string, statement ast.Statement) error
+}
+
+// ExecuteStatement executes the parsed statement (the statement is nil if it wasn't parsed)
+func ExecuteStatement(connection SqlConnection, rawSql string, statement ast.Statement) error {
+	if executor, ok := connection.(StatementExecutor); ok {
+		return executor.ExecuteStatement(rawSql, statement)
+	}
+	return connection.Execute(rawSql)
+}
+
+// BatchConnection wraps every batchSize statements (or batchBytes of statements text)
+// into the one transaction. The batch is committed before the transaction of the dump
+// (BEGIN ... COMMIT), before the COPY statement and before the DDL statements and the pg
+// statements which can't be executed in the transaction block (VACUUM, CREATE INDEX
+// CONCURRENTLY etc.), these statements are executed as is. The DDL statements are executed
+// outside of the batch because mysql commits them implicitly, they can't be rolled back.
+// If the statement of the batch fails, the batch is rolled back and the statements
+// before the failed one are executed again in the new batch.
+type BatchConnection struct {
+	connection      SqlConnection
+	batchSize       int
+	batchBytes      int
+	batch           []string // Executed statements of the current batch
+	batchTextSize   int
+	dumpTransaction bool   // The transaction of the dump is in progress
+	commitHandler   func() // Called after the executed statements are committed
+}
+
+// NewBatchConnection makes the connection which executes the statements in batches,
+// zero batchSize or batchBytes means no limit
+func NewBatchConnection(connection SqlConnection, batchSize int, batchBytes int) *BatchConnection {
+	return &BatchConnection{
+		connection: connection,
+		batchSize:  batchSize,
+		batchBytes: batchBytes,
+	}
+}
+
+// SetCommitHandler sets the handler which is called after the executed statements are committed:
+// the batch, the transaction of the dump or the COPY statement outside of the transaction
+func (batchConnection *BatchConnection) SetCommitHandler(handler func()) {
+	batchConnection.commitHandler = handler
+}
+
+// Establish implements SqlConnection.
+func (batchConnection *BatchConnection) Establish(connectionOptions string) error {
+	return batchConnection.connection.Establish(connectionOptions)
+}
+
+// Execute implements SqlConnection.
+func (batchConnection *BatchConnection) Execute(rawSql string) error {
+	return batchConnection.ExecuteStatement(rawSql, nil)
+}
+
+// ExecuteStatement implements StatementExecutor.
+func (batchConnection *BatchConnection) ExecuteStatement(rawSql string, statement ast.Statement) error {
+	switch DetectStatementType(rawSql, statement) {
+	case ast.StmtBegin:
+		if err := batchConnection.Flush(); err != nil {
+			return err
+		}
+		batchConnection.dumpTransaction = true
+		return batchConnection.connection.Begin()
+	case ast.StmtCommit:
+		if !batchConnection.dumpTransaction {
+			return batchConnection.Flush()
+		}
+		batchConnection.dumpTransaction = false
+		return batchConnection.committed(batchConnection.connection.Commit())
+	case ast.StmtRollback:
+		if !batchConnection.dumpTransaction {
+			return batchConnection.Flush()
+		}
+		batchConnection.dumpTransaction = false
+		return batchConnection.committed(batchConnection.connection.Rollback())
+	}
+	if batchConnection.dumpTransaction {
+		return batchConnection.connection.Execute(rawSql)
+	}
+	if isNonBatchStatement(rawSql, statement) {
+		if err := batchConnection.Flush(); err != nil {
+			return err
+		}
+		return batchConnection.committed(batchConnection.connection.Execute(rawSql))
+	}
+
+	if batchConnection.batch == nil {
+		if err := batchConnection.connection.Begin(); err != nil {
+			return err
+		}
+		batchConnection.batch = make([]string, 0, batchConnection.batchSize)
+	}
+	if err := batchConnection.connection.Execute(rawSql); err != nil {
+		if restoreErr := batchConnection.restore(); restoreErr != nil {
+			return fmt.Errorf("%w (restore batch fail: %v)", err, restoreErr)
+		}
+		return err
+	}
+	batchConnection.batch = append(batchConnection.batch, rawSql)
+	batchConnection.batchTextSize += len(rawSql)
+	if (batchConnection.batchSize > 0 && len(batchConnection.batch) >= batchConnection.batchSize) ||
+		(batchConnection.batchBytes > 0 && batchConnection.batchTextSize >= batchConnection.batchBytes) {
+		return batchConnection.Flush()
+	}
+	return nil
+}
+
+// CopyFrom implements SqlConnection.
+// The data of COPY isn't kept for the restore of batch, so the COPY is executed outside of the batch.
+func (batchConnection *BatchConnection) CopyFrom(rawSql string, data io.Reader) error {
+	if err := batchConnection.Flush(); err != nil {
+		return err
+	}
+	if batchConnection.dumpTransaction {
+		return batchConnection.connection.CopyFrom(rawSql, data)
+	}
+	return batchConnection.committed(batchConnection.connection.CopyFrom(rawSql, data))
+}
+
+// Begin implements SqlConnection.
+func (batchConnection *BatchConnection) Begin() error {
+	return batchConnection.ExecuteStatement("BEGIN", &ast.Begin{})
+}
+
+// Commit implements SqlConnection.
+func (batchConnection *BatchConnection) Commit() error {
+	return batchConnection.ExecuteStatement("COMMIT", &ast.Commit{})
+}
+
+// Rollback implements SqlConnection.
+func (batchConnection *BatchConnection) Rollback() error {
+	return batchConnection.ExecuteStatement("ROLLBACK", &ast.Rollback{})
+}
+
+// Close implements SqlConnection.
+func (batchConnection *BatchConnection) Close() error {
+	flushErr := batchConnection.Flush()
+	if err := batchConnection.connection.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// Flush commits the current batch
+func (batchConnection *BatchConnection) Flush() error {
+	if batchConnection.batch == nil {
+		return nil
+	}
+	batchConnection.batch = nil
+	batchConnection.batchTextSize = 0
+	return batchConnection.committed(batchConnection.connection.Commit())
+}
+
+// committed calls the commit handler if the commit (the end of transaction) succeeds
+func (batchConnection *BatchConnection) committed(err error) error {
+	if err == nil && batchConnection.commitHandler != nil {
+		batchConnection.commitHandler()
+	}
+	return err
+}
+
+// restore rolls back the current batch and executes the statements of the batch again
+func (batchConnection *BatchConnection) restore() error {
+	statements := batchConnection.batch
+	batchConnection.batch = nil
+	batchConnection.batchTextSize = 0
+	if err := batchConnection.connection.Rollback(); err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	if err := batchConnection.connection.Begin(); err != nil {
+		return err
+	}
+	batchConnection.batch = make([]string, 0, batchConnection.batchSize)
+	for _, rawSql := range statements {
+		if err := batchConnection.connection.Execute(rawSql); err != nil {
+			batchConnection.batch = nil
+			batchConnection.connection.Rollback()
+			return err
+		}
+		batchConnection.batch = append(batchConnection.batch, rawSql)
+		batchConnection.batchTextSize += len(rawSql)
+	}
+	return nil
+}
+
+// isNonBatchStatement checks the statement is executed outside of the batch: the DDL statement
+// or the pg statement which can't be executed in the transaction block
+func isNonBatchStatement(rawSql string, statement ast.Statement) bool {
+	if DetectStatementType(rawSql, statement) == ast.StmtDDL {
+		return true
+	}
+	sql, _ := ast.SplitMarginComments(ast.StripLeadingComments(rawSql))
+	return nonTransactionalRegexp.MatchString(strings.TrimSpace(sql))
+}
+
+// DetectStatementType returns the type of statement, the statement is nil if it wasn't parsed.
+// The transaction statements are recognized by the text if the statement wasn't parsed.
+func DetectStatementType(rawSql string, statement ast.Statement) ast.StatementType {
+	if statement != nil {
+		return ast.ASTToStatementType(statement)
+	}
+	sql, _ := ast.SplitMarginComments(ast.StripLeadingComments(rawSql))
+	sql = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	switch {
+	case beginTransactionRegexp.MatchString(sql):
+		return ast.StmtBegin
+	case commitTransactionRegexp.MatchString(sql):
+		return ast.StmtCommit
+	case rollbackTransactionRegexp.MatchString(sql):
+		return ast.StmtRollback
+	}
+	return ast.Preview(sql)
+}
@@ -0,0 +1,148 @@
+package sql_connection
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+)
+
+const (
+	FILE_DRIVER_ID      = "file" // Driver of the FileConnection
+	FILE_BUFFER_SIZE    = 1024 * 1024
+	GZIP_FILE_EXTENSION = ".gz"
+	ZSTD_FILE_EXTENSION = ".zst"
+)
+
+// FileConnection writes the statements to the sql file instead of the execution, every statement
+// is followed by ";\n". The data of COPY ... FROM stdin statements is written as is followed by
+// the end data mark "\.". The file is compressed by gzip (.gz) or zstd (.zst) by the extension.
+type FileConnection struct {
+	file       *os.File
+	compressor io.WriteCloser // nil if the file isn't compressed
+	writer     *bufio.Writer
+}
+
+// Establish implements SqlConnection, the connection options is the file name.
+// The file is created or truncated.
+func (fileConnection *FileConnection) Establish(connectionOptions string) error {
+	file, err := os.Create(connectionOptions)
+	if err != nil {
+		return err
+	}
+	var output io.Writer = file
+	switch {
+	case strings.HasSuffix(connectionOptions, GZIP_FILE_EXTENSION):
+		fileConnection.compressor = gzip.NewWriter(file)
+		output = fileConnection.compressor
+	case strings.HasSuffix(connectionOptions, ZSTD_FILE_EXTENSION):
+		encoder, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		fileConnection.compressor = encoder
+		output = encoder
+	}
+	fileConnection.file = file
+	fileConnection.writer = bufio.NewWriterSize(output, FILE_BUFFER_SIZE)
+	return nil
+}
+
+// Execute implements SqlConnection.
+func (fileConnection *FileConnection) Execute(rawSql string) error {
+	if fileConnection.writer == nil {
+		return errors.New("file isn't opened")
+	}
+	statement := strings.TrimRight(rawSql, " \t\r\n")
+	// COPY FROM STDIN command with the data inside the statement (see PgConnection.Execute)
+	if strings.HasSuffix(statement, "\\.") && DetectStatementType(statement, nil) == ast.StmtCopy {
+		_, err := fileConnection.writer.WriteString(statement + "\n")
+		return err
+	}
+	statement = strings.TrimRight(statement, "; \t\r\n")
+	if statement == "" {
+		return nil
+	}
+	// The semicolon after the comment of the last line is commented out
+	terminator := ";\n"
+	if strings.Contains(statement[strings.LastIndexByte(statement, '\n')+1:], "--") {
+		terminator = "\n;\n"
+	}
+	_, err := fileConnection.writer.WriteString(statement + terminator)
+	return err
+}
+
+// CopyFrom implements SqlConnection, the data is written byte-for-byte.
+func (fileConnection *FileConnection) CopyFrom(rawSql string, data io.Reader) error {
+	if err := fileConnection.Execute(rawSql); err != nil {
+		return err
+	}
+	output := &lastByteWriter{writer: fileConnection.writer}
+	if _, err := io.Copy(output, data); err != nil {
+		return err
+	}
+	if output.size > 0 && output.lastByte != '\n' {
+		// The last line of the data isn't terminated
+		if err := fileConnection.writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	_, err := fileConnection.writer.WriteString("\\.\n")
+	return err
+}
+
+// Begin implements SqlConnection.
+func (fileConnection *FileConnection) Begin() error {
+	return fileConnection.Execute("BEGIN")
+}
+
+// Commit implements SqlConnection.
+func (fileConnection *FileConnection) Commit() error {
+	return fileConnection.Execute("COMMIT")
+}
+
+// Rollback implements SqlConnection.
+func (fileConnection *FileConnection) Rollback() error {
+	return fileConnection.Execute("ROLLBACK")
+}
+
+// Close implements SqlConnection, the buffered statements are flushed to the file.
+func (fileConnection *FileConnection) Close() error {
+	if fileConnection.file == nil {
+		return nil
+	}
+	err := fileConnection.writer.Flush()
+	if fileConnection.compressor != nil {
+		if closeErr := fileConnection.compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := fileConnection.file.Close(); err == nil {
+		err = closeErr
+	}
+	fileConnection.file = nil
+	fileConnection.writer = nil
+	return err
+}
+
+// lastByteWriter remembers the last written byte
+type lastByteWriter struct {
+	writer   io.Writer
+	size     int64
+	lastByte byte
+}
+
+func (writer *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := writer.writer.Write(p)
+	if n > 0 {
+		writer.size += int64(n)
+		writer.lastByte = p[n-1]
+	}
+	return n, err
+}
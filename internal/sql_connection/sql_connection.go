@@ -3,24 +3,55 @@ package sql_connection
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
 	"github.com/usalko/prodl/internal/sql_parser/dialect"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const (
+	PG_CONNECT_TIMEOUT   = 30 * time.Second
+	PG_STATEMENT_TIMEOUT = 120 * time.Second
+
+	NULL_DRIVER_ID = "null" // Driver of the NopConnection
+)
+
+var (
+	ErrNoTransaction         = errors.New("there is no transaction in progress")
+	ErrTransactionInProgress = errors.New("there is already a transaction in progress")
+	ErrTransactionLost       = errors.New("the connection is lost in the transaction")
+
+	// The session setting of pg_dump: SELECT pg_catalog.set_config('search_path', '', false),
+	// the setting is local for the transaction if the last argument is true
+	setConfigRegexp = regexp.MustCompile(`(?is)^select\s+(pg_catalog\s*\.\s*)?set_config\s*\(\s*'([^']+)'\s*,.*,\s*false\s*\)\s*;?$`)
+)
+
 type SqlConnection interface {
 	Establish(connectionOptions string) error
 	Execute(rawSql string) error
+	// CopyFrom executes the COPY ... FROM stdin statement with the data from reader
+	CopyFrom(rawSql string, data io.Reader) error
+	// Begin starts the transaction, the statements are executed in the transaction
+	// up to the Commit or Rollback
+	Begin() error
+	Commit() error
+	Rollback() error
+	Close() error
 }
 
 type MysqlConnection struct {
 	db *sql.DB
+	tx *sql.Tx
 }
 
 // Establish implements SqlConnection.
@@ -35,12 +66,63 @@ func (mysqlConnection *MysqlConnection) Establish(connectionOptions string) erro
 
 // Execute implements SqlConnection.
 func (mysqlConnection *MysqlConnection) Execute(rawSql string) error {
+	if mysqlConnection.tx != nil {
+		_, err := mysqlConnection.tx.Exec(rawSql)
+		return err
+	}
 	_, err := mysqlConnection.db.Exec(rawSql)
 	return err
 }
 
+// CopyFrom implements SqlConnection.
+func (mysqlConnection *MysqlConnection) CopyFrom(rawSql string, data io.Reader) error {
+	return fmt.Errorf("COPY FROM stdin is not supported for MySQL connection")
+}
+
+// Begin implements SqlConnection.
+func (mysqlConnection *MysqlConnection) Begin() error {
+	if mysqlConnection.tx != nil {
+		return ErrTransactionInProgress
+	}
+	tx, err := mysqlConnection.db.Begin()
+	if err != nil {
+		return err
+	}
+	mysqlConnection.tx = tx
+	return nil
+}
+
+// Commit implements SqlConnection.
+func (mysqlConnection *MysqlConnection) Commit() error {
+	if mysqlConnection.tx == nil {
+		return ErrNoTransaction
+	}
+	err := mysqlConnection.tx.Commit()
+	mysqlConnection.tx = nil
+	return err
+}
+
+// Rollback implements SqlConnection.
+func (mysqlConnection *MysqlConnection) Rollback() error {
+	if mysqlConnection.tx == nil {
+		return ErrNoTransaction
+	}
+	err := mysqlConnection.tx.Rollback()
+	mysqlConnection.tx = nil
+	return err
+}
+
+// Close implements SqlConnection.
+func (mysqlConnection *MysqlConnection) Close() error {
+	if mysqlConnection.db == nil {
+		return nil
+	}
+	return mysqlConnection.db.Close()
+}
+
 type Sqlite3Connection struct {
 	db *sql.DB
+	tx *sql.Tx
 }
 
 // Establish implements SqlConnection.
@@ -56,47 +138,326 @@ func (sqlite3Connection *Sqlite3Connection) Establish(connectionOptions string)
 
 // Execute implements SqlConnection.
 func (sqlite3Connection *Sqlite3Connection) Execute(rawSql string) error {
+	if sqlite3Connection.tx != nil {
+		_, err := sqlite3Connection.tx.Exec(rawSql)
+		return err
+	}
 	_, err := sqlite3Connection.db.Exec(rawSql)
 	return err
 }
 
+// CopyFrom implements SqlConnection.
+func (sqlite3Connection *Sqlite3Connection) CopyFrom(rawSql string, data io.Reader) error {
+	return fmt.Errorf("COPY FROM stdin is not supported for Sqlite3 connection")
+}
+
+// Begin implements SqlConnection.
+func (sqlite3Connection *Sqlite3Connection) Begin() error {
+	if sqlite3Connection.tx != nil {
+		return ErrTransactionInProgress
+	}
+	tx, err := sqlite3Connection.db.Begin()
+	if err != nil {
+		return err
+	}
+	sqlite3Connection.tx = tx
+	return nil
+}
+
+// Commit implements SqlConnection.
+func (sqlite3Connection *Sqlite3Connection) Commit() error {
+	if sqlite3Connection.tx == nil {
+		return ErrNoTransaction
+	}
+	err := sqlite3Connection.tx.Commit()
+	sqlite3Connection.tx = nil
+	return err
+}
+
+// Rollback implements SqlConnection.
+func (sqlite3Connection *Sqlite3Connection) Rollback() error {
+	if sqlite3Connection.tx == nil {
+		return ErrNoTransaction
+	}
+	err := sqlite3Connection.tx.Rollback()
+	sqlite3Connection.tx = nil
+	return err
+}
+
+// Close implements SqlConnection.
+func (sqlite3Connection *Sqlite3Connection) Close() error {
+	if sqlite3Connection.db == nil {
+		return nil
+	}
+	return sqlite3Connection.db.Close()
+}
+
 type PgConnection struct {
 	pgxOptions string
+	pgConn     *pgconn.PgConn
+	// session statements (SET and set_config) replayed after reconnect, the last statement of every variable
+	sessionStatements []sessionStatement
+	// session statements of the current transaction, they are dropped if the transaction is rolled back
+	transactionStatements []sessionStatement
+	inTransaction         bool
+}
+
+// sessionStatement is the SET statement (or set_config call) of the session variable
+type sessionStatement struct {
+	variable string
+	text     string
+}
+
+// sessionVariable returns the name (lower case) of the variable of SET statement or set_config call,
+// the SET LOCAL statement (it's valid up to the end of transaction) isn't the session statement
+func sessionVariable(rawSql string) (string, bool) {
+	sql, _ := ast.SplitMarginComments(ast.StripLeadingComments(rawSql))
+	if match := setConfigRegexp.FindStringSubmatch(sql); match != nil {
+		return strings.ToLower(match[2]), true
+	}
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(sql, "=", " = ")))
+	if len(words) < 2 || words[0] != "set" || words[1] == "local" {
+		return "", false
+	}
+	if words[1] == "session" && len(words) > 2 {
+		words = words[1:]
+	}
+	return words[1], true
+}
+
+// setSessionStatement replaces the statement of the same variable or appends the statement
+func setSessionStatement(statements []sessionStatement, statement sessionStatement) []sessionStatement {
+	for i, sessionStatement := range statements {
+		if sessionStatement.variable == statement.variable {
+			return append(append(statements[:i:i], statements[i+1:]...), statement)
+		}
+	}
+	return append(statements, statement)
 }
 
 // Establish implements SqlConnection.
 func (pgConnection *PgConnection) Establish(connectionOptions string) error {
 	pgConnection.pgxOptions = "postgres://" + connectionOptions
-	return nil
+	return pgConnection.connect()
 }
 
-// Execute implements SqlConnection.
-func (pgConnection *PgConnection) Execute(rawSql string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+// connect opens a new connection to the server and restores the session state
+func (pgConnection *PgConnection) connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), PG_CONNECT_TIMEOUT)
 	defer cancel()
 
 	pgConn, err := pgconn.Connect(ctx, pgConnection.pgxOptions)
 	if err != nil {
 		return err
 	}
-	defer pgConn.Close(ctx)
-
-	// Recognize COPY FROM STDIN command
-	if strings.Contains(rawSql, "COPY") && strings.HasSuffix(rawSql, "\\.") {
-		sqlCommandAndData := strings.SplitN(rawSql, "stdin;\n", 2)
-		_, err := pgConn.CopyFrom(ctx, strings.NewReader(sqlCommandAndData[1][:len(sqlCommandAndData[1])-2]), sqlCommandAndData[0]+" stdin;")
-		if err != nil {
-			return err
+	for _, sessionStatement := range pgConnection.sessionStatements {
+		result := pgConn.ExecParams(ctx, sessionStatement.text, nil, nil, nil, nil).Read()
+		if result.Err != nil {
+			pgConn.Close(ctx)
+			return fmt.Errorf("restore session state (%s) fail: %w", sessionStatement.text, result.Err)
 		}
+	}
+	pgConnection.pgConn = pgConn
+	return nil
+}
+
+// ensureConnected reconnects if the connection was never opened or has been dropped.
+// The connection isn't restored in the transaction, the transaction is lost with the connection.
+func (pgConnection *PgConnection) ensureConnected() error {
+	if pgConnection.pgConn != nil && !pgConnection.pgConn.IsClosed() {
 		return nil
 	}
-	result := pgConn.ExecParams(ctx, rawSql, nil, nil, nil, nil).Read()
+	if pgConnection.inTransaction {
+		return ErrTransactionLost
+	}
+	return pgConnection.connect()
+}
+
+// Execute implements SqlConnection.
+func (pgConnection *PgConnection) Execute(rawSql string) error {
+	// Recognize COPY FROM STDIN command with the data inside the statement
+	if strings.HasSuffix(rawSql, "\\.") && DetectStatementType(rawSql, nil) == ast.StmtCopy {
+		sqlCommandAndData := strings.SplitN(rawSql, "stdin;\n", 2)
+		return pgConnection.CopyFrom(sqlCommandAndData[0]+" stdin;", strings.NewReader(sqlCommandAndData[1][:len(sqlCommandAndData[1])-2]))
+	}
+
+	if err := pgConnection.ensureConnected(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PG_STATEMENT_TIMEOUT)
+	defer cancel()
+
+	result := pgConnection.pgConn.ExecParams(ctx, rawSql, nil, nil, nil, nil).Read()
 	if result.Err != nil {
 		return result.Err
 	}
+	if statementType := ast.Preview(rawSql); statementType != ast.StmtSet && statementType != ast.StmtSelect {
+		return nil
+	}
+	if variable, ok := sessionVariable(rawSql); ok {
+		statement := sessionStatement{variable: variable, text: rawSql}
+		if pgConnection.inTransaction {
+			pgConnection.transactionStatements = setSessionStatement(pgConnection.transactionStatements, statement)
+		} else {
+			pgConnection.sessionStatements = setSessionStatement(pgConnection.sessionStatements, statement)
+		}
+	}
+	return nil
+}
+
+// CopyFrom implements SqlConnection.
+// The data is piped to the server as is, the time of the copying isn't limited.
+func (pgConnection *PgConnection) CopyFrom(rawSql string, data io.Reader) error {
+	if err := pgConnection.ensureConnected(); err != nil {
+		return err
+	}
+	_, err := pgConnection.pgConn.CopyFrom(context.Background(), data, rawSql)
+	return err
+}
+
+// Begin implements SqlConnection.
+func (pgConnection *PgConnection) Begin() error {
+	if pgConnection.inTransaction {
+		return ErrTransactionInProgress
+	}
+	if err := pgConnection.Execute("BEGIN"); err != nil {
+		return err
+	}
+	pgConnection.inTransaction = true
+	pgConnection.transactionStatements = nil
+	return nil
+}
+
+// Commit implements SqlConnection.
+func (pgConnection *PgConnection) Commit() error {
+	if !pgConnection.inTransaction {
+		return ErrNoTransaction
+	}
+	// COMMIT is sent in the transaction, the dropped connection isn't reopened for it
+	// (COMMIT outside of the transaction is only a warning, the batch would be lost silently)
+	err := pgConnection.Execute("COMMIT")
+	pgConnection.inTransaction = false
+	if err != nil {
+		pgConnection.transactionStatements = nil
+		return err
+	}
+	// The session statements of the committed transaction are kept
+	for _, statement := range pgConnection.transactionStatements {
+		pgConnection.sessionStatements = setSessionStatement(pgConnection.sessionStatements, statement)
+	}
+	pgConnection.transactionStatements = nil
 	return nil
 }
 
+// Rollback implements SqlConnection.
+func (pgConnection *PgConnection) Rollback() error {
+	if !pgConnection.inTransaction {
+		return ErrNoTransaction
+	}
+	err := pgConnection.Execute("ROLLBACK")
+	pgConnection.inTransaction = false
+	pgConnection.transactionStatements = nil
+	return err
+}
+
+// Close implements SqlConnection.
+func (pgConnection *PgConnection) Close() error {
+	if pgConnection.pgConn == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), PG_CONNECT_TIMEOUT)
+	defer cancel()
+
+	err := pgConnection.pgConn.Close(ctx)
+	pgConnection.pgConn = nil
+	return err
+}
+
+// NopConnection skips all statements, the COPY data is read and dropped
+type NopConnection struct {
+}
+
+// Establish implements SqlConnection.
+func (nopConnection *NopConnection) Establish(connectionOptions string) error {
+	return nil
+}
+
+// Execute implements SqlConnection.
+func (nopConnection *NopConnection) Execute(rawSql string) error {
+	return nil
+}
+
+// CopyFrom implements SqlConnection.
+func (nopConnection *NopConnection) CopyFrom(rawSql string, data io.Reader) error {
+	_, err := io.Copy(io.Discard, data)
+	return err
+}
+
+// Begin implements SqlConnection.
+func (nopConnection *NopConnection) Begin() error {
+	return nil
+}
+
+// Commit implements SqlConnection.
+func (nopConnection *NopConnection) Commit() error {
+	return nil
+}
+
+// Rollback implements SqlConnection.
+func (nopConnection *NopConnection) Rollback() error {
+	return nil
+}
+
+// Close implements SqlConnection.
+func (nopConnection *NopConnection) Close() error {
+	return nil
+}
+
+// ConnectUrl makes the connection structure for the sql url. The special url
+// null://<dialect> (for example null://pg) makes the NopConnection, the statements
+// are parsed with the dialect but never executed. The url file://<file name>?dialect=<dialect>
+// (for example file://./dump.sql.gz?dialect=mysql) makes the FileConnection, the statements
+// are written to the file. The dialect by default is pg.
+func ConnectUrl(sqlUrl string) (SqlConnection, dialect.SqlDialect, string, error) {
+	driverId, dialectName, found := strings.Cut(sqlUrl, "://")
+	if found && strings.ToLower(driverId) == FILE_DRIVER_ID {
+		fileName, query, _ := strings.Cut(dialectName, "?")
+		parameters, err := url.ParseQuery(query)
+		if err != nil || fileName == "" {
+			return nil, 0, "", fmt.Errorf("wrong file url: %v", sqlUrl)
+		}
+		sqlDialect := dialect.PSQL
+		if dialectName := parameters.Get("dialect"); dialectName != "" {
+			sqlDialect, _, err = (*dialect.SqlDialect).ParseUrl(nil, dialectName+"://")
+			if err != nil {
+				return nil, 0, "", fmt.Errorf("unknown dialect %v for url: %v", dialectName, sqlUrl)
+			}
+		}
+		return &FileConnection{}, sqlDialect, fileName, nil
+	}
+	if found && strings.ToLower(driverId) == NULL_DRIVER_ID {
+		if dialectName == "" {
+			return &NopConnection{}, dialect.PSQL, "", nil
+		}
+		sqlDialect, _, err := (*dialect.SqlDialect).ParseUrl(nil, dialectName+"://")
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("unknown dialect %v for url: %v", dialectName, sqlUrl)
+		}
+		return &NopConnection{}, sqlDialect, "", nil
+	}
+
+	sqlDialect, connectionOptions, err := (*dialect.SqlDialect).ParseUrl(nil, sqlUrl)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	connection, err := Connect(sqlDialect)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return connection, sqlDialect, connectionOptions, nil
+}
+
 // connection factory
 func Connect(sqlDialect dialect.SqlDialect) (SqlConnection, error) {
 	switch sqlDialect {
@@ -57,6 +57,7 @@ const (
 	StmtCallProc
 	StmtRevert
 	StmtShowMigrationLogs
+	StmtCopy
 )
 
 // ASTToStatementType returns a StatementType from an AST stmt
@@ -110,6 +111,8 @@ func ASTToStatementType(stmt Statement) StatementType {
 		return StmtStream
 	case *VStream:
 		return StmtVStream
+	case *CopyFrom:
+		return StmtCopy
 	default:
 		return StmtUnknown
 	}
@@ -201,6 +204,8 @@ func Preview(sql string) StatementType {
 		return StmtLockTables
 	case "unlock":
 		return StmtUnlockTables
+	case "copy":
+		return StmtCopy
 	}
 	// For the following statements it is not sufficient to rely
 	// on loweredFirstWord. This is because they are not statements
@@ -293,6 +298,8 @@ func (s StatementType) String() string {
 		return "FLUSH"
 	case StmtCallProc:
 		return "CALL_PROC"
+	case StmtCopy:
+		return "COPY"
 	default:
 		return "UNKNOWN"
 	}
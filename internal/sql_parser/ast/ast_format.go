@@ -19,6 +19,7 @@ package ast
 import (
 	"strings"
 
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
 	"github.com/usalko/prodl/internal/sql_types"
 )
 
@@ -668,13 +669,14 @@ func (col *ColumnDefinition) Format(buf *TrackedBuffer) {
 
 // Format returns a canonical string representation of the type and all relevant options
 func (ct *ColumnType) Format(buf *TrackedBuffer) {
-	buf.astPrintf(ct, "%#s", ct.Type)
+	typeName, length, scale := buf.ColumnType(ct)
+	buf.astPrintf(ct, "%#s", typeName)
 
-	if ct.Length != nil && ct.Scale != nil {
-		buf.astPrintf(ct, "(%v,%v)", ct.Length, ct.Scale)
+	if length != nil && scale != nil {
+		buf.astPrintf(ct, "(%v,%v)", length, scale)
 
-	} else if ct.Length != nil {
-		buf.astPrintf(ct, "(%v)", ct.Length)
+	} else if length != nil {
+		buf.astPrintf(ct, "(%v)", length)
 	}
 
 	if ct.EnumValues != nil {
@@ -688,16 +690,17 @@ func (ct *ColumnType) Format(buf *TrackedBuffer) {
 		buf.WriteString(")")
 	}
 
-	if ct.Unsigned {
+	// The attributes of mysql types aren't printed for the other dialects
+	if ct.Unsigned && !buf.standardSql() {
 		buf.astPrintf(ct, " %#s", "unsigned")
 	}
-	if ct.Zerofill {
+	if ct.Zerofill && !buf.standardSql() {
 		buf.astPrintf(ct, " %#s", "zerofill")
 	}
-	if ct.Charset.Name != "" {
+	if ct.Charset.Name != "" && !buf.standardSql() {
 		buf.astPrintf(ct, " %s %s %#s", "character", "set", ct.Charset.Name)
 	}
-	if ct.Charset.Binary {
+	if ct.Charset.Binary && !buf.standardSql() {
 		buf.astPrintf(ct, " %#s", "binary")
 	}
 	if ct.Options != nil {
@@ -1294,7 +1297,11 @@ func (node *ExistsExpr) Format(buf *TrackedBuffer) {
 func (node *Literal) Format(buf *TrackedBuffer) {
 	switch node.Type {
 	case StrVal:
-		sql_types.MakeTrusted(sql_types.VarBinary, node.Bytes()).EncodeSQL(buf)
+		if buf.standardSql() {
+			buf.writeStandardString(node.Val)
+		} else {
+			sql_types.MakeTrusted(sql_types.VarBinary, node.Bytes()).EncodeSQL(buf)
+		}
 	case IntVal, FloatVal, DecimalVal, HexNum:
 		buf.astPrintf(node, "%s", node.Val)
 	case HexVal:
@@ -1318,6 +1325,15 @@ func (node *NullVal) Format(buf *TrackedBuffer) {
 
 // Format formats the node.
 func (node BoolVal) Format(buf *TrackedBuffer) {
+	// The boolean of sqlite3 is the integer
+	if buf.sqlDialect == dialect.SQLITE3 {
+		if node {
+			buf.WriteString("1")
+		} else {
+			buf.WriteString("0")
+		}
+		return
+	}
 	if node {
 		buf.WriteString("true")
 	} else {
@@ -1595,6 +1611,15 @@ func (node *Limit) Format(buf *TrackedBuffer) {
 	if node == nil {
 		return
 	}
+	if buf.standardSql() {
+		if node.Rowcount != nil {
+			buf.astPrintf(node, " limit %v", node.Rowcount)
+		}
+		if node.Offset != nil {
+			buf.astPrintf(node, " offset %v", node.Offset)
+		}
+		return
+	}
 	buf.astPrintf(node, " limit ")
 	if node.Offset != nil {
 		buf.astPrintf(node, "%v, ", node.Offset)
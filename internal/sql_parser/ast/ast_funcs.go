@@ -182,7 +182,7 @@ func (ts *TableSpec) AddConstraint(cd *ConstraintDefinition) {
 // DescribeType returns the abbreviated type information as required for
 // describe table
 func (ct *ColumnType) DescribeType() string {
-	buf := NewTrackedBuffer(nil)
+	buf := NewTrackedBuffer(nil, dialect.MYSQL)
 	buf.Myprintf("%s", ct.Type)
 	if ct.Length != nil && ct.Scale != nil {
 		buf.Myprintf("(%v,%v)", ct.Length, ct.Scale)
@@ -539,6 +539,66 @@ func (node *Literal) HexDecode() ([]byte, error) {
 	return hex.DecodeString(node.Val)
 }
 
+// ExprToValue decodes the value of the literal expression: the literals, NULL, true and false
+// (1 and 0), the negative numbers and the literals with the character set introducer (_binary 'x').
+// The hexadecimal literals are decoded into the binary values. The result is false for the other expressions.
+func ExprToValue(expr Expr) (sql_types.Value, bool) {
+	switch node := expr.(type) {
+	case *NullVal:
+		return sql_types.NULL, true
+	case BoolVal:
+		if node {
+			return sql_types.NewInt64(1), true
+		}
+		return sql_types.NewInt64(0), true
+	case *Literal:
+		switch node.Type {
+		case StrVal:
+			return sql_types.NewVarChar(node.Val), true
+		case IntVal:
+			// The integer literal is decimal (the leading zeros aren't the octal prefix)
+			if signed, err := strconv.ParseInt(node.Val, 10, 64); err == nil {
+				return sql_types.NewInt64(signed), true
+			}
+			if unsigned, err := strconv.ParseUint(node.Val, 10, 64); err == nil {
+				return sql_types.NewUint64(unsigned), true
+			}
+			return sql_types.NewDecimal(node.Val), true
+		case DecimalVal:
+			return sql_types.NewDecimal(node.Val), true
+		case FloatVal:
+			return sql_types.MakeTrusted(sql_types.Float64, node.Bytes()), true
+		case HexVal:
+			if bytes, err := node.HexDecode(); err == nil {
+				return sql_types.NewVarBinary(string(bytes)), true
+			}
+		case HexNum:
+			digits := node.Val[2:]
+			if len(digits)%2 == 1 {
+				digits = "0" + digits
+			}
+			if bytes, err := hex.DecodeString(digits); err == nil {
+				return sql_types.NewVarBinary(string(bytes)), true
+			}
+		}
+	case *UnaryExpr:
+		value, ok := ExprToValue(node.Expr)
+		if ok && node.Operator == UMinusOp && sql_types.IsNumber(value.Type()) {
+			if signed, err := strconv.ParseInt("-"+value.RawStr(), 10, 64); err == nil {
+				return sql_types.NewInt64(signed), true
+			}
+			return sql_types.MakeTrusted(value.Type(), append([]byte{'-'}, value.Raw()...)), true
+		}
+	case *IntroducerExpr:
+		value, ok := ExprToValue(node.Expr)
+		if ok && strings.EqualFold(node.CharacterSet, "_binary") && !value.IsNull() {
+			return sql_types.NewVarBinary(value.RawStr()), true
+		}
+		return value, ok
+	}
+	return sql_types.NULL, false
+}
+
 // encodeHexValToMySQLQueryFormat encodes the hexval back into the query format
 // for passing on to MySQL as a bind var
 func (node *Literal) encodeHexValToMySQLQueryFormat() ([]byte, error) {
@@ -831,7 +891,7 @@ func containEscapableChars(s string, at AtCount) bool {
 }
 
 func formatID(buf *TrackedBuffer, original string, at AtCount) {
-	_, isKeyword := cache.KeywordLookup(original, dialect.MYSQL)
+	_, isKeyword := cache.KeywordLookup(original, buf.keywordDialect())
 	if buf.escape || isKeyword || containEscapableChars(original, at) {
 		writeEscapedString(buf, original)
 	} else {
@@ -840,14 +900,15 @@ func formatID(buf *TrackedBuffer, original string, at AtCount) {
 }
 
 func writeEscapedString(buf *TrackedBuffer, original string) {
-	buf.WriteByte('`')
+	quote := buf.identifierQuote()
+	buf.WriteRune(quote)
 	for _, c := range original {
 		buf.WriteRune(c)
-		if c == '`' {
-			buf.WriteByte('`')
+		if c == quote {
+			buf.WriteRune(quote)
 		}
 	}
-	buf.WriteByte('`')
+	buf.WriteRune(quote)
 }
 
 func compliantName(in string) string {
@@ -1785,7 +1846,7 @@ const (
 // ToString prints the list of table expressions as a string
 // To be used as an alternate for String for []TableExpr
 func ToString(exprs []TableExpr) string {
-	buf := NewTrackedBuffer(nil)
+	buf := NewTrackedBuffer(nil, dialect.MYSQL)
 	prefix := ""
 	for _, expr := range exprs {
 		buf.astPrintf(nil, "%s%v", prefix, expr)
@@ -1795,7 +1856,7 @@ func ToString(exprs []TableExpr) string {
 }
 
 func FormatIdentifier(id string) string {
-	buf := NewTrackedBuffer(nil)
+	buf := NewTrackedBuffer(nil, dialect.MYSQL)
 	formatID(buf, id, NoAt)
 	return buf.String()
 }
@@ -1804,7 +1865,7 @@ func FormatAddress(address string) string {
 	if len(address) > 0 && address[0] == '\'' {
 		return address
 	}
-	buf := NewTrackedBuffer(nil)
+	buf := NewTrackedBuffer(nil, dialect.MYSQL)
 	formatID(buf, address, NoAt)
 	return buf.String()
 }
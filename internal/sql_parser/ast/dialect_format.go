@@ -0,0 +1,84 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// The mysql types which are named differently in pg (the types which pg doesn't know)
+var pgTypeNames = map[string]string{
+	"tinyint":    "smallint",
+	"mediumint":  "integer",
+	"int":        "integer",
+	"double":     "double precision",
+	"datetime":   "timestamp",
+	"year":       "smallint",
+	"tinytext":   "text",
+	"mediumtext": "text",
+	"longtext":   "text",
+	"tinyblob":   "bytea",
+	"blob":       "bytea",
+	"mediumblob": "bytea",
+	"longblob":   "bytea",
+	"binary":     "bytea",
+	"varbinary":  "bytea",
+}
+
+// The pg types without the length (the length of mysql integer types is the display width)
+var pgTypesWithoutLength = map[string]bool{
+	"smallint":         true,
+	"integer":          true,
+	"bigint":           true,
+	"real":             true,
+	"double precision": true,
+	"text":             true,
+	"bytea":            true,
+}
+
+// standardSql checks the query is formatted for pg or sqlite3: the identifiers are quoted by
+// double quotes, the strings are quoted without backslash escapes, the limit is followed by the offset.
+// The other dialects are formatted as mysql.
+func (buf *TrackedBuffer) standardSql() bool {
+	return buf.sqlDialect == dialect.PSQL || buf.sqlDialect == dialect.SQLITE3
+}
+
+// keywordDialect returns the dialect of keywords which are quoted if they are used as identifiers
+func (buf *TrackedBuffer) keywordDialect() dialect.SqlDialect {
+	if buf.standardSql() {
+		return buf.sqlDialect
+	}
+	return dialect.MYSQL
+}
+
+// identifierQuote returns the quote of identifiers: the standard double quote of pg and sqlite3
+// or the backtick of mysql
+func (buf *TrackedBuffer) identifierQuote() rune {
+	if buf.standardSql() {
+		return '"'
+	}
+	return '`'
+}
+
+// writeStandardString writes the string literal quoted by the standard way, the quote is doubled
+func (buf *TrackedBuffer) writeStandardString(value string) {
+	buf.WriteByte('\'')
+	buf.WriteString(strings.ReplaceAll(value, "'", "''"))
+	buf.WriteByte('\'')
+}
+
+// ColumnType returns the type name, length and scale of the column type in the dialect,
+// the mysql types are renamed for pg
+func (buf *TrackedBuffer) ColumnType(ct *ColumnType) (string, *Literal, *Literal) {
+	if buf.sqlDialect != dialect.PSQL {
+		return ct.Type, ct.Length, ct.Scale
+	}
+	typeName := ct.Type
+	if pgTypeName, ok := pgTypeNames[strings.ToLower(typeName)]; ok {
+		typeName = pgTypeName
+	}
+	if pgTypesWithoutLength[strings.ToLower(typeName)] {
+		return typeName, nil, nil
+	}
+	return typeName, ct.Length, ct.Scale
+}
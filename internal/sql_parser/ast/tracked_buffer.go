@@ -19,6 +19,8 @@ package ast
 import (
 	"fmt"
 	"strings"
+
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
 )
 
 type bindLocation struct {
@@ -36,23 +38,27 @@ type NodeFormatter func(buf *TrackedBuffer, node SQLNode)
 // use to format a node. By default(nil), it's FormatNode.
 // But you can supply a different formatting function if you
 // want to generate a query that's different from the default.
+// sqlDialect is the dialect of the generated query, see dialect_format.go.
 type TrackedBuffer struct {
 	*strings.Builder
 	bindLocations []bindLocation
 	nodeFormatter NodeFormatter
+	sqlDialect    dialect.SqlDialect
 	literal       func(string) (int, error)
 	escape        bool
 	fast          bool
 }
 
-// NewTrackedBuffer creates a new TrackedBuffer.
-func NewTrackedBuffer(nodeFormatter NodeFormatter) *TrackedBuffer {
+// NewTrackedBuffer creates a new TrackedBuffer which formats the query for the dialect.
+// The optimized fastFormat routines print MySQL queries only, they aren't used for the other dialects.
+func NewTrackedBuffer(nodeFormatter NodeFormatter, sqlDialect dialect.SqlDialect) *TrackedBuffer {
 	buf := &TrackedBuffer{
 		Builder:       new(strings.Builder),
 		nodeFormatter: nodeFormatter,
+		sqlDialect:    sqlDialect,
 	}
 	buf.literal = buf.WriteString
-	buf.fast = nodeFormatter == nil
+	buf.fast = nodeFormatter == nil && !buf.standardSql()
 	return buf
 }
 
@@ -290,11 +296,24 @@ func String(node SQLNode) string {
 		return "<nil>"
 	}
 
-	buf := NewTrackedBuffer(nil)
+	buf := NewTrackedBuffer(nil, dialect.MYSQL)
 	node.formatFast(buf)
 	return buf.String()
 }
 
+// DialectString returns a string representation of an SQLNode in the dialect:
+// the identifiers, string literals, LIMIT clause, boolean literals and column types
+// follow the dialect (see dialect_format.go).
+func DialectString(node SQLNode, sqlDialect dialect.SqlDialect) string {
+	if node == nil {
+		return "<nil>"
+	}
+
+	buf := NewTrackedBuffer(nil, sqlDialect)
+	buf.Myprintf("%v", node)
+	return buf.String()
+}
+
 // CanonicalString returns a canonical string representation of an SQLNode where all identifiers
 // are always escaped and all SQL syntax is in uppercase. This matches the canonical output from MySQL.
 func CanonicalString(node SQLNode) string {
@@ -302,7 +321,7 @@ func CanonicalString(node SQLNode) string {
 		return "" // do not return '<nil>', which is Go syntax.
 	}
 
-	buf := NewTrackedBuffer(nil)
+	buf := NewTrackedBuffer(nil, dialect.MYSQL)
 	buf.SetUpperCase(true)
 	buf.SetEscapeAllIdentifiers(true)
 	node.Format(buf)
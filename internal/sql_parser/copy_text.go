@@ -0,0 +1,182 @@
+package sql_parser
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The delimiter of fields and the NULL field of COPY text format
+const (
+	COPY_TEXT_DELIMITER  = '\t'
+	COPY_TEXT_NULL_FIELD = "\\N"
+	// Size of the read buffer for COPY ... FROM stdin data lines
+	COPY_DATA_BUFFER_SIZE = 64 * 1024
+)
+
+// CopyLineTransform returns the line which replaces the line of COPY data (the lines are passed
+// with the line end), the line is skipped if the result is empty
+type CopyLineTransform func(line string) (string, error)
+
+// copyLineReader reads the lines of COPY data transformed by the function
+type copyLineReader struct {
+	transform CopyLineTransform
+	lines     *bufio.Reader
+	pending   []byte
+	eof       bool
+}
+
+// NewCopyLineReader returns the reader of COPY data which transforms (or skips) every line
+func NewCopyLineReader(data io.Reader, transform CopyLineTransform) io.Reader {
+	return &copyLineReader{transform: transform, lines: bufio.NewReaderSize(data, COPY_DATA_BUFFER_SIZE)}
+}
+
+func (reader *copyLineReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.eof {
+			return 0, io.EOF
+		}
+		line, err := reader.lines.ReadString('\n')
+		if err == io.EOF {
+			reader.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		if line == "" {
+			continue
+		}
+		transformed, err := reader.transform(line)
+		if err != nil {
+			return 0, err
+		}
+		reader.pending = []byte(transformed)
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+// ReadCopyLines calls the function for every line of COPY data (with the line end)
+func ReadCopyLines(data io.Reader, onLine func(line string) error) error {
+	lines := bufio.NewReaderSize(data, COPY_DATA_BUFFER_SIZE)
+	for {
+		line, err := lines.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line != "" {
+			if lineErr := onLine(line); lineErr != nil {
+				return lineErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// SplitCopyTextLine splits the line of COPY text format (without the line end) into the raw fields,
+// the escaped delimiter doesn't split the fields
+func SplitCopyTextLine(line string) []string {
+	fields := make([]string, 0)
+	begin := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case COPY_TEXT_DELIMITER:
+			fields = append(fields, line[begin:i])
+			begin = i + 1
+		}
+	}
+	return append(fields, line[begin:])
+}
+
+// DecodeCopyTextField decodes the backslash escapes of the raw field: \b, \f, \n, \r, \t, \v,
+// the octal (\123) and the hex (\x53) bytes, the other escaped characters are taken as is.
+// The result is false if the field is NULL (\N).
+func DecodeCopyTextField(field string) (string, bool) {
+	if field == COPY_TEXT_NULL_FIELD {
+		return "", false
+	}
+	if strings.IndexByte(field, '\\') < 0 {
+		return field, true
+	}
+	var text strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] != '\\' || i+1 == len(field) {
+			text.WriteByte(field[i])
+			continue
+		}
+		i++
+		switch c := field[i]; c {
+		case 'b':
+			text.WriteByte('\b')
+		case 'f':
+			text.WriteByte('\f')
+		case 'n':
+			text.WriteByte('\n')
+		case 'r':
+			text.WriteByte('\r')
+		case 't':
+			text.WriteByte('\t')
+		case 'v':
+			text.WriteByte('\v')
+		case 'x':
+			end := i + 1
+			for end < len(field) && end < i+3 && isHexDigit(field[end]) {
+				end++
+			}
+			if end == i+1 {
+				text.WriteByte(c)
+				continue
+			}
+			value, _ := strconv.ParseUint(field[i+1:end], 16, 8)
+			text.WriteByte(byte(value))
+			i = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i
+			for end < len(field) && end < i+3 && field[end] >= '0' && field[end] <= '7' {
+				end++
+			}
+			value, _ := strconv.ParseUint(field[i:end], 8, 16)
+			text.WriteByte(byte(value))
+			i = end - 1
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return text.String(), true
+}
+
+// EncodeCopyTextField escapes the backslash, the delimiter and the line ends of the text,
+// the field is \N if it isn't valid (NULL)
+func EncodeCopyTextField(text string, valid bool) string {
+	if !valid {
+		return COPY_TEXT_NULL_FIELD
+	}
+	if !strings.ContainsAny(text, "\\\t\n\r") {
+		return text
+	}
+	var field strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			field.WriteString("\\\\")
+		case '\t':
+			field.WriteString("\\t")
+		case '\n':
+			field.WriteString("\\n")
+		case '\r':
+			field.WriteString("\\r")
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return field.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -51,12 +51,12 @@ type MysqlTokenizer struct {
 	ignoreCommentKeyword bool
 
 	Pos int
-	buf string
+	buf *tokenizer.BytesBuffer
 }
 
 // ResetTo implements tokenizer.Tokenizer.
 func (tkn *MysqlTokenizer) ResetTo(nextPos int) {
-	tkn.buf = strings.Clone(tkn.buf[nextPos:])
+	tkn.buf.ClipFrom(nextPos)
 	tkn.Pos = 0
 }
 
@@ -67,7 +67,7 @@ func (tkn *MysqlTokenizer) GetDialect() dialect.SqlDialect {
 
 // GetText implements tokenizer.Tokenizer.
 func (tkn *MysqlTokenizer) GetText(startPos int) string {
-	return tkn.buf[startPos:tkn.Pos]
+	return tkn.buf.StringAt(startPos, tkn.Pos)
 }
 
 // SetSkipSpecialComments implements tokenizer.Tokenizer.
@@ -257,6 +257,17 @@ var MySQLVersion = "50709" // default version if nothing else is stated
 func NewMysqlStringTokenizer(sql string) *MysqlTokenizer {
 	checkParserVersionFlag()
 
+	return &MysqlTokenizer{
+		buf:      tokenizer.NewBytesBufferString(sql),
+		BindVars: make(map[string]struct{}),
+	}
+}
+
+// NewBufferedMysqlStringTokenizer creates a new Tokenizer for the
+// BytesBuffer.
+func NewBufferedMysqlStringTokenizer(sql *tokenizer.BytesBuffer) *MysqlTokenizer {
+	checkParserVersionFlag()
+
 	return &MysqlTokenizer{
 		buf:      sql,
 		BindVars: make(map[string]struct{}),
@@ -533,7 +544,7 @@ func (tkn *MysqlTokenizer) scanIdentifier(isVariable bool) (int, string) {
 		}
 		tkn.Skip(1)
 	}
-	keywordName := tkn.buf[start:tkn.Pos]
+	keywordName := tkn.buf.StringAt(start, tkn.Pos)
 	if keywordID, found := cache.KeywordLookup(keywordName, dialect.MYSQL); found {
 		return keywordID, keywordName
 	}
@@ -548,7 +559,7 @@ func (tkn *MysqlTokenizer) scanIdentifier(isVariable bool) (int, string) {
 func (tkn *MysqlTokenizer) scanHex() (int, string) {
 	start := tkn.Pos
 	tkn.scanMantissa(16)
-	hex := tkn.buf[start:tkn.Pos]
+	hex := tkn.buf.StringAt(start, tkn.Pos)
 	if tkn.Cur() != '\'' {
 		return LEX_ERROR, hex
 	}
@@ -563,7 +574,7 @@ func (tkn *MysqlTokenizer) scanHex() (int, string) {
 func (tkn *MysqlTokenizer) scanBitLiteral() (int, string) {
 	start := tkn.Pos
 	tkn.scanMantissa(2)
-	bit := tkn.buf[start:tkn.Pos]
+	bit := tkn.buf.StringAt(start, tkn.Pos)
 	if tkn.Cur() != '\'' {
 		return LEX_ERROR, bit
 	}
@@ -617,16 +628,16 @@ func (tkn *MysqlTokenizer) scanLiteralIdentifier() (int, string) {
 					return LEX_ERROR, ""
 				}
 				tkn.Skip(1)
-				return ID, tkn.buf[start : tkn.Pos-1]
+				return ID, tkn.buf.StringAt(start, tkn.Pos-1)
 			}
 
 			var buf strings.Builder
-			buf.WriteString(tkn.buf[start:tkn.Pos])
+			buf.WriteString(tkn.buf.StringAt(start, tkn.Pos))
 			tkn.Skip(1)
 			return tkn.scanLiteralIdentifierSlow(&buf)
 		case tokenizer.EofChar:
 			// Premature EOF.
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		default:
 			tkn.Skip(1)
 		}
@@ -644,7 +655,7 @@ func (tkn *MysqlTokenizer) scanBindVar() (int, string) {
 		tkn.Skip(1)
 	}
 	if !isLetter(tkn.Cur()) {
-		return LEX_ERROR, tkn.buf[start:tkn.Pos]
+		return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 	}
 	for {
 		ch := tkn.Cur()
@@ -653,7 +664,7 @@ func (tkn *MysqlTokenizer) scanBindVar() (int, string) {
 		}
 		tkn.Skip(1)
 	}
-	return token, tkn.buf[start:tkn.Pos]
+	return token, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanMantissa scans a sequence of numeric characters with the same base.
@@ -709,7 +720,7 @@ exit:
 	if isLetter(tkn.Cur()) {
 		// A letter cannot immediately follow a float number.
 		if token == FLOAT || token == DECIMAL {
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 		// A letter seen after a few numbers means that we should parse this
 		// as an identifier and not a number.
@@ -720,10 +731,10 @@ exit:
 			}
 			tkn.Skip(1)
 		}
-		return ID, tkn.buf[start:tkn.Pos]
+		return ID, tkn.buf.StringAt(start, tkn.Pos)
 	}
 
-	return token, tkn.buf[start:tkn.Pos]
+	return token, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanString scans a string surrounded by the given `delim`, which can be
@@ -738,17 +749,17 @@ func (tkn *MysqlTokenizer) scanString(delim rune, typ int) (int, string) {
 		case delim:
 			if tkn.Peek(1) != delim {
 				tkn.Skip(1)
-				return typ, tkn.buf[start : tkn.Pos-1]
+				return typ, tkn.buf.StringAt(start, tkn.Pos-1)
 			}
 			fallthrough
 
 		case '\\':
 			var buffer strings.Builder
-			buffer.WriteString(tkn.buf[start:tkn.Pos])
+			buffer.WriteString(tkn.buf.StringAt(start, tkn.Pos))
 			return tkn.scanStringSlow(&buffer, delim, typ)
 
 		case tokenizer.EofChar:
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 
 		tkn.Skip(1)
@@ -769,15 +780,15 @@ func (tkn *MysqlTokenizer) scanStringSlow(buffer *strings.Builder, delim rune, t
 		if ch != delim && ch != '\\' {
 			// Scan ahead to the next interesting character.
 			start := tkn.Pos
-			for ; tkn.Pos < len(tkn.buf); tkn.Pos++ {
-				ch = rune(tkn.buf[tkn.Pos])
+			for ; tkn.Pos < tkn.buf.Size(); tkn.Pos++ {
+				ch = tkn.buf.RuneAt(tkn.Pos)
 				if ch == delim || ch == '\\' {
 					break
 				}
 			}
 
-			buffer.WriteString(tkn.buf[start:tkn.Pos])
-			if tkn.Pos >= len(tkn.buf) {
+			buffer.WriteString(tkn.buf.StringAt(start, tkn.Pos))
+			if tkn.Pos >= tkn.buf.Size() {
 				// Reached the end of the buffer without finding a delim or
 				// escape character.
 				tkn.Skip(1)
@@ -820,7 +831,7 @@ func (tkn *MysqlTokenizer) scanCommentType1(prefixLen int) (int, string) {
 		}
 		tkn.Skip(1)
 	}
-	return COMMENT, tkn.buf[start:tkn.Pos]
+	return COMMENT, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanCommentType2 scans a '/*' delimited comment; assumes the opening
@@ -837,11 +848,11 @@ func (tkn *MysqlTokenizer) scanCommentType2() (int, string) {
 			continue
 		}
 		if tkn.Cur() == tokenizer.EofChar {
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 		tkn.Skip(1)
 	}
-	return COMMENT, tkn.buf[start:tkn.Pos]
+	return COMMENT, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanMySQLSpecificComment scans a MySQL comment pragma, which always starts with '//*`
@@ -857,12 +868,12 @@ func (tkn *MysqlTokenizer) scanMySQLSpecificComment() (int, string) {
 			continue
 		}
 		if tkn.Cur() == tokenizer.EofChar {
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 		tkn.Skip(1)
 	}
 
-	commentVersion, sql := ExtractMysqlComment(tkn.buf[start:tkn.Pos])
+	commentVersion, sql := ExtractMysqlComment(tkn.buf.StringAt(start, tkn.Pos))
 
 	if MySQLVersion >= commentVersion {
 		// Only add the special comment to the tokenizer if the version of MySQL is higher or equal to the comment version
@@ -881,10 +892,10 @@ func (tkn *MysqlTokenizer) Skip(dist int) {
 }
 
 func (tkn *MysqlTokenizer) Peek(dist int) rune {
-	if tkn.Pos+dist >= len(tkn.buf) {
+	if tkn.Pos+dist >= tkn.buf.Size() {
 		return tokenizer.EofChar
 	}
-	return rune(tkn.buf[tkn.Pos+dist])
+	return tkn.buf.RuneAt(tkn.Pos + dist)
 }
 
 // Reset clears any internal state.
@@ -279,8 +279,12 @@ func NewStringTokenizer(sql string, sqlDialect dialect.SqlDialect) (tokenizer.To
 // BytesBuffer
 func NewBufferedTokenizer(sql *tokenizer.BytesBuffer, sqlDialect dialect.SqlDialect) (tokenizer.Tokenizer, error) {
 	switch sqlDialect {
+	case dialect.MYSQL:
+		return mysql.NewBufferedMysqlStringTokenizer(sql), nil
 	case dialect.PSQL:
 		return psql.NewBufferedPsqlStringTokenizer(sql), nil
+	case dialect.SQLITE3:
+		return sqlite3.NewBufferedSqlite3StringTokenizer(sql), nil
 	}
 	return nil, fmt.Errorf("sorry buffered tokenizer not found for dialect %s", sqlDialect.String())
 }
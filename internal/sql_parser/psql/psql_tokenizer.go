@@ -50,6 +50,8 @@ type PsqlTokenizer struct {
 	leftContext          tokenizer.CyclicBuffer
 	ignoreCommentKeyword bool
 	scanDataMarkMode     bool
+	// COPY FROM stdin data is read by the caller (see sql_parser.StatementStream)
+	keepCopyData bool
 
 	Pos int
 	buf *tokenizer.BytesBuffer
@@ -213,9 +215,10 @@ func NewPsqlStringTokenizer(sql string) *PsqlTokenizer {
 func NewBufferedPsqlStringTokenizer(sql *tokenizer.BytesBuffer) *PsqlTokenizer {
 
 	return &PsqlTokenizer{
-		buf:         sql,
-		BindVars:    make(map[string]struct{}),
-		leftContext: *tokenizer.NewCyclicBuffer(10),
+		buf:          sql,
+		BindVars:     make(map[string]struct{}),
+		leftContext:  *tokenizer.NewCyclicBuffer(10),
+		keepCopyData: true,
 	}
 }
 
@@ -346,6 +349,8 @@ func (tzr *PsqlTokenizer) Scan() (int, string) {
 		return tzr.scanIdentifier(false)
 	case isDigit(ch):
 		return tzr.scanNumber()
+	case ch == '$':
+		return tzr.scanDollarString()
 	case ch == ':':
 		return tzr.scanBindVar()
 	case ch == ';':
@@ -355,7 +360,7 @@ func (tzr *PsqlTokenizer) Scan() (int, string) {
 			// forces the advance.
 			return 0, ""
 		}
-		if tzr.leftContext.Has("stdin") {
+		if tzr.leftContext.Has("stdin") && !tzr.keepCopyData {
 			return tzr.scanEndDataMark()
 		}
 		tzr.Skip(1)
@@ -505,7 +510,7 @@ func (tzr *PsqlTokenizer) scanIdentifier(isVariable bool) (int, string) {
 
 	for {
 		ch := tzr.leftContext.Put(rune(tzr.Cur()))
-		if !isLetter(ch) && !isDigit(ch) && !(isVariable && isCarat(ch)) {
+		if !isLetter(ch) && !isDigit(ch) && ch != '$' && !(isVariable && isCarat(ch)) {
 			break
 		}
 		tzr.Skip(1)
@@ -521,6 +526,39 @@ func (tzr *PsqlTokenizer) scanIdentifier(isVariable bool) (int, string) {
 	return ID, keywordName
 }
 
+// scanDollarString scans a dollar-quoted string $tag$...$tag$ (the tag can be empty: $$...$$),
+// the string is returned as is without the escape sequences. The positional parameter ($1)
+// is scanned as the identifier. The string or the tag which isn't terminated before the end
+// of the buffer is the LEX_ERROR, the buffered tokenizer scans it again with the next page.
+func (tzr *PsqlTokenizer) scanDollarString() (int, string) {
+	start := tzr.Pos
+	if isDigit(tzr.Peek(1)) {
+		return tzr.scanIdentifier(false)
+	}
+	tzr.Skip(1)
+	for isLetter(tzr.Cur()) || (isDigit(tzr.Cur()) && tzr.Pos > start+1) {
+		tzr.Skip(1)
+	}
+	switch tzr.Cur() {
+	case tokenizer.EofChar:
+		return LEX_ERROR, tzr.buf.StringAt(start, tzr.Pos)
+	case '$':
+		tzr.Skip(1)
+	default:
+		tzr.Pos = start
+		return tzr.scanIdentifier(false)
+	}
+	tag := tzr.buf.StringAt(start, tzr.Pos)
+	rest := tzr.buf.StringAt(tzr.Pos, tzr.buf.Size())
+	end := strings.Index(rest, tag)
+	if end < 0 {
+		tzr.Pos = tzr.buf.Size()
+		return LEX_ERROR, tzr.buf.StringAt(start, tzr.Pos)
+	}
+	tzr.Pos += end + len(tag)
+	return STRING, rest[:end]
+}
+
 // scanHex scans a hex numeral; assumes x' or X' has already been scanned
 func (tzr *PsqlTokenizer) scanHex() (int, string) {
 	start := tzr.Pos
@@ -899,7 +937,7 @@ func (tzr *PsqlTokenizer) Reset() {
 }
 
 func isLetter(ch rune) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '$'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
 func isCarat(ch rune) bool {
@@ -50,12 +50,12 @@ type Sqlite3Tokenizer struct {
 	ignoreCommentKeyword bool
 
 	Pos int
-	buf string
+	buf *tokenizer.BytesBuffer
 }
 
 // ResetTo implements tokenizer.Tokenizer.
 func (tkn *Sqlite3Tokenizer) ResetTo(nextPos int) {
-	tkn.buf = strings.Clone(tkn.buf[nextPos:])
+	tkn.buf.ClipFrom(nextPos)
 	tkn.Pos = 0
 }
 
@@ -66,7 +66,7 @@ func (tkn *Sqlite3Tokenizer) GetDialect() dialect.SqlDialect {
 
 // GetText implements tokenizer.Tokenizer.
 func (tkn *Sqlite3Tokenizer) GetText(startPos int) string {
-	return tkn.buf[startPos:tkn.Pos]
+	return tkn.buf.StringAt(startPos, tkn.Pos)
 }
 
 // SetSkipSpecialComments implements tokenizer.Tokenizer.
@@ -199,6 +199,16 @@ var SQLITE3ServerVersion = flag.String("sqlite3_server_version", "", "SQLITE3 se
 // sql string.
 func NewSqlite3StringTokenizer(sql string) *Sqlite3Tokenizer {
 
+	return &Sqlite3Tokenizer{
+		buf:      tokenizer.NewBytesBufferString(sql),
+		BindVars: make(map[string]struct{}),
+	}
+}
+
+// NewBufferedSqlite3StringTokenizer creates a new Tokenizer for the
+// BytesBuffer.
+func NewBufferedSqlite3StringTokenizer(sql *tokenizer.BytesBuffer) *Sqlite3Tokenizer {
+
 	return &Sqlite3Tokenizer{
 		buf:      sql,
 		BindVars: make(map[string]struct{}),
@@ -471,7 +481,7 @@ func (tkn *Sqlite3Tokenizer) scanIdentifier(isVariable bool) (int, string) {
 		}
 		tkn.Skip(1)
 	}
-	keywordName := tkn.buf[start:tkn.Pos]
+	keywordName := tkn.buf.StringAt(start, tkn.Pos)
 	if keywordID, found := cache.KeywordLookup(keywordName, dialect.SQLITE3); found {
 		return keywordID, keywordName
 	}
@@ -486,7 +496,7 @@ func (tkn *Sqlite3Tokenizer) scanIdentifier(isVariable bool) (int, string) {
 func (tkn *Sqlite3Tokenizer) scanHex() (int, string) {
 	start := tkn.Pos
 	tkn.scanMantissa(16)
-	hex := tkn.buf[start:tkn.Pos]
+	hex := tkn.buf.StringAt(start, tkn.Pos)
 	if tkn.Cur() != '\'' {
 		return LEX_ERROR, hex
 	}
@@ -501,7 +511,7 @@ func (tkn *Sqlite3Tokenizer) scanHex() (int, string) {
 func (tkn *Sqlite3Tokenizer) scanBitLiteral() (int, string) {
 	start := tkn.Pos
 	tkn.scanMantissa(2)
-	bit := tkn.buf[start:tkn.Pos]
+	bit := tkn.buf.StringAt(start, tkn.Pos)
 	if tkn.Cur() != '\'' {
 		return LEX_ERROR, bit
 	}
@@ -555,16 +565,16 @@ func (tkn *Sqlite3Tokenizer) scanLiteralIdentifier() (int, string) {
 					return LEX_ERROR, ""
 				}
 				tkn.Skip(1)
-				return ID, tkn.buf[start : tkn.Pos-1]
+				return ID, tkn.buf.StringAt(start, tkn.Pos-1)
 			}
 
 			var buf strings.Builder
-			buf.WriteString(tkn.buf[start:tkn.Pos])
+			buf.WriteString(tkn.buf.StringAt(start, tkn.Pos))
 			tkn.Skip(1)
 			return tkn.scanLiteralIdentifierSlow(&buf)
 		case tokenizer.EofChar:
 			// Premature EOF.
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		default:
 			tkn.Skip(1)
 		}
@@ -582,7 +592,7 @@ func (tkn *Sqlite3Tokenizer) scanBindVar() (int, string) {
 		tkn.Skip(1)
 	}
 	if !isLetter(tkn.Cur()) {
-		return LEX_ERROR, tkn.buf[start:tkn.Pos]
+		return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 	}
 	for {
 		ch := tkn.Cur()
@@ -591,7 +601,7 @@ func (tkn *Sqlite3Tokenizer) scanBindVar() (int, string) {
 		}
 		tkn.Skip(1)
 	}
-	return token, tkn.buf[start:tkn.Pos]
+	return token, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanMantissa scans a sequence of numeric characters with the same base.
@@ -647,7 +657,7 @@ exit:
 	if isLetter(tkn.Cur()) {
 		// A letter cannot immediately follow a float number.
 		if token == FLOAT || token == DECIMAL {
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 		// A letter seen after a few numbers means that we should parse this
 		// as an identifier and not a number.
@@ -658,10 +668,10 @@ exit:
 			}
 			tkn.Skip(1)
 		}
-		return ID, tkn.buf[start:tkn.Pos]
+		return ID, tkn.buf.StringAt(start, tkn.Pos)
 	}
 
-	return token, tkn.buf[start:tkn.Pos]
+	return token, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanString scans a string surrounded by the given `delim`, which can be
@@ -676,17 +686,17 @@ func (tkn *Sqlite3Tokenizer) scanString(delim rune, typ int) (int, string) {
 		case delim:
 			if tkn.Peek(1) != delim {
 				tkn.Skip(1)
-				return typ, tkn.buf[start : tkn.Pos-1]
+				return typ, tkn.buf.StringAt(start, tkn.Pos-1)
 			}
 			fallthrough
 
 		case '\\':
 			var buffer strings.Builder
-			buffer.WriteString(tkn.buf[start:tkn.Pos])
+			buffer.WriteString(tkn.buf.StringAt(start, tkn.Pos))
 			return tkn.scanStringSlow(&buffer, delim, typ)
 
 		case tokenizer.EofChar:
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 
 		tkn.Skip(1)
@@ -707,15 +717,15 @@ func (tkn *Sqlite3Tokenizer) scanStringSlow(buffer *strings.Builder, delim rune,
 		if ch != delim && ch != '\\' {
 			// Scan ahead to the next interesting character.
 			start := tkn.Pos
-			for ; tkn.Pos < len(tkn.buf); tkn.Pos++ {
-				ch = rune(tkn.buf[tkn.Pos])
+			for ; tkn.Pos < tkn.buf.Size(); tkn.Pos++ {
+				ch = tkn.buf.RuneAt(tkn.Pos)
 				if ch == delim || ch == '\\' {
 					break
 				}
 			}
 
-			buffer.WriteString(tkn.buf[start:tkn.Pos])
-			if tkn.Pos >= len(tkn.buf) {
+			buffer.WriteString(tkn.buf.StringAt(start, tkn.Pos))
+			if tkn.Pos >= tkn.buf.Size() {
 				// Reached the end of the buffer without finding a delim or
 				// escape character.
 				tkn.Skip(1)
@@ -758,7 +768,7 @@ func (tkn *Sqlite3Tokenizer) scanCommentType1(prefixLen int) (int, string) {
 		}
 		tkn.Skip(1)
 	}
-	return COMMENT, tkn.buf[start:tkn.Pos]
+	return COMMENT, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanCommentType2 scans a '/*' delimited comment; assumes the opening
@@ -775,11 +785,11 @@ func (tkn *Sqlite3Tokenizer) scanCommentType2() (int, string) {
 			continue
 		}
 		if tkn.Cur() == tokenizer.EofChar {
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 		tkn.Skip(1)
 	}
-	return COMMENT, tkn.buf[start:tkn.Pos]
+	return COMMENT, tkn.buf.StringAt(start, tkn.Pos)
 }
 
 // scanSQLITE3SpecificComment scans a SQLITE3 comment pragma, which always starts with '//*`
@@ -795,12 +805,12 @@ func (tkn *Sqlite3Tokenizer) scanSQLITE3SpecificComment() (int, string) {
 			continue
 		}
 		if tkn.Cur() == tokenizer.EofChar {
-			return LEX_ERROR, tkn.buf[start:tkn.Pos]
+			return LEX_ERROR, tkn.buf.StringAt(start, tkn.Pos)
 		}
 		tkn.Skip(1)
 	}
 
-	commentVersion, sql := ExtractSqlite3Comment(tkn.buf[start:tkn.Pos])
+	commentVersion, sql := ExtractSqlite3Comment(tkn.buf.StringAt(start, tkn.Pos))
 
 	if "1" >= commentVersion {
 		// Only add the special comment to the tokenizer if the version of SQLITE3 is higher or equal to the comment version
@@ -819,10 +829,10 @@ func (tkn *Sqlite3Tokenizer) Skip(dist int) {
 }
 
 func (tkn *Sqlite3Tokenizer) Peek(dist int) rune {
-	if tkn.Pos+dist >= len(tkn.buf) {
+	if tkn.Pos+dist >= tkn.buf.Size() {
 		return tokenizer.EofChar
 	}
-	return rune(tkn.buf[tkn.Pos+dist])
+	return tkn.buf.RuneAt(tkn.Pos + dist)
 }
 
 // Reset clears any internal state.
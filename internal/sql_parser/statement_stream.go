@@ -1,9 +1,13 @@
 package sql_parser
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
 
 	"github.com/usalko/prodl/internal/sql_parser/ast"
 	"github.com/usalko/prodl/internal/sql_parser/dialect"
@@ -16,42 +20,122 @@ const (
 
 var (
 	ErrIncompleteStatement = errors.New("ErrIncompleteStatement")
+
+	// Fallback for COPY statements which the parser doesn't recognize
+	copyFromStdinRegexp = regexp.MustCompile(`(?is)^copy\s.*\sfrom\s+stdin\b`)
 )
 
 type StatementProcessor func(statementText string, statement ast.Statement, parseError error)
 
-// Process text and return position for nextStatement
-// If no valid statements the second parameter return false
-func processText(_tokenizer tokenizer.Tokenizer, processor StatementProcessor) (int, bool) {
+// OffsetHandler receives the byte offset of the end of the processed statement in the input stream,
+// it's the offset for the resume of the stream after the statement
+type OffsetHandler func(endOffset int64)
+
+// CopyFromProcessor receives the COPY ... FROM stdin statement (the statement is *ast.CopyFrom
+// or nil if the statement wasn't parsed) and the reader over its data lines. The data reader
+// yields the lines up to (but not including) the end data mark "\.".
+type CopyFromProcessor func(statementText string, statement ast.Statement, parseError error, data io.Reader)
+
+// StatementError holds the parse error of the statement with the byte offset
+// of the statement in the input stream
+type StatementError struct {
+	Err    error
+	Offset int64
+}
+
+func (statementError StatementError) Error() string {
+	return statementError.Err.Error()
+}
+
+func (statementError StatementError) Unwrap() error {
+	return statementError.Err
+}
+
+// copyFromStatement holds the COPY ... FROM stdin statement found by processText
+type copyFromStatement struct {
+	text       string
+	statement  ast.Statement
+	parseError error
+}
+
+// Check the statement is the COPY ... FROM stdin statement which data follows the statement
+func isCopyFromStdin(statementText string, statement ast.Statement) bool {
+	if copyFrom, ok := statement.(*ast.CopyFrom); ok {
+		return copyFrom.From.Type == ast.CopyFromStdin
+	}
+	if statement == nil {
+		sql, _ := ast.SplitMarginComments(ast.StripLeadingComments(statementText))
+		return copyFromStdinRegexp.MatchString(sql)
+	}
+	return false
+}
+
+// Process text and return position for nextStatement and position for resume of scanning.
+// The resume position is the begin of the last token, which can be incomplete
+// if the text is not complete. If no valid statements the stmtBegin is zero.
+// The processing stops right after the COPY ... FROM stdin statement, the statement
+// returns for processing of data. The bufferOffset is the offset of the tokenizer
+// buffer in the input stream, it is used for the offset of parse errors and statement ends.
+func processText(_tokenizer tokenizer.Tokenizer, processor StatementProcessor, offsetHandler OffsetHandler, bufferOffset int64) (stmtBegin int, resumePos int, copyFrom *copyFromStatement) {
 	var tkn int
-	stmtBegin := 0
-	statementIsEmpty := _tokenizer.GetPos() == 0
+	resumePos = _tokenizer.GetPos()
+	statementIsEmpty := resumePos == 0
 	for {
+		tokenBegin := _tokenizer.GetPos()
 		tkn, _ = _tokenizer.Scan()
 		switch tkn {
 		case ';':
 			if !statementIsEmpty {
 				rawSql := _tokenizer.GetText(stmtBegin)
 				stmt, err := Parse(rawSql, _tokenizer.GetDialect())
+				if err != nil {
+					leadingSpaces := len(rawSql) - len(strings.TrimLeft(rawSql, " \t\r\n"))
+					err = StatementError{Err: err, Offset: bufferOffset + int64(stmtBegin+leadingSpaces)}
+				}
+				if isCopyFromStdin(rawSql, stmt) {
+					return _tokenizer.GetPos(), _tokenizer.GetPos(), &copyFromStatement{rawSql, stmt, err}
+				}
 				processor(rawSql, stmt, err)
+				if offsetHandler != nil {
+					offsetHandler(bufferOffset + int64(_tokenizer.GetPos()))
+				}
 				statementIsEmpty = true
 			}
 			stmtBegin = _tokenizer.GetPos()
+			resumePos = stmtBegin
 		case 0, tokenizer.EofChar:
-			return stmtBegin, stmtBegin > 0
+			return stmtBegin, resumePos, nil
 		default:
 			statementIsEmpty = false
+			resumePos = tokenBegin
 		}
 	}
 }
 
-// StatementStream split input stream into statements and call processor for every statement
+// StatementStream split input stream into statements and call processor for every statement.
+// The COPY ... FROM stdin statement is passed to the processor together with its data.
 func StatementStream(blob io.Reader, sqlDialect dialect.SqlDialect, processor StatementProcessor) error {
+	return StatementStreamWithCopy(blob, sqlDialect, processor, nil)
+}
+
+// StatementStreamWithCopy split input stream into statements and call processor for every statement.
+// The data of COPY ... FROM stdin statements are streamed to the copyProcessor without buffering,
+// if the copyProcessor is nil the statement with data is passed to the processor.
+func StatementStreamWithCopy(blob io.Reader, sqlDialect dialect.SqlDialect, processor StatementProcessor, copyProcessor CopyFromProcessor) error {
+	return StatementStreamWithOffsets(blob, sqlDialect, 0, processor, copyProcessor, nil)
+}
+
+// StatementStreamWithOffsets is StatementStreamWithCopy which reports the end offset of every statement
+// to the offsetHandler. The startOffset is the offset of the blob in the input stream (the blob can start
+// after the skipped statements), the reported offsets and the offsets of parse errors are counted from it.
+func StatementStreamWithOffsets(blob io.Reader, sqlDialect dialect.SqlDialect, startOffset int64, processor StatementProcessor, copyProcessor CopyFromProcessor, offsetHandler OffsetHandler) error {
 	if blob == nil {
 		return fmt.Errorf("blob undefined (nil)")
 	}
+	source := bufio.NewReaderSize(blob, COPY_DATA_BUFFER_SIZE)
 	page := make([]byte, PAGE_SIZE)
 	statementBuffer := tokenizer.BytesBuffer{}
+	readNum := startOffset // offset of the end of bytes read from the source
 
 	_tokenizer, err := NewBufferedTokenizer(&statementBuffer, sqlDialect)
 	if err != nil {
@@ -59,17 +143,167 @@ func StatementStream(blob io.Reader, sqlDialect dialect.SqlDialect, processor St
 	}
 
 	for {
-		n, err := blob.Read(page)
-		if n < PAGE_SIZE || err == io.EOF {
-			statementBuffer.Write(page[:n])
-			processText(_tokenizer, processor)
+		n, err := io.ReadFull(source, page)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("read statements stream fail: %w", err)
+		}
+		statementBuffer.Write(page[:n])
+		readNum += int64(n)
+		eof := err != nil
+
+		for {
+			nextStmtPos, resumePos, copyFrom := processText(_tokenizer, processor, offsetHandler, readNum-int64(statementBuffer.Size()))
+			if copyFrom == nil {
+				// Reset do statementBuffer.ClipFrom(nextStmtPos)
+				_tokenizer.ResetTo(nextStmtPos)
+				_tokenizer.Skip(resumePos - nextStmtPos)
+				break
+			}
+
+			data := &copyDataReader{
+				pending:     bytes.Clone(statementBuffer.Bytes()[nextStmtPos:]),
+				source:      source,
+				skipLine:    true,
+				atLineStart: true,
+			}
+			processCopyData(copyFrom, data, processor, copyProcessor)
+			if _, err := io.Copy(io.Discard, data); err != nil {
+				return fmt.Errorf("read COPY data fail: %w", err)
+			}
+			if data.eof {
+				eof = true
+			}
+			readNum += data.readNum
+			_tokenizer.ResetTo(statementBuffer.Size())
+			statementBuffer.Write(data.pending)
+			if offsetHandler != nil {
+				offsetHandler(readNum - int64(statementBuffer.Size()))
+			}
+		}
+
+		if eof {
 			return nil
 		}
-		statementBuffer.Write(page)
-		nextStmtPos, ok := processText(_tokenizer, processor)
-		if ok {
-			// Reset do statementBuffer.ClipFrom(nextStmtPos)
-			_tokenizer.ResetTo(nextStmtPos)
+	}
+}
+
+func processCopyData(copyFrom *copyFromStatement, data io.Reader, processor StatementProcessor, copyProcessor CopyFromProcessor) {
+	if copyProcessor != nil {
+		copyProcessor(copyFrom.text, copyFrom.statement, copyFrom.parseError, data)
+		return
+	}
+	// Compatibility mode: the statement text contains all the data
+	var statementText strings.Builder
+	statementText.WriteString(copyFrom.text)
+	statementText.WriteByte('\n')
+	if _, err := io.Copy(&statementText, data); err != nil {
+		processor(copyFrom.text, copyFrom.statement, fmt.Errorf("read COPY data fail: %w", err))
+		return
+	}
+	statementText.WriteString("\\.")
+	processor(statementText.String(), copyFrom.statement, copyFrom.parseError)
+}
+
+// copyDataReader reads the data lines of COPY ... FROM stdin statement
+// up to the end data mark "\.". The data is read from the pending bytes
+// (the rest of the statement buffer) then from the source.
+// After the end data mark the unread bytes are left in the pending
+// bytes or in the source.
+type copyDataReader struct {
+	pending     []byte
+	source      *bufio.Reader
+	line        []byte
+	skipLine    bool // skip the rest of the COPY statement line
+	atLineStart bool
+	done        bool
+	eof         bool  // the source is over
+	readNum     int64 // count of bytes read from the source
+}
+
+func (reader *copyDataReader) Read(p []byte) (int, error) {
+	for len(reader.line) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		if err := reader.nextLine(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.line)
+	reader.line = reader.line[n:]
+	return n, nil
+}
+
+// nextLine reads the next line (or a part of the long line) of data
+func (reader *copyDataReader) nextLine() error {
+	var line []byte
+	if i := bytes.IndexByte(reader.pending, '\n'); i >= 0 {
+		line = reader.pending[:i+1]
+		reader.pending = reader.pending[i+1:]
+	} else {
+		sourceLine, err := reader.source.ReadSlice('\n')
+		reader.readNum += int64(len(sourceLine))
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			reader.eof = true
+		}
+		if len(reader.pending) > 0 {
+			line = append(reader.pending, sourceLine...)
+			reader.pending = nil
+		} else {
+			line = sourceLine
+		}
+		if len(line) == 0 && reader.eof {
+			reader.done = true
+			return nil
 		}
 	}
+
+	atLineStart := reader.atLineStart
+	reader.atLineStart = line[len(line)-1] == '\n'
+	if reader.skipLine {
+		reader.skipLine = !reader.atLineStart
+		return nil
+	}
+	if atLineStart && isEndDataMark(line) {
+		reader.done = true
+		return nil
+	}
+	reader.line = line
+	return nil
+}
+
+// Check the line is the end data mark "\."
+func isEndDataMark(line []byte) bool {
+	return bytes.Equal(bytes.TrimRight(line, " \t\r\n"), []byte("\\."))
+}
+
+// CopyDataRowCounter counts the rows of COPY ... FROM stdin data read through it
+type CopyDataRowCounter struct {
+	data     io.Reader
+	rows     uint64
+	lastByte byte
+}
+
+func NewCopyDataRowCounter(data io.Reader) *CopyDataRowCounter {
+	return &CopyDataRowCounter{data: data}
+}
+
+func (counter *CopyDataRowCounter) Read(p []byte) (int, error) {
+	n, err := counter.data.Read(p)
+	if n > 0 {
+		counter.rows += uint64(bytes.Count(p[:n], []byte{'\n'}))
+		counter.lastByte = p[n-1]
+	}
+	return n, err
+}
+
+// Rows returns the count of rows read, the last row can be without the line end
+func (counter *CopyDataRowCounter) Rows() uint64 {
+	if counter.lastByte != 0 && counter.lastByte != '\n' {
+		return counter.rows + 1
+	}
+	return counter.rows
 }
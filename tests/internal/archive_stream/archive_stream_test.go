@@ -3,12 +3,16 @@ package archive_stream_tests
 import (
 	"archive/zip"
 	"bytes"
+	"compress/flate"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
 	"os"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 	"github.com/usalko/prodl/internal/archive_stream"
 )
 
@@ -151,3 +155,230 @@ func TestNewReader(t *testing.T) {
 	}
 
 }
+
+func TestTarReader(t *testing.T) {
+	for _, fileName := range []string{"test_data/testing.tar", "test_data/testing.tar.gz"} {
+		f, err := os.Open(fileName)
+		check(err, "File %s open error", fileName)
+		defer f.Close()
+
+		reader := archive_stream.NewReader(f)
+
+		names := make([]string, 0)
+		contents := make([]string, 0)
+		for {
+			entry, err := reader.GetNextEntry()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unable to get next entry of %s: %s", fileName, err)
+			}
+			if _, ok := entry.(*archive_stream.TarEntry); !ok {
+				t.Fatalf("entry of %s is not a tar entry", fileName)
+			}
+			if entry.IsDir() {
+				t.Fatalf("unexpected directory entry %s", entry.GetName())
+			}
+
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatalf("open tar file entry err: %s", err)
+			}
+			content, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("read entry file contents fail: %s", err)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatalf("close tar file entry reader err: %s", err)
+			}
+			names = append(names, entry.GetName())
+			contents = append(contents, string(content))
+		}
+
+		expectedNames := []string{"dump/01_a.sql", "dump/nested/02_b.sql"}
+		if fmt.Sprint(names) != fmt.Sprint(expectedNames) {
+			t.Fatalf("entries of %s are %v but expected %v", fileName, names, expectedNames)
+		}
+		expectedContents := []string{"CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\n", "CREATE TABLE b (id int);\n"}
+		if fmt.Sprint(contents) != fmt.Sprint(expectedContents) {
+			t.Fatalf("contents of %s are %q but expected %q", fileName, contents, expectedContents)
+		}
+	}
+}
+
+func TestTarReaderSkipUnreadData(t *testing.T) {
+	f, err := os.Open("test_data/testing.tar.gz")
+	check(err)
+	defer f.Close()
+
+	reader := archive_stream.NewReader(f)
+
+	count := 0
+	for {
+		_, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("count of entries is %v but expected %v", count, 2)
+	}
+}
+
+func TestCompressedStreamReader(t *testing.T) {
+	expectedContent, err := os.ReadFile("test_data/testing.txt")
+	check(err)
+
+	for _, fileName := range []string{
+		"test_data/testing.txt.zst",
+		"test_data/testing.txt.xz",
+		"test_data/testing.txt.bz2",
+		"test_data/testing.txt.lz4",
+		"test_data/testing.txt.bzip2.zip",
+	} {
+		f, err := os.Open(fileName)
+		check(err, "File %s open error", fileName)
+		defer f.Close()
+
+		reader := archive_stream.NewReader(f)
+
+		count := 0
+		for {
+			entry, err := reader.GetNextEntry()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unable to get next entry of %s: %s", fileName, err)
+			}
+			count++
+
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatalf("open entry of %s err: %s", fileName, err)
+			}
+			content, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("read entry of %s fail: %s", fileName, err)
+			}
+			if !bytes.Equal(content, expectedContent) {
+				t.Fatalf("the entry contents of %s is incorrect: %q", fileName, content)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatalf("close entry reader of %s err: %s", fileName, err)
+			}
+		}
+		if count != 1 {
+			t.Fatalf("count of entries of %s is %v but expected %v", fileName, count, 1)
+		}
+	}
+}
+
+func TestCompressedTarReader(t *testing.T) {
+	f, err := os.Open("test_data/testing.tar.zst")
+	check(err)
+	defer f.Close()
+
+	reader := archive_stream.NewReader(f)
+
+	names := make([]string, 0)
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		names = append(names, entry.GetName())
+	}
+
+	expectedNames := []string{"dump/01_a.sql", "dump/nested/02_b.sql"}
+	if fmt.Sprint(names) != fmt.Sprint(expectedNames) {
+		t.Fatalf("entries are %v but expected %v", names, expectedNames)
+	}
+}
+
+func TestZipCompressionMethods(t *testing.T) {
+	content := bytes.Repeat([]byte("INSERT INTO a VALUES (1);\n"), 100)
+
+	compressors := map[uint16]func(w io.Writer) (io.WriteCloser, error){
+		zip.Deflate: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		},
+		archive_stream.CompressMethodZstd: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		archive_stream.CompressMethodXz: func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+	}
+	methods := map[string]uint16{
+		"deflate.sql": zip.Deflate,
+		"zstd.sql":    archive_stream.CompressMethodZstd,
+		"xz.sql":      archive_stream.CompressMethodXz,
+	}
+
+	// The local file headers contain the sizes (without data descriptors)
+	var zipFile bytes.Buffer
+	zipWriter := zip.NewWriter(&zipFile)
+	for _, name := range []string{"deflate.sql", "zstd.sql", "xz.sql"} {
+		var compressed bytes.Buffer
+		compressor, err := compressors[methods[name]](&compressed)
+		check(err)
+		_, err = compressor.Write(content)
+		check(err)
+		check(compressor.Close())
+
+		w, err := zipWriter.CreateRaw(&zip.FileHeader{
+			Name:               name,
+			Method:             methods[name],
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: uint64(len(content)),
+		})
+		check(err)
+		_, err = w.Write(compressed.Bytes())
+		check(err)
+	}
+	check(zipWriter.Close())
+
+	reader := archive_stream.NewReader(bytes.NewReader(zipFile.Bytes()))
+
+	names := make([]string, 0)
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		names = append(names, entry.GetName())
+
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("open zip file entry %s err: %s", entry.GetName(), err)
+		}
+		entryContent, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("read zip file entry %s fail: %s", entry.GetName(), err)
+		}
+		if !bytes.Equal(entryContent, content) {
+			t.Fatalf("the zip entry %s contents is incorrect", entry.GetName())
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatalf("close zip file entry %s reader err: %s", entry.GetName(), err)
+		}
+	}
+
+	expectedNames := []string{"deflate.sql", "zstd.sql", "xz.sql"}
+	if fmt.Sprint(names) != fmt.Sprint(expectedNames) {
+		t.Fatalf("entries are %v but expected %v", names, expectedNames)
+	}
+}
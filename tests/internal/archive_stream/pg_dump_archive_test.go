@@ -0,0 +1,338 @@
+package archive_stream_tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+)
+
+// pgDumpWriter writes pg_dump custom format archive (see pg_backup_archiver.c)
+type pgDumpWriter struct {
+	bytes.Buffer
+	intSize int
+}
+
+func (writer *pgDumpWriter) writeInt(value int) {
+	if value < 0 {
+		writer.WriteByte(1)
+		value = -value
+	} else {
+		writer.WriteByte(0)
+	}
+	for i := 0; i < writer.intSize; i++ {
+		writer.WriteByte(byte(value >> (8 * i)))
+	}
+}
+
+func (writer *pgDumpWriter) writeString(value string) {
+	writer.writeInt(len(value))
+	writer.WriteString(value)
+}
+
+func (writer *pgDumpWriter) writeNull() {
+	writer.writeInt(-1)
+}
+
+type testTocEntry struct {
+	dumpId    int
+	tag       string
+	desc      string
+	section   int
+	defn      string
+	copyStmt  string
+	namespace string
+	data      string
+	noData    bool // the data is excluded from the dump
+}
+
+const (
+	testPgDumpFormatCustom    = 1
+	testPgDumpFormatDirectory = 3
+)
+
+func writePgDumpToc(vmin int, format byte, compressed bool, toc []testTocEntry) *pgDumpWriter {
+	writer := &pgDumpWriter{intSize: 4}
+	writer.WriteString("PGDMP")
+	writer.Write([]byte{1, byte(vmin), 0, byte(writer.intSize), 8, format}) // version, int size, offset size, format
+	if vmin >= 15 {
+		if compressed {
+			writer.WriteByte(1) // gzip
+		} else {
+			writer.WriteByte(0) // none
+		}
+	} else {
+		if compressed {
+			writer.writeInt(-1) // default compression level
+		} else {
+			writer.writeInt(0)
+		}
+	}
+	for _, value := range []int{5, 4, 3, 2, 1, 124, 0} { // 2024-02-02 03:04:05
+		writer.writeInt(value)
+	}
+	writer.writeString("phytonyms")
+	writer.writeString("16.2")
+	writer.writeString("16.2")
+
+	writer.writeInt(len(toc))
+	for _, tocEntry := range toc {
+		writer.writeInt(tocEntry.dumpId)
+		if tocEntry.data != "" || tocEntry.noData {
+			writer.writeInt(1)
+		} else {
+			writer.writeInt(0)
+		}
+		writer.writeString("0")
+		writer.writeString("0")
+		writer.writeString(tocEntry.tag)
+		writer.writeString(tocEntry.desc)
+		writer.writeInt(tocEntry.section)
+		writer.writeString(tocEntry.defn)
+		writer.writeString("")
+		writer.writeString(tocEntry.copyStmt)
+		writer.writeString(tocEntry.namespace)
+		writer.writeString("")
+		if vmin >= 14 {
+			writer.writeString("")
+		}
+		if vmin >= 16 {
+			writer.writeInt('r')
+		}
+		writer.writeString("postgres")
+		writer.writeString("false")
+		writer.writeNull() // no dependencies
+		if format == testPgDumpFormatDirectory {
+			// data file name
+			if tocEntry.data != "" {
+				writer.writeString(fmt.Sprintf("%d.dat", tocEntry.dumpId))
+			} else {
+				writer.writeString("")
+			}
+			continue
+		}
+		// data offset
+		if tocEntry.data != "" {
+			writer.WriteByte(1)
+		} else {
+			writer.WriteByte(3)
+		}
+		writer.Write(make([]byte, 8))
+	}
+	return writer
+}
+
+func writePgDump(vmin int, compressed bool, toc []testTocEntry) []byte {
+	writer := writePgDumpToc(vmin, testPgDumpFormatCustom, compressed, toc)
+
+	for _, tocEntry := range toc {
+		if tocEntry.data == "" {
+			continue
+		}
+		writer.WriteByte(1) // data block
+		writer.writeInt(tocEntry.dumpId)
+		data := []byte(tocEntry.data)
+		if compressed {
+			var compressedData bytes.Buffer
+			zlibWriter := zlib.NewWriter(&compressedData)
+			zlibWriter.Write(data)
+			zlibWriter.Close()
+			data = compressedData.Bytes()
+		}
+		// write data by chunks of 7 bytes
+		for len(data) > 0 {
+			chunk := data[:min(len(data), 7)]
+			data = data[len(chunk):]
+			writer.writeInt(len(chunk))
+			writer.Write(chunk)
+		}
+		writer.writeInt(0)
+	}
+	return writer.Bytes()
+}
+
+var testPgDumpToc = []testTocEntry{
+	{dumpId: 3371, tag: "ENCODING", desc: "ENCODING", section: 2, defn: "SET client_encoding = 'UTF8';\n"},
+	{dumpId: 3372, tag: "phytonyms", desc: "DATABASE", section: 2, defn: "CREATE DATABASE phytonyms;\n"},
+	{dumpId: 3373, tag: "SCHEMA public", desc: "ACL", section: 1, defn: "GRANT ALL ON SCHEMA public TO PUBLIC;\n"},
+	{dumpId: 214, tag: "a", desc: "TABLE", section: 2, namespace: "public", defn: "CREATE TABLE public.a (\n    id bigint NOT NULL,\n    title text\n);\n"},
+	{dumpId: 215, tag: "b", desc: "TABLE", section: 2, namespace: "public", defn: "CREATE TABLE public.b (\n    id bigint NOT NULL\n);\n"},
+	{dumpId: 3360, tag: "a", desc: "TABLE DATA", section: 3, namespace: "public", copyStmt: "COPY public.a (id, title) FROM stdin;\n", data: "1\tfirst title\n2\tsecond title\n\\.\n\n\n"},
+	{dumpId: 3361, tag: "b", desc: "TABLE DATA", section: 3, namespace: "public", copyStmt: "COPY public.b (id) FROM stdin;\n", noData: true},
+	{dumpId: 3362, tag: "b", desc: "TABLE DATA", section: 3, namespace: "public", copyStmt: "COPY public.b (id) FROM stdin;\n", data: "1\n\\.\n\n\n"},
+	{dumpId: 3215, tag: "a a_pkey", desc: "CONSTRAINT", section: 4, namespace: "public", defn: "ALTER TABLE ONLY public.a\n    ADD CONSTRAINT a_pkey PRIMARY KEY (id);\n"},
+}
+
+var testPgDumpEntries = []string{
+	"3371; ENCODING - ENCODING",
+	"214; TABLE public a",
+	"215; TABLE public b",
+	"3360; TABLE DATA public a",
+	"3362; TABLE DATA public b",
+	"3215; CONSTRAINT public a a_pkey",
+	"3373; ACL - SCHEMA public",
+}
+
+func TestPgDumpReader(t *testing.T) {
+	for _, testCase := range []struct {
+		vmin       int
+		compressed bool
+	}{{14, true}, {14, false}, {15, true}, {16, false}} {
+		archive := writePgDump(testCase.vmin, testCase.compressed, testPgDumpToc)
+		reader := archive_stream.NewReader(bytes.NewReader(archive))
+
+		names := make([]string, 0)
+		contents := make(map[string]string)
+		for {
+			entry, err := reader.GetNextEntry()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unable to get next entry of archive 1.%v: %s", testCase.vmin, err)
+			}
+			names = append(names, entry.GetName())
+
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatalf("open entry %s err: %s", entry.GetName(), err)
+			}
+			content, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("read entry %s fail: %s", entry.GetName(), err)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatalf("close entry %s reader err: %s", entry.GetName(), err)
+			}
+			contents[entry.GetName()] = string(content)
+		}
+
+		if fmt.Sprint(names) != fmt.Sprint(testPgDumpEntries) {
+			t.Fatalf("entries of archive 1.%v are %q but expected %q", testCase.vmin, names, testPgDumpEntries)
+		}
+		expectedContent := "COPY public.a (id, title) FROM stdin;\n1\tfirst title\n2\tsecond title\n\\.\n\n\n"
+		if contents["3360; TABLE DATA public a"] != expectedContent {
+			t.Fatalf("content of table data is %q but expected %q", contents["3360; TABLE DATA public a"], expectedContent)
+		}
+		expectedContent = "CREATE TABLE public.b (\n    id bigint NOT NULL\n);\n"
+		if contents["215; TABLE public b"] != expectedContent {
+			t.Fatalf("content of table is %q but expected %q", contents["215; TABLE public b"], expectedContent)
+		}
+	}
+}
+
+func TestPgDumpReaderSkipUnreadData(t *testing.T) {
+	archive := writePgDump(15, true, testPgDumpToc)
+	reader := archive_stream.NewReader(bytes.NewReader(archive))
+
+	names := make([]string, 0)
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		names = append(names, entry.GetName())
+		if entry.GetName() == "3362; TABLE DATA public b" {
+			// Read the part of data only
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatalf("open entry %s err: %s", entry.GetName(), err)
+			}
+			if _, err := rc.Read(make([]byte, 3)); err != nil {
+				t.Fatalf("read entry %s fail: %s", entry.GetName(), err)
+			}
+		}
+	}
+
+	if fmt.Sprint(names) != fmt.Sprint(testPgDumpEntries) {
+		t.Fatalf("entries are %q but expected %q", names, testPgDumpEntries)
+	}
+}
+
+func TestPgDumpReaderInsideGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(writePgDump(16, false, testPgDumpToc))
+	gzipWriter.Close()
+
+	reader := archive_stream.NewReader(&compressed)
+
+	count := 0
+	for {
+		_, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		count++
+	}
+	if count != len(testPgDumpEntries) {
+		t.Fatalf("count of entries is %v but expected %v", count, len(testPgDumpEntries))
+	}
+}
+
+func TestPgDumpDirectoryReader(t *testing.T) {
+	dirName := t.TempDir()
+	tocFile := writePgDumpToc(16, testPgDumpFormatDirectory, true, testPgDumpToc)
+	check(os.WriteFile(filepath.Join(dirName, "toc.dat"), tocFile.Bytes(), 0644))
+	for _, tocEntry := range testPgDumpToc {
+		if tocEntry.data == "" {
+			continue
+		}
+		var compressed bytes.Buffer
+		gzipWriter := gzip.NewWriter(&compressed)
+		gzipWriter.Write([]byte(tocEntry.data))
+		gzipWriter.Close()
+		check(os.WriteFile(filepath.Join(dirName, fmt.Sprintf("%d.dat.gz", tocEntry.dumpId)), compressed.Bytes(), 0644))
+	}
+
+	reader, err := archive_stream.NewPgDumpDirectoryReader(dirName)
+	if err != nil {
+		t.Fatalf("open pg_dump directory fail: %s", err)
+	}
+
+	names := make([]string, 0)
+	contents := make(map[string]string)
+	for {
+		entry, err := reader.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		names = append(names, entry.GetName())
+
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("open entry %s err: %s", entry.GetName(), err)
+		}
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("read entry %s fail: %s", entry.GetName(), err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatalf("close entry %s reader err: %s", entry.GetName(), err)
+		}
+		contents[entry.GetName()] = string(content)
+	}
+
+	if fmt.Sprint(names) != fmt.Sprint(testPgDumpEntries) {
+		t.Fatalf("entries are %q but expected %q", names, testPgDumpEntries)
+	}
+	expectedContent := "COPY public.b (id) FROM stdin;\n1\n\\.\n\n\n"
+	if contents["3362; TABLE DATA public b"] != expectedContent {
+		t.Fatalf("content of table data is %q but expected %q", contents["3362; TABLE DATA public b"], expectedContent)
+	}
+}
@@ -0,0 +1,157 @@
+package dump_extractor_tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/dump_extractor"
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+const testDump = `SET client_encoding = 'UTF8';
+CREATE TABLE public.orders (id integer, customer text, total numeric);
+CREATE TABLE public.items (id integer);
+INSERT INTO public.orders VALUES (1, 'it''s me', -2.5);
+INSERT INTO public.orders (total, id) VALUES (3, 2), (null, 3);
+INSERT INTO public.items VALUES (1);
+COPY public.orders (id, customer, total) FROM stdin;
+4	tab\there	10
+5	\N	\x41\101
+\.
+INSERT INTO public.orders VALUES (6, now(), true);
+`
+
+func extract(t *testing.T, format dump_extractor.ExtractFormat) (*dump_extractor.Extractor, string) {
+	var archive bytes.Buffer
+	writer := gzip.NewWriter(&archive)
+	writer.Name = "dump.sql"
+	_, err := writer.Write([]byte(testDump))
+	check(err, "write gzip fail")
+	check(writer.Close(), "close gzip fail")
+
+	filter, err := dump_rewriter.NewTableFilter([]string{"order%"}, nil, dialect.PSQL)
+	check(err)
+	outputDir := t.TempDir()
+	extractor := dump_extractor.NewExtractor(dialect.PSQL, filter, format, outputDir)
+	check(extractor.Extract(archive_stream.NewReader(&archive)), "extract fail")
+	check(extractor.Close(), "close fail")
+	return extractor, outputDir
+}
+
+func TestExtractCsv(t *testing.T) {
+	extractor, outputDir := extract(t, dump_extractor.CSV_FORMAT)
+	if tables := extractor.Tables(); !slices.Equal(tables, []string{"public.orders"}) {
+		t.Fatalf("extracted tables are %v", tables)
+	}
+	if rows := extractor.Rows("public.orders"); rows != 6 {
+		t.Errorf("count of rows is %v but expected %v", rows, 6)
+	}
+	content, err := os.ReadFile(filepath.Join(outputDir, "public.orders.csv"))
+	check(err)
+	// The columns of INSERT and COPY statements are ordered by the header of CREATE TABLE
+	expected := "id,customer,total\n" +
+		"1,it's me,-2.5\n" +
+		"2,,3\n" +
+		"3,,\n" +
+		"4,tab\there,10\n" +
+		"5,,AA\n" +
+		"6,now(),1\n"
+	if string(content) != expected {
+		t.Errorf("csv file is\n%q\nbut expected\n%q", content, expected)
+	}
+}
+
+func TestExtractJsonl(t *testing.T) {
+	_, outputDir := extract(t, dump_extractor.JSONL_FORMAT)
+	content, err := os.ReadFile(filepath.Join(outputDir, "public.orders.jsonl"))
+	check(err)
+	// The type of numeric column isn't known, the value of COPY data is the string
+	expected := `{"id":1,"customer":"it's me","total":-2.5}` + "\n" +
+		`{"id":2,"customer":null,"total":3}` + "\n" +
+		`{"id":3,"customer":null,"total":null}` + "\n" +
+		`{"id":4,"customer":"tab\there","total":"10"}` + "\n" +
+		`{"id":5,"customer":null,"total":"AA"}` + "\n" +
+		`{"id":6,"customer":"now()","total":1}` + "\n"
+	if string(content) != expected {
+		t.Errorf("jsonl file is\n%s\nbut expected\n%s", content, expected)
+	}
+}
+
+func TestExtractMysqlHeader(t *testing.T) {
+	var archive bytes.Buffer
+	writer := gzip.NewWriter(&archive)
+	_, err := writer.Write([]byte("CREATE TABLE `orders` (`id` int, `customer` varchar(10), `total` int);\n" +
+		"INSERT INTO `orders` (`total`, `id`) VALUES (3, 2);\n" +
+		"INSERT INTO `orders` VALUES (1, _binary 'x', 0x41);\n" +
+		"INSERT INTO `logs` VALUES (1, 'a');\n"))
+	check(err)
+	check(writer.Close())
+
+	outputDir := t.TempDir()
+	extractor := dump_extractor.NewExtractor(dialect.MYSQL, nil, dump_extractor.CSV_FORMAT, outputDir)
+	check(extractor.Extract(archive_stream.NewReader(&archive)), "extract fail")
+	check(extractor.Close(), "close fail")
+	content, err := os.ReadFile(filepath.Join(outputDir, "orders.csv"))
+	check(err)
+	expected := "id,customer,total\n2,,3\n1,x,A\n"
+	if string(content) != expected {
+		t.Errorf("csv file is\n%q\nbut expected\n%q", content, expected)
+	}
+	// The table isn't created in the dump
+	content, err = os.ReadFile(filepath.Join(outputDir, "logs.csv"))
+	check(err)
+	if expected := "column1,column2\n1,a\n"; string(content) != expected {
+		t.Errorf("csv file is\n%q\nbut expected\n%q", content, expected)
+	}
+}
+
+func TestParseExtractFormat(t *testing.T) {
+	if format, err := dump_extractor.ParseExtractFormat("JSONL"); err != nil || format != dump_extractor.JSONL_FORMAT {
+		t.Errorf("format JSONL is parsed to %v (%v)", format, err)
+	}
+	if _, err := dump_extractor.ParseExtractFormat("xml"); err == nil {
+		t.Errorf("format xml is accepted")
+	}
+}
+
+func TestExtractParseErrors(t *testing.T) {
+	var archive bytes.Buffer
+	writer := gzip.NewWriter(&archive)
+	_, err := writer.Write([]byte("CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA public;\n" +
+		"CREATE FUNCTION public.f() RETURNS integer LANGUAGE sql AS $$ SELECT 1 $$;\n" +
+		"CREATE TABLE public.orders (id integer);\n" +
+		"INSERT INTO public.orders VALUES (1;\n" +
+		"INSERT INTO public.orders VALUES (2);\n"))
+	check(err)
+	check(writer.Close())
+
+	extractor := dump_extractor.NewExtractor(dialect.PSQL, nil, dump_extractor.CSV_FORMAT, t.TempDir())
+	check(extractor.Extract(archive_stream.NewReader(&archive)), "extract fail")
+	check(extractor.Close(), "close fail")
+	// The statements without the rows aren't counted
+	if parseErrors := extractor.ParseErrors(); parseErrors != 1 {
+		t.Errorf("count of parse errors is %v but expected %v", parseErrors, 1)
+	}
+	if rows := extractor.Rows("public.orders"); rows != 1 {
+		t.Errorf("count of rows is %v but expected %v", rows, 1)
+	}
+}
@@ -0,0 +1,117 @@
+package dump_inspector_tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/dump_inspector"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+const testDump = `SET client_encoding = 'UTF8';
+CREATE TABLE public.a (id integer, name text);
+CREATE TABLE b (id integer);
+INSERT INTO public.a VALUES (1, 'one'), (2, 'two');
+INSERT INTO b VALUES (1);
+COPY public.a (id, name) FROM stdin;
+3	three
+4	four
+5	five
+\.
+CREATE TRIGGER t AFTER INSERT ON b FOR EACH ROW EXECUTE FUNCTION f();
+SELECT 1;
+`
+
+func TestInspect(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var archive bytes.Buffer
+	writer := gzip.NewWriter(&archive)
+	writer.Name = "dump.sql"
+	writer.ModTime = modified
+	_, err := writer.Write([]byte(testDump))
+	check(err, "write gzip fail")
+	check(writer.Close(), "close gzip fail")
+
+	reports, err := dump_inspector.Inspect(archive_stream.NewReader(&archive), dialect.PSQL)
+	check(err, "inspect fail")
+
+	if len(reports) != 1 {
+		t.Fatalf("count of entries is %v but expected %v", len(reports), 1)
+	}
+	report := reports[0]
+	if report.Name != "dump.sql" {
+		t.Errorf("entry name is %v but expected %v", report.Name, "dump.sql")
+	}
+	if report.Size != uint64(len(testDump)) {
+		t.Errorf("entry size is %v but expected %v", report.Size, len(testDump))
+	}
+	if !report.Modified.Equal(modified) {
+		t.Errorf("entry modification time is %v but expected %v", report.Modified, modified)
+	}
+
+	expectedTypes := map[string]int{"SET": 1, "DDL": 2, "INSERT": 2, "COPY": 1, "SELECT": 1}
+	for statementType, count := range expectedTypes {
+		if report.StatementTypes[statementType] != count {
+			t.Errorf("count of %v statements is %v but expected %v", statementType, report.StatementTypes[statementType], count)
+		}
+	}
+	expectedTables := []string{"public.a", "b"}
+	if !slices.Equal(report.Tables, expectedTables) {
+		t.Errorf("tables are %v but expected %v", report.Tables, expectedTables)
+	}
+	expectedRows := map[string]uint64{"public.a": 5, "b": 1}
+	for table, count := range expectedRows {
+		if report.Rows[table] != count {
+			t.Errorf("count of rows for table %v is %v but expected %v", table, report.Rows[table], count)
+		}
+	}
+	if len(report.ParseErrors) != 1 {
+		t.Fatalf("count of parse errors is %v but expected %v", len(report.ParseErrors), 1)
+	}
+	expectedOffset := int64(strings.Index(testDump, "CREATE TRIGGER"))
+	if report.ParseErrors[0].Offset != expectedOffset {
+		t.Errorf("offset of parse error is %v but expected %v", report.ParseErrors[0].Offset, expectedOffset)
+	}
+}
+
+func TestInspectTar(t *testing.T) {
+	fileName := "../archive_stream/test_data/testing.tar.gz"
+	respBody, err := os.Open(fileName)
+	check(err, "File %s open error", fileName)
+	defer respBody.Close()
+
+	reports, err := dump_inspector.Inspect(archive_stream.NewReader(respBody), dialect.PSQL)
+	check(err, "inspect fail")
+
+	expectedNames := []string{"dump/01_a.sql", "dump/nested/02_b.sql"}
+	if len(reports) != len(expectedNames) {
+		t.Fatalf("count of entries is %v but expected %v", len(reports), len(expectedNames))
+	}
+	for i, report := range reports {
+		if report.Name != expectedNames[i] {
+			t.Errorf("entry name is %v but expected %v", report.Name, expectedNames[i])
+		}
+		if report.Modified.IsZero() {
+			t.Errorf("entry %v has no modification time", report.Name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package dump_rewriter_tests
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func newMasker(t *testing.T, sqlDialect dialect.SqlDialect) *dump_rewriter.DataMasker {
+	fixed := "redacted"
+	masker, err := dump_rewriter.NewDataMasker(&dump_rewriter.MaskRules{
+		Secret: "test",
+		Columns: map[string]dump_rewriter.MaskRule{
+			"users.id":       {Strategy: dump_rewriter.TOKEN_MASK},
+			"users.email":    {Strategy: dump_rewriter.EMAIL_MASK},
+			"users.name":     {Strategy: dump_rewriter.NAME_MASK},
+			"users.phone":    {Strategy: dump_rewriter.DIGITS_MASK},
+			"users.note":     {Strategy: dump_rewriter.FIXED_MASK, Value: &fixed},
+			"users.ssn":      {Strategy: dump_rewriter.NULL_MASK},
+			"users.password": {Strategy: dump_rewriter.HASH_MASK},
+			"orders.user_id": {Strategy: dump_rewriter.TOKEN_MASK},
+		},
+	}, sqlDialect)
+	check(err)
+	return masker
+}
+
+func mask(masker *dump_rewriter.DataMasker, sql string, sqlDialect dialect.SqlDialect) (string, error) {
+	text, _, err := masker.Mask(sql, parse(sql, sqlDialect))
+	return text, err
+}
+
+func TestDataMaskerInsert(t *testing.T) {
+	masker := newMasker(t, dialect.MYSQL)
+	createTable := "CREATE TABLE `users` (`id` int, `email` varchar(64), `name` varchar(64), `phone` varchar(20), " +
+		"`note` text, `ssn` varchar(11), `password` varchar(64), `age` int)"
+	if text, err := mask(masker, createTable, dialect.MYSQL); err != nil || text != createTable {
+		t.Fatalf("create table is masked to %v (%v)", text, err)
+	}
+
+	masked, err := mask(masker, "INSERT INTO `users` VALUES (42,'a@b.c','John Smith','+1 (555) 010-99','note',NULL,'secret',30)", dialect.MYSQL)
+	check(err)
+	expected := regexp.MustCompile(`^insert into users values \((\d\d), 'user_[0-9a-f]{24}@example\.com', '[A-Z][a-z]+ [A-Z][a-z]+', ` +
+		`'\+[1-9] \([1-9]\d\d\) [0-9]\d\d-[1-9]\d', 'redacted', null, '[0-9a-f]{32}', 30\)$`)
+	matches := expected.FindStringSubmatch(masked)
+	if matches == nil {
+		t.Fatalf("insert is masked to %v", masked)
+	}
+	if matches[1] == "42" || strings.Contains(masked, "555") {
+		t.Errorf("values aren't masked: %v", masked)
+	}
+
+	// The foreign key is masked by the same token as the primary key
+	token := matches[1]
+	masked, err = mask(masker, "INSERT INTO `orders` (`id`, `user_id`) VALUES (1, 42), (2, NULL)", dialect.MYSQL)
+	check(err)
+	if expected := "insert into orders(id, user_id) values (1, " + token + "), (2, null)"; masked != expected {
+		t.Errorf("insert is masked to %v but expected %v", masked, expected)
+	}
+
+	// The masked values are the same for the same secret
+	again, err := mask(newMasker(t, dialect.MYSQL), "INSERT INTO `orders` (`user_id`) VALUES (42)", dialect.MYSQL)
+	check(err)
+	if again != "insert into orders(user_id) values ("+token+")" {
+		t.Errorf("token differs: %v", again)
+	}
+
+	// The columns of the table aren't known
+	if _, err := mask(newMasker(t, dialect.MYSQL), "INSERT INTO `users` VALUES (1, 'a@b.c')", dialect.MYSQL); err == nil {
+		t.Errorf("insert without columns is masked")
+	}
+	if text, err := mask(masker, "INSERT INTO `items` VALUES (1, 'x')", dialect.MYSQL); err != nil || text != "INSERT INTO `items` VALUES (1, 'x')" {
+		t.Errorf("insert into table without rules is masked to %v (%v)", text, err)
+	}
+	if _, _, err := masker.Mask("INSERT INTO users VALUES (1, 'x' ", nil); err == nil {
+		t.Errorf("insert which isn't parsed is accepted")
+	}
+}
+
+func TestDataMaskerCopy(t *testing.T) {
+	masker := newMasker(t, dialect.PSQL)
+	copyFrom := "COPY public.users (note, id, phone, age) FROM stdin;"
+	data, err := masker.MaskCopyData(copyFrom, parse(copyFrom, dialect.PSQL), strings.NewReader(
+		"tab\\there\t42\t555-01\t\\x41\n"+
+			"x\t\\N\t\\N\t7"))
+	check(err)
+	content, err := io.ReadAll(data)
+	check(err)
+	lines := strings.Split(string(content), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("masked data is %q", content)
+	}
+	fields := strings.Split(lines[0], "\t")
+	if len(fields) != 4 || fields[0] != "redacted" || len(fields[1]) != 2 || fields[1] == "42" ||
+		!regexp.MustCompile(`^[1-9]\d\d-\d\d$`).MatchString(fields[2]) || fields[3] != "\\x41" {
+		t.Errorf("masked line is %q", lines[0])
+	}
+	if lines[1] != "redacted\t\\N\t\\N\t7" {
+		t.Errorf("masked line is %q", lines[1])
+	}
+
+	// The token of COPY data is the token of INSERT
+	masked, err := mask(masker, "INSERT INTO orders (user_id) VALUES (42)", dialect.PSQL)
+	check(err)
+	if expected := "insert into orders(user_id) values (" + fields[1] + ")"; masked != expected {
+		t.Errorf("insert is masked to %v but expected %v", masked, expected)
+	}
+
+	copyFrom = "COPY public.items (id) FROM stdin;"
+	source := strings.NewReader("1\n")
+	if data, err := masker.MaskCopyData(copyFrom, parse(copyFrom, dialect.PSQL), source); err != nil || data != io.Reader(source) {
+		t.Errorf("data of table without rules is masked (%v)", err)
+	}
+}
+
+func TestDataMaskerTokenIsUnique(t *testing.T) {
+	masker := newMasker(t, dialect.PSQL)
+	tokens := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		statement := ast.Statement(&ast.Insert{
+			Table:   ast.TableName{Name: ast.NewTableIdent("orders")},
+			Columns: ast.Columns{ast.NewColIdent("user_id")},
+			Rows:    ast.Values{ast.ValTuple{ast.NewIntLiteral(strconv.Itoa(i))}},
+		})
+		_, masked, err := masker.Mask("", statement)
+		check(err)
+		token := masked.(*ast.Insert).Rows.(ast.Values)[0][0].(*ast.Literal).Val
+		if len(token) != len(strconv.Itoa(i)) || tokens[token] {
+			t.Fatalf("token %v of %v isn't unique or has the other count of digits", token, i)
+		}
+		tokens[token] = true
+	}
+}
+
+func TestDataMaskerRules(t *testing.T) {
+	for _, rules := range []map[string]dump_rewriter.MaskRule{
+		{"email": {Strategy: dump_rewriter.EMAIL_MASK}},
+		{"users.note": {Strategy: dump_rewriter.FIXED_MASK}},
+		{"users.note": {Strategy: "shuffle"}},
+	} {
+		if _, err := dump_rewriter.NewDataMasker(&dump_rewriter.MaskRules{Columns: rules}, dialect.MYSQL); err == nil {
+			t.Errorf("wrong rules %v are accepted", rules)
+		}
+	}
+}
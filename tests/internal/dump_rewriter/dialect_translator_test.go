@@ -0,0 +1,149 @@
+package dump_rewriter_tests
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+const mysqlCreateTable = "CREATE TABLE `users` (\n" +
+	"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+	"  `userName` varchar(64) COLLATE utf8mb4_bin NOT NULL DEFAULT '',\n" +
+	"  `active` tinyint(1) NOT NULL DEFAULT '1',\n" +
+	"  `created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+	"  `bio` longtext CHARACTER SET utf8mb4 COMMENT 'about',\n" +
+	"  `kind` enum('a','b') DEFAULT 'a',\n" +
+	"  `order` int DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `name` (`userName`),\n" +
+	"  KEY `idx_created` (`created`),\n" +
+	"  FULLTEXT KEY `ft_bio` (`bio`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=4 DEFAULT CHARSET=utf8mb4"
+
+func translate(translator *dump_rewriter.DialectTranslator, sql string) []string {
+	translated, err := translator.Translate(sql, parse(sql, dialect.MYSQL))
+	check(err, "translate %v fail", sql)
+	return texts(translated)
+}
+
+func TestDialectTranslatorPsql(t *testing.T) {
+	translator, err := dump_rewriter.NewDialectTranslator(dialect.MYSQL, dialect.PSQL)
+	check(err)
+
+	expected := []string{
+		"create table users (\n" +
+			"\tid bigint not null generated by default as identity (start with 4),\n" +
+			"\t\"userName\" varchar(64) not null default '',\n" +
+			"\tactive boolean not null default true,\n" +
+			"\tcreated timestamp not null default current_timestamp,\n" +
+			"\tbio text,\n" +
+			"\tkind text default 'a',\n" +
+			"\t\"order\" integer default null,\n" +
+			"\tprimary key (id),\n" +
+			"\tconstraint users_name unique (\"userName\")\n" +
+			")",
+		"create index users_idx_created on users (created)",
+	}
+	if result := translate(translator, mysqlCreateTable); !slices.Equal(result, expected) {
+		t.Errorf("create table is translated to\n%q\nbut expected\n%q", result, expected)
+	}
+
+	testCases := []struct {
+		sql      string
+		expected []string
+	}{
+		{"INSERT INTO `users` VALUES (1,'it\\'s me',1,'2024-01-01 00:00:00',_binary 0x89504E,'a',NULL)",
+			[]string{`insert into users values (1, 'it''s me', true, '2024-01-01 00:00:00', '\x89504e', 'a', null)`}},
+		{"INSERT INTO `users` (`order`, `active`) VALUES (1,0)",
+			[]string{`insert into users("order", active) values (1, false)`}},
+		{"INSERT IGNORE INTO `users` (`id`) VALUES (5)",
+			[]string{`insert into users(id) values (5) on conflict do nothing`}},
+		{"INSERT INTO `users` (`id`, `userName`, `active`) VALUES (5,'a',1) ON DUPLICATE KEY UPDATE `userName` = VALUES(`userName`), `order` = `order` + 1",
+			[]string{`insert into users(id, "userName", active) values (5, 'a', true) on conflict (id) do update set "userName" = excluded."userName", "order" = "order" + 1`}},
+		{"ALTER TABLE `users` ADD KEY `idx_kind` (`kind`)",
+			[]string{`create index users_idx_kind on users (kind)`}},
+		{"DROP TABLE IF EXISTS `users`", []string{"drop table if exists users"}},
+		{"CREATE TABLE `events` (`id` bigint unsigned NOT NULL AUTO_INCREMENT, `total` bigint unsigned NOT NULL, PRIMARY KEY (`id`))",
+			[]string{"create table events (\n\tid bigint not null generated by default as identity,\n\ttotal numeric(20) not null,\n\tprimary key (id)\n)"}},
+		{"/*!40101 SET NAMES utf8mb4 */", []string{}},
+		{"LOCK TABLES `users` WRITE", []string{}},
+		{"UNLOCK TABLES", []string{}},
+		{"/*!40000 ALTER TABLE `users` DISABLE KEYS */", []string{}},
+	}
+	for _, testCase := range testCases {
+		if result := translate(translator, testCase.sql); !slices.Equal(result, testCase.expected) {
+			t.Errorf("%v is translated to %q but expected %q", testCase.sql, result, testCase.expected)
+		}
+	}
+
+	unparsed := "CREATE DEFINER=`root`@`%` PROCEDURE p() BEGIN END"
+	if result, err := translator.Translate(unparsed, nil); err != nil || !slices.Equal(texts(result), []string{unparsed}) {
+		t.Errorf("unparsed statement is translated to %q (%v)", texts(result), err)
+	}
+
+	// The conflict target of ON DUPLICATE KEY UPDATE is unknown without the keys of the table
+	upsert := "INSERT INTO `logs` VALUES (1) ON DUPLICATE KEY UPDATE `id` = 1"
+	if result, err := translator.Translate(upsert, parse(upsert, dialect.MYSQL)); err == nil {
+		t.Errorf("%v is translated to %q but the error is expected", upsert, texts(result))
+	}
+}
+
+func TestDialectTranslatorSqlite3(t *testing.T) {
+	translator, err := dump_rewriter.NewDialectTranslator(dialect.MYSQL, dialect.SQLITE3)
+	check(err)
+
+	expected := []string{
+		"create table users (\n" +
+			"\tid integer not null primary key,\n" +
+			"\t\"userName\" varchar(64) not null default '',\n" +
+			"\tactive boolean not null default 1,\n" +
+			"\tcreated timestamp not null default current_timestamp,\n" +
+			"\tbio longtext,\n" +
+			"\tkind text default 'a',\n" +
+			"\t\"order\" int default null,\n" +
+			"\tconstraint users_name unique (\"userName\")\n" +
+			")",
+		"create index users_idx_created on users (created)",
+	}
+	if result := translate(translator, mysqlCreateTable); !slices.Equal(result, expected) {
+		t.Errorf("create table is translated to\n%q\nbut expected\n%q", result, expected)
+	}
+
+	testCases := []struct {
+		sql      string
+		expected []string
+	}{
+		{"INSERT INTO `users` VALUES (1,'it\\'s me',1,_binary 0x89504E)",
+			[]string{`insert into users values (1, 'it''s me', 1, X'89504e')`}},
+		{"INSERT IGNORE INTO `users` (`id`) VALUES (5)",
+			[]string{`insert or ignore into users(id) values (5)`}},
+		{"INSERT INTO `users` (`id`, `kind`) VALUES (5,'b') ON DUPLICATE KEY UPDATE `kind` = VALUES(`kind`)",
+			[]string{`insert into users(id, kind) values (5, 'b') on conflict (id) do update set kind = excluded.kind`}},
+	}
+	for _, testCase := range testCases {
+		if result := translate(translator, testCase.sql); !slices.Equal(result, testCase.expected) {
+			t.Errorf("%v is translated to %q but expected %q", testCase.sql, result, testCase.expected)
+		}
+	}
+}
+
+func TestDialectTranslatorRememberColumns(t *testing.T) {
+	translator, err := dump_rewriter.NewDialectTranslator(dialect.MYSQL, dialect.PSQL)
+	check(err)
+
+	// CREATE TABLE isn't translated (e.g. it's skipped by the section), the columns are remembered only
+	translator.RememberColumns(parse(mysqlCreateTable, dialect.MYSQL))
+	insert := "INSERT INTO `users` VALUES (1,'me',0,'2024-01-01 00:00:00',NULL,'a',NULL)"
+	expected := []string{`insert into users values (1, 'me', false, '2024-01-01 00:00:00', null, 'a', null)`}
+	if result := translate(translator, insert); !slices.Equal(result, expected) {
+		t.Errorf("%v is translated to %q but expected %q", insert, result, expected)
+	}
+}
+
+func TestDialectTranslatorUnsupported(t *testing.T) {
+	if _, err := dump_rewriter.NewDialectTranslator(dialect.PSQL, dialect.MYSQL); err == nil {
+		t.Errorf("translation of pg into mysql should be refused")
+	}
+}
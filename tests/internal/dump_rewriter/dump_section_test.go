@@ -0,0 +1,55 @@
+package dump_rewriter_tests
+
+import (
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func TestStatementSection(t *testing.T) {
+	for _, testCase := range []struct {
+		sqlDialect dialect.SqlDialect
+		sql        string
+		section    dump_rewriter.DumpSection
+	}{
+		{dialect.PSQL, "SET client_encoding = 'UTF8';", dump_rewriter.SESSION_SECTION},
+		{dialect.PSQL, "SELECT pg_catalog.set_config('search_path', '', false);", dump_rewriter.SESSION_SECTION},
+		{dialect.PSQL, "BEGIN;", dump_rewriter.SESSION_SECTION},
+		{dialect.PSQL, "CREATE TABLE public.a (id integer NOT NULL);", dump_rewriter.PRE_DATA_SECTION},
+		{dialect.PSQL, "CREATE SEQUENCE public.a_id_seq START WITH 1;", dump_rewriter.PRE_DATA_SECTION},
+		{dialect.PSQL, "CREATE TYPE public.mood AS ENUM ('sad', 'ok');", dump_rewriter.PRE_DATA_SECTION},
+		{dialect.PSQL, "ALTER TABLE ONLY public.a ALTER COLUMN id SET DEFAULT nextval('public.a_id_seq'::regclass);", dump_rewriter.PRE_DATA_SECTION},
+		{dialect.PSQL, "INSERT INTO public.a VALUES (1);", dump_rewriter.DATA_SECTION},
+		{dialect.PSQL, "COPY public.a (id) FROM stdin;", dump_rewriter.DATA_SECTION},
+		{dialect.PSQL, "SELECT pg_catalog.setval('public.a_id_seq', 2, true);", dump_rewriter.DATA_SECTION},
+		{dialect.PSQL, "ALTER TABLE ONLY public.a ADD CONSTRAINT a_pkey PRIMARY KEY (id);", dump_rewriter.POST_DATA_SECTION},
+		{dialect.PSQL, "ALTER TABLE ONLY public.b ADD CONSTRAINT fk FOREIGN KEY (a_id) REFERENCES public.a(id);", dump_rewriter.POST_DATA_SECTION},
+		{dialect.PSQL, "CREATE UNIQUE INDEX k ON public.a USING btree (id);", dump_rewriter.POST_DATA_SECTION},
+		{dialect.PSQL, "CREATE TRIGGER t AFTER INSERT ON public.a FOR EACH ROW EXECUTE FUNCTION f();", dump_rewriter.POST_DATA_SECTION},
+		{dialect.MYSQL, "LOCK TABLES `a` WRITE;", dump_rewriter.DATA_SECTION},
+		{dialect.MYSQL, "ALTER TABLE `a` DISABLE KEYS;", dump_rewriter.DATA_SECTION},
+		{dialect.MYSQL, "CREATE TABLE `a` (`id` int NOT NULL, KEY `k` (`id`));", dump_rewriter.PRE_DATA_SECTION},
+	} {
+		// The statements which the parser doesn't recognize are classified by the text
+		statement, _ := sql_parser.Parse(testCase.sql, testCase.sqlDialect)
+		section := dump_rewriter.StatementSection(testCase.sql, statement)
+		if section != testCase.section {
+			t.Errorf("section of %v is %v but expected %v", testCase.sql, section, testCase.section)
+		}
+	}
+}
+
+func TestParseDumpSection(t *testing.T) {
+	for _, name := range []string{"pre-data", "data", "post-data"} {
+		section, err := dump_rewriter.ParseDumpSection(name)
+		check(err, "parse section %v fail", name)
+		if string(section) != name {
+			t.Errorf("section is %v but expected %v", section, name)
+		}
+	}
+	if _, err := dump_rewriter.ParseDumpSection("session"); err == nil {
+		t.Errorf("session section is accepted")
+	}
+}
@@ -0,0 +1,128 @@
+package dump_rewriter_tests
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+func parse(sql string, sqlDialect dialect.SqlDialect) ast.Statement {
+	statement, err := sql_parser.Parse(sql, sqlDialect)
+	check(err, "parse %s fail", sql)
+	return statement
+}
+
+func texts(statements []dump_rewriter.RewrittenStatement) []string {
+	result := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		result = append(result, statement.Text)
+	}
+	return result
+}
+
+func TestIndexDeferrerMysql(t *testing.T) {
+	deferrer := dump_rewriter.NewIndexDeferrer(dialect.MYSQL)
+
+	text, _, ok := deferrer.Defer(parse("CREATE TABLE `a` (\n"+
+		"  `id` int NOT NULL AUTO_INCREMENT,\n"+
+		"  `b_id` int DEFAULT NULL,\n"+
+		"  `name` varchar(10) DEFAULT NULL,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  UNIQUE KEY `u_name` (`name`),\n"+
+		"  KEY `k_b` (`b_id`),\n"+
+		"  CONSTRAINT `fk_b` FOREIGN KEY (`b_id`) REFERENCES `b` (`id`)\n"+
+		") ENGINE=InnoDB;", dialect.MYSQL))
+	if !ok {
+		t.Fatalf("indexes of table a aren't deferred")
+	}
+	expectedText := "create table a (\n" +
+		"\tid int not null auto_increment,\n" +
+		"\tb_id int default null,\n" +
+		"\t`name` varchar(10) default null,\n" +
+		"\tPRIMARY KEY (id)\n" +
+		") ENGINE InnoDB"
+	if text != expectedText {
+		t.Errorf("create table is %q but expected %q", text, expectedText)
+	}
+	if _, _, ok := deferrer.Defer(parse("CREATE TABLE b (id int NOT NULL, PRIMARY KEY (id));", dialect.MYSQL)); ok {
+		t.Errorf("table b without secondary indexes is changed")
+	}
+
+	for _, sql := range []string{
+		"LOCK TABLES `a` WRITE;",
+		"ALTER TABLE `a` DISABLE KEYS;",
+		"INSERT INTO `a` VALUES (1, 1, 'one');",
+		"SELECT * FROM b;",
+	} {
+		if released := deferrer.Release(parse(sql, dialect.MYSQL)); len(released) != 0 {
+			t.Errorf("statement %v releases %q", sql, texts(released))
+		}
+	}
+
+	released := texts(deferrer.Release(parse("ALTER TABLE `a` ENABLE KEYS;", dialect.MYSQL)))
+	expectedReleased := []string{
+		"alter table a add UNIQUE KEY u_name (`name`)",
+		"alter table a add KEY k_b (b_id)",
+		"alter table a add constraint fk_b foreign key (b_id) references b (id)",
+	}
+	if !slices.Equal(released, expectedReleased) {
+		t.Errorf("released statements are %q but expected %q", released, expectedReleased)
+	}
+	if released := deferrer.ReleaseAll(); len(released) != 0 {
+		t.Errorf("statements %q are released twice", texts(released))
+	}
+}
+
+func TestIndexDeferrerPsql(t *testing.T) {
+	deferrer := dump_rewriter.NewIndexDeferrer(dialect.PSQL)
+
+	for _, sql := range []string{
+		"CREATE TABLE public.a (id integer NOT NULL, b_id integer, CONSTRAINT a_pkey PRIMARY KEY (id), " +
+			"CONSTRAINT fk_b FOREIGN KEY (b_id) REFERENCES public.b (id), UNIQUE (b_id));",
+		"CREATE TABLE public.b (id integer NOT NULL, serial_no integer, PRIMARY KEY (id), CONSTRAINT u_serial_no UNIQUE (serial_no));",
+		"CREATE TABLE public.d (id integer NOT NULL, code integer, UNIQUE KEY u_code (code));",
+	} {
+		if _, _, ok := deferrer.Defer(parse(sql, dialect.PSQL)); !ok {
+			t.Errorf("indexes of %v aren't deferred", sql)
+		}
+	}
+	if _, _, ok := deferrer.Defer(parse("CREATE TABLE public.c (id integer, \"name\" text UNIQUE);", dialect.PSQL)); ok {
+		t.Errorf("indexes of table with quoted identifiers are deferred")
+	}
+
+	released := texts(deferrer.ReleaseAll())
+	expectedReleased := []string{
+		"alter table public.a add unique (b_id)",
+		"alter table public.b add constraint u_serial_no unique (serial_no)",
+		"alter table public.d add constraint u_code unique (code)",
+		"alter table public.a add constraint fk_b foreign key (b_id) references public.b (id)",
+	}
+	if !slices.Equal(released, expectedReleased) {
+		t.Errorf("released statements are %q but expected %q", released, expectedReleased)
+	}
+}
+
+func TestIndexDeferrerSqlite3(t *testing.T) {
+	deferrer := dump_rewriter.NewIndexDeferrer(dialect.SQLITE3)
+	statement := parse("CREATE TABLE a (id integer, b_id integer, UNIQUE (b_id));", dialect.SQLITE3)
+	if _, _, ok := deferrer.Defer(statement); ok {
+		t.Errorf("indexes are deferred for sqlite3")
+	}
+}
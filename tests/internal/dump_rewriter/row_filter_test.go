@@ -0,0 +1,160 @@
+package dump_rewriter_tests
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func filterRows(filter *dump_rewriter.RowFilter, sql string, sqlDialect dialect.SqlDialect) (string, bool, error) {
+	text, _, selected, err := filter.Filter(sql, parse(sql, sqlDialect))
+	return text, selected, err
+}
+
+func TestRowFilterConditions(t *testing.T) {
+	createTable := "CREATE TABLE `users` (`id` int, `name` varchar(64), `email` varchar(64), `age` int, `score` decimal(5,2))"
+	insert := "INSERT INTO `users` VALUES (1,'Ann','ann@a.com',30,1.5),(2,'Bob',NULL,17,NULL),(3,'Cid','cid@b.org',NULL,10.25)"
+	for _, test := range []struct {
+		condition string
+		ids       string
+	}{
+		{"id = 2", "2"},
+		{"id <> 2", "1,3"},
+		{"id != 2 AND age > 18", "1"},
+		{"age >= 17 OR email LIKE '%.org'", "1,2,3"},
+		{"NOT age < 18", "1"},
+		{"age IS NULL", "3"},
+		{"email IS NOT NULL", "1,3"},
+		{"id IN (1, 3)", "1,3"},
+		{"id NOT IN (1, NULL)", ""},
+		{"id BETWEEN 2 AND 3", "2,3"},
+		{"name LIKE 'B_b'", "2"},
+		{"email NOT LIKE '%@a.com'", "3"},
+		{"name REGEXP '^[AC]'", "1,3"},
+		{"age + 1 = 31", "1"},
+		{"id * 10 % 20 = 0", "2"},
+		{"score / 2 > 5", "3"},
+		{"-id = -3", "3"},
+		{"id = '2'", "2"},
+		{"age <=> NULL", "3"},
+		{"id > 1 XOR age > 18", "1,2"},
+	} {
+		filter, err := dump_rewriter.NewRowFilter([]string{"users: " + test.condition}, dialect.MYSQL)
+		check(err)
+		_, _, _, err = filter.Filter(createTable, parse(createTable, dialect.MYSQL))
+		check(err)
+		text, selected, err := filterRows(filter, insert, dialect.MYSQL)
+		if err != nil {
+			t.Errorf("condition %v fail with error %v", test.condition, err)
+			continue
+		}
+		ids := make([]string, 0)
+		if selected {
+			inserted := parse(text, dialect.MYSQL)
+			if inserted == nil {
+				t.Fatalf("filtered insert %v isn't parsed", text)
+			}
+			for _, id := range []string{"1", "2", "3"} {
+				if strings.Contains(text, "("+id+", ") || strings.Contains(text, "("+id+",'") {
+					ids = append(ids, id)
+				}
+			}
+		}
+		if strings.Join(ids, ",") != test.ids {
+			t.Errorf("condition %v selects %v but expected %v (%v)", test.condition, ids, test.ids, text)
+		}
+	}
+}
+
+func TestRowFilterInsert(t *testing.T) {
+	filter, err := dump_rewriter.NewRowFilter([]string{"Users: id > 1", "users: id < 3", "public.orders: total >= 10"}, dialect.PSQL)
+	check(err)
+
+	// The statement is kept as is if all rows match
+	insert := "INSERT INTO users (id, name) VALUES (2, 'b')"
+	if text, selected, err := filterRows(filter, insert, dialect.PSQL); err != nil || !selected || text != insert {
+		t.Errorf("insert is filtered to %v, %v (%v)", text, selected, err)
+	}
+	text, selected, err := filterRows(filter, "INSERT INTO users (id, name) VALUES (1, 'a'), (2, 'b'), (3, now())", dialect.PSQL)
+	if err != nil || !selected || text != "insert into users(id, \"name\") values (2, 'b')" {
+		t.Errorf("insert is filtered to %v, %v (%v)", text, selected, err)
+	}
+	if _, selected, err := filterRows(filter, "INSERT INTO users (id) VALUES (5)", dialect.PSQL); err != nil || selected {
+		t.Errorf("insert without matching rows is selected (%v)", err)
+	}
+
+	// The condition of the qualified name doesn't match the other schema
+	insert = "INSERT INTO audit.orders (total) VALUES (1)"
+	if text, selected, err := filterRows(filter, insert, dialect.PSQL); err != nil || !selected || text != insert {
+		t.Errorf("insert of the other schema is filtered to %v, %v (%v)", text, selected, err)
+	}
+	if _, selected, err := filterRows(filter, "INSERT INTO public.orders (total) VALUES (1)", dialect.PSQL); err != nil || selected {
+		t.Errorf("insert of the qualified table is selected (%v)", err)
+	}
+
+	// The columns of the table aren't known or the column isn't found
+	if _, _, err := filterRows(filter, "INSERT INTO users VALUES (1, 'a')", dialect.PSQL); err == nil {
+		t.Errorf("insert without columns is filtered")
+	}
+	if _, _, err := filterRows(filter, "INSERT INTO public.orders (id) VALUES (1)", dialect.PSQL); err == nil {
+		t.Errorf("insert without the column of the condition is filtered")
+	}
+	if _, _, _, err := filter.Filter("INSERT INTO users VALUES (1, 'x' ", nil); err == nil {
+		t.Errorf("insert which isn't parsed is accepted")
+	}
+}
+
+func TestRowFilterCopy(t *testing.T) {
+	filter, err := dump_rewriter.NewRowFilter([]string{"users: age >= 18 AND name NOT LIKE 'x%'"}, dialect.PSQL)
+	check(err)
+	copyFrom := "COPY public.users (id, name, age) FROM stdin;"
+	data, err := filter.FilterCopyData(copyFrom, parse(copyFrom, dialect.PSQL), strings.NewReader(
+		"1\tAnn\\tA\t30\n"+
+			"2\tBob\t17\n"+
+			"3\txavier\t40\n"+
+			"4\t\\N\t\\N\n"+
+			"5\tEve\t18"))
+	check(err)
+	content, err := io.ReadAll(data)
+	check(err)
+	if string(content) != "1\tAnn\\tA\t30\n5\tEve\t18" {
+		t.Errorf("filtered data is %q", content)
+	}
+
+	// The booleans of COPY data are t and f
+	for condition, expected := range map[string]string{
+		"active":                           "1\tt\n3\tTRUE\n",
+		"NOT active":                       "2\tf\n",
+		"active = true":                    "1\tt\n3\tTRUE\n",
+		"active = false OR active IS NULL": "2\tf\n4\t\\N\n",
+		"active IS NOT TRUE":               "2\tf\n4\t\\N\n",
+	} {
+		booleanFilter, err := dump_rewriter.NewRowFilter([]string{"flags: " + condition}, dialect.PSQL)
+		check(err)
+		copyFrom := "COPY public.flags (id, active) FROM stdin;"
+		data, err := booleanFilter.FilterCopyData(copyFrom, parse(copyFrom, dialect.PSQL), strings.NewReader("1\tt\n2\tf\n3\tTRUE\n4\t\\N\n"))
+		check(err)
+		content, err := io.ReadAll(data)
+		check(err)
+		if string(content) != expected {
+			t.Errorf("data filtered by %v is %q but expected %q", condition, content, expected)
+		}
+	}
+
+	copyFrom = "COPY public.items (id) FROM stdin;"
+	source := strings.NewReader("1\n")
+	if data, err := filter.FilterCopyData(copyFrom, parse(copyFrom, dialect.PSQL), source); err != nil || data != io.Reader(source) {
+		t.Errorf("data of table without condition is filtered (%v)", err)
+	}
+}
+
+func TestRowFilterWrongConditions(t *testing.T) {
+	for _, condition := range []string{"id = 1", "users:", ": id = 1", "users: id = = 1"} {
+		if _, err := dump_rewriter.NewRowFilter([]string{condition}, dialect.MYSQL); err == nil {
+			t.Errorf("wrong condition %v is accepted", condition)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package dump_rewriter_tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func TestTableFilterMatch(t *testing.T) {
+	filter, err := dump_rewriter.NewTableFilter([]string{"users%", "public.orders*"}, []string{"users_log", "%_[0-9][0-9]*"}, dialect.MYSQL)
+	check(err, "make filter fail")
+
+	for table, expected := range map[string]bool{
+		"users":          true,
+		"Users_Roles":    true,
+		"users_log":      false,
+		"users_2024":     true,
+		"users_log_2024": true,
+		"public.orders":  true,
+		"orders":         false,
+		"shop.orders":    false,
+		"public.users":   true,
+		"audit_log":      false,
+	} {
+		statement := parse("TRUNCATE TABLE "+table+";", dialect.MYSQL).(*ast.TruncateTable)
+		if filter.Match(statement.Table) != expected {
+			t.Errorf("match of table %v is %v but expected %v", table, !expected, expected)
+		}
+	}
+
+	if _, err := dump_rewriter.NewTableFilter([]string{"users["}, nil, dialect.MYSQL); err == nil {
+		t.Errorf("wrong glob pattern is accepted")
+	}
+}
+
+func TestTableFilterStatements(t *testing.T) {
+	filter, err := dump_rewriter.NewTableFilter(nil, []string{"audit_log"}, dialect.MYSQL)
+	check(err, "make filter fail")
+
+	for sql, expected := range map[string]bool{
+		"CREATE TABLE audit_log (id integer);":                    false,
+		"ALTER TABLE ONLY public.audit_log ADD COLUMN a integer;": false,
+		"CREATE INDEX k ON public.audit_log USING btree (id);":    false,
+		"INSERT INTO audit_log VALUES (1);":                       false,
+		"COPY public.audit_log (id) FROM stdin;":                  false,
+		"TRUNCATE TABLE audit_log;":                               false,
+		"DROP TABLE IF EXISTS audit_log;":                         false,
+		"CREATE TABLE users (id integer);":                        true,
+		"INSERT INTO users SELECT id FROM audit_log;":             true,
+		"SELECT pg_catalog.set_config('search_path', '', false);": true,
+	} {
+		_, _, selected := filter.Filter(sql, parse(sql, dialect.PSQL))
+		if selected != expected {
+			t.Errorf("selection of %v is %v but expected %v", sql, selected, expected)
+		}
+	}
+	if _, _, selected := filter.Filter("CREATE TRIGGER t AFTER INSERT ON audit_log;", nil); !selected {
+		t.Errorf("statement which isn't parsed is skipped")
+	}
+
+	for sql, expectedText := range map[string]string{
+		"DROP TABLE IF EXISTS users, audit_log, roles;": "drop table if exists users, roles",
+		"LOCK TABLES `audit_log` WRITE, `users` WRITE;": "lock tables users write",
+		"DROP TABLE IF EXISTS users;":                   "DROP TABLE IF EXISTS users;",
+	} {
+		text, statement, selected := filter.Filter(sql, parse(sql, dialect.MYSQL))
+		if !selected || text != expectedText {
+			t.Errorf("filtered statement is %q (selected %v) but expected %q", text, selected, expectedText)
+		}
+		if ast.String(statement) != ast.String(parse(strings.TrimSuffix(expectedText, ";")+";", dialect.MYSQL)) {
+			t.Errorf("filtered statement is %v but expected %v", ast.String(statement), expectedText)
+		}
+	}
+
+	// The rewritten statement is formatted in the dialect of the dump
+	psqlFilter, err := dump_rewriter.NewTableFilter(nil, []string{"audit_log"}, dialect.PSQL)
+	check(err, "make filter fail")
+	sql := "DROP TABLE IF EXISTS public.\"order\", public.audit_log;"
+	if text, _, selected := psqlFilter.Filter(sql, parse(sql, dialect.PSQL)); !selected || text != "drop table if exists public.\"order\"" {
+		t.Errorf("filtered statement is %q (selected %v)", text, selected)
+	}
+}
@@ -0,0 +1,143 @@
+package dump_rewriter_tests
+
+import (
+	"testing"
+
+	"github.com/usalko/prodl/internal/dump_rewriter"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// rename renames the statement, the statement which isn't parsed is renamed by the text
+func rename(renamer *dump_rewriter.TableRenamer, sql string, sqlDialect dialect.SqlDialect) string {
+	statement, _ := sql_parser.Parse(sql, sqlDialect)
+	text, _ := renamer.Rename(sql, statement)
+	return text
+}
+
+func TestTableRenamerPsql(t *testing.T) {
+	renamer, err := dump_rewriter.NewTableRenamer([]string{"users=members"}, []string{"public=tenant_a"}, dialect.PSQL)
+	check(err)
+	for _, test := range []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"INSERT INTO public.users VALUES (1, 'public.users')",
+			"insert into tenant_a.members values (1, 'public.users')",
+		},
+		{
+			"COPY public.users (id, \"Name\") FROM stdin WITH (FORMAT csv)",
+			"COPY tenant_a.members (id, \"Name\") FROM stdin WITH (FORMAT csv)",
+		},
+		{
+			"COPY users (id, users_id) FROM stdin",
+			"COPY members (id, users_id) FROM stdin",
+		},
+		{
+			"INSERT INTO public.orders (id, user_id) VALUES (1, 1)",
+			"insert into tenant_a.orders(id, user_id) values (1, 1)",
+		},
+		{
+			"CREATE TABLE public.users (\n    id integer DEFAULT nextval('public.users_id_seq'::regclass) NOT NULL,\n    name text\n)",
+			"CREATE TABLE tenant_a.members (\n    id integer DEFAULT nextval('tenant_a.members_id_seq'::regclass) NOT NULL,\n    name text\n)",
+		},
+		{
+			"CREATE SEQUENCE public.users_id_seq\n    AS integer\n    START WITH 1\n    INCREMENT BY 1\n    NO MINVALUE\n    NO MAXVALUE\n    CACHE 1",
+			"CREATE SEQUENCE tenant_a.members_id_seq\n    AS integer\n    START WITH 1\n    INCREMENT BY 1\n    NO MINVALUE\n    NO MAXVALUE\n    CACHE 1",
+		},
+		{
+			"ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id",
+			"ALTER SEQUENCE tenant_a.members_id_seq OWNED BY tenant_a.members.id",
+		},
+		{
+			"SELECT pg_catalog.setval('public.users_id_seq', 2, true)",
+			"SELECT pg_catalog.setval('tenant_a.members_id_seq', 2, true)",
+		},
+		{
+			"CREATE INDEX users_name_idx ON public.users USING btree (name)",
+			"CREATE INDEX members_name_idx ON tenant_a.members USING btree (name)",
+		},
+		{
+			"ALTER TABLE ONLY public.users ADD CONSTRAINT users_pkey PRIMARY KEY (id)",
+			"ALTER TABLE ONLY tenant_a.members ADD CONSTRAINT members_pkey PRIMARY KEY (id)",
+		},
+		{
+			"ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass)",
+			"ALTER TABLE ONLY tenant_a.members ALTER COLUMN id SET DEFAULT nextval('tenant_a.members_id_seq'::regclass)",
+		},
+		{
+			"CREATE SCHEMA public",
+			"CREATE SCHEMA tenant_a",
+		},
+		{
+			"SET search_path = public, pg_catalog",
+			"SET search_path = tenant_a, pg_catalog",
+		},
+		{
+			"SELECT pg_catalog.set_config('search_path', '', false)",
+			"SELECT pg_catalog.set_config('search_path', '', false)",
+		},
+		{
+			"SELECT pg_catalog.set_config('search_path', 'public, pg_catalog', false)",
+			"SELECT pg_catalog.set_config('search_path', 'tenant_a, pg_catalog', false)",
+		},
+		{
+			"SET standard_conforming_strings = on",
+			"SET standard_conforming_strings = on",
+		},
+	} {
+		if actual := rename(renamer, test.sql, dialect.PSQL); actual != test.expected {
+			t.Errorf("statement %q is renamed to %q, expected %q", test.sql, actual, test.expected)
+		}
+	}
+}
+
+func TestTableRenamerMysql(t *testing.T) {
+	renamer, err := dump_rewriter.NewTableRenamer([]string{"users=shop.members"}, nil, dialect.MYSQL)
+	check(err)
+	for _, test := range []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"INSERT INTO `users` VALUES (1,'users')",
+			"insert into shop.members values (1, 'users')",
+		},
+		{
+			"CREATE TABLE `users` (`id` int NOT NULL, KEY `users_id` (`id`), CONSTRAINT `users_fk` FOREIGN KEY (`id`) REFERENCES `accounts` (`id`)) ENGINE=InnoDB",
+			"create table shop.members (\n\tid int not null,\n\tKEY members_id (id),\n\tconstraint members_fk foreign key (id) references accounts (id)\n) ENGINE InnoDB",
+		},
+		{
+			"ALTER TABLE `users` ADD CONSTRAINT `users_fk` FOREIGN KEY (`id`) REFERENCES `users` (`id`)",
+			"ALTER TABLE `shop`.`members` ADD CONSTRAINT `members_fk` FOREIGN KEY (`id`) REFERENCES `shop`.`members` (`id`)",
+		},
+		{
+			"LOCK TABLES `users` WRITE",
+			"lock tables shop.members write",
+		},
+		{
+			"DROP TABLE IF EXISTS `users`",
+			"drop table if exists shop.members",
+		},
+		{
+			"INSERT INTO `accounts` VALUES (1)",
+			"INSERT INTO `accounts` VALUES (1)",
+		},
+	} {
+		if actual := rename(renamer, test.sql, dialect.MYSQL); actual != test.expected {
+			t.Errorf("statement %q is renamed to %q, expected %q", test.sql, actual, test.expected)
+		}
+	}
+}
+
+func TestTableRenamerErrors(t *testing.T) {
+	for _, renames := range [][]string{{"users"}, {"users="}, {"=members"}, {"a.b.users=members"}} {
+		if _, err := dump_rewriter.NewTableRenamer(renames, nil, dialect.PSQL); err == nil {
+			t.Errorf("rename %v is accepted", renames)
+		}
+	}
+	if _, err := dump_rewriter.NewTableRenamer(nil, []string{"public=tenant.a"}, dialect.PSQL); err == nil {
+		t.Errorf("schema map public=tenant.a is accepted")
+	}
+}
@@ -0,0 +1,226 @@
+package dump_sampler_tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/archive_stream"
+	"github.com/usalko/prodl/internal/dump_sampler"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+// pgDump makes the dump like pg_dump does: the foreign keys are added after the data
+func pgDump() string {
+	var dump strings.Builder
+	dump.WriteString("CREATE TABLE public.countries (id integer, name text);\n")
+	dump.WriteString("CREATE TABLE public.users (id integer, country_id integer, name text);\n")
+	dump.WriteString("CREATE TABLE public.orders (id integer, user_id integer);\n")
+	dump.WriteString("CREATE TABLE public.products (id integer);\n")
+	dump.WriteString("CREATE TABLE public.items (order_id integer, product_id integer);\n")
+	dump.WriteString("CREATE TABLE public.settings (name text);\n")
+	dump.WriteString("INSERT INTO public.countries VALUES (1, 'a'), (2, 'b'), (3, 'c');\n")
+	dump.WriteString("COPY public.users (id, country_id, name) FROM stdin;\n")
+	for i := 1; i <= 40; i++ {
+		country := fmt.Sprint(i%2 + 1)
+		if i%10 == 0 {
+			country = "\\N"
+		}
+		fmt.Fprintf(&dump, "%v\t%v\tuser\\t%v\n", i, country, i)
+	}
+	dump.WriteString("\\.\n")
+	for i := 1; i <= 80; i++ {
+		fmt.Fprintf(&dump, "INSERT INTO public.orders VALUES (%v, %v);\n", i, (i+1)/2)
+	}
+	dump.WriteString("INSERT INTO public.products VALUES (1), (2), (3), (4), (5), (6), (7);\n")
+	dump.WriteString("COPY public.items (order_id, product_id) FROM stdin;\n")
+	for i := 1; i <= 80; i++ {
+		fmt.Fprintf(&dump, "%v\t%v\n", i, i%5+1)
+	}
+	dump.WriteString("\\.\n")
+	dump.WriteString("INSERT INTO public.settings VALUES ('x'), ('y');\n")
+	dump.WriteString("ALTER TABLE ONLY public.users ADD CONSTRAINT users_country_fk FOREIGN KEY (country_id) REFERENCES public.countries(id);\n")
+	dump.WriteString("ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id);\n")
+	dump.WriteString("ALTER TABLE ONLY public.items ADD CONSTRAINT items_order_fk FOREIGN KEY (order_id) REFERENCES public.orders(id);\n")
+	dump.WriteString("ALTER TABLE ONLY public.items ADD CONSTRAINT items_product_fk FOREIGN KEY (product_id) REFERENCES public.products(id);\n")
+	return dump.String()
+}
+
+func archive(dump string) *archive_stream.ArchiveStreamReader {
+	var archive bytes.Buffer
+	writer := gzip.NewWriter(&archive)
+	writer.Name = "dump.sql"
+	_, err := writer.Write([]byte(dump))
+	check(err, "write gzip fail")
+	check(writer.Close(), "close gzip fail")
+	return archive_stream.NewReader(&archive)
+}
+
+// sample writes the sample of the dump and returns the rows of the sample by the table
+func sample(t *testing.T, dump string, sqlDialect dialect.SqlDialect, ratio float64, root string) (*dump_sampler.Sampler, map[string][][]string) {
+	sampler, err := dump_sampler.NewSampler(sqlDialect, ratio, root, 7)
+	check(err)
+	scans := 0
+	for scan := true; scan; scan = sampler.Rescan() {
+		check(sampler.Scan(archive(dump)), "scan fail")
+		scans++
+	}
+	if sqlDialect == dialect.PSQL && scans != 2 {
+		t.Errorf("dump is scanned %v times", scans)
+	}
+	check(sampler.Select(), "select fail")
+	output := filepath.Join(t.TempDir(), "sample.sql")
+	connection := &sql_connection.FileConnection{}
+	check(connection.Establish(output))
+	check(sampler.Write(archive(dump), connection), "write fail")
+	check(connection.Close())
+
+	content, err := os.ReadFile(output)
+	check(err)
+	rows := make(map[string][][]string)
+	err = sql_parser.StatementStreamWithCopy(bytes.NewReader(content), sqlDialect,
+		func(statementText string, statement ast.Statement, parseError error) {
+			check(parseError, "sample statement %v", statementText)
+			if insert, ok := statement.(*ast.Insert); ok {
+				for _, tuple := range insert.Rows.(ast.Values) {
+					row := make([]string, 0, len(tuple))
+					for _, expr := range tuple {
+						value, _ := ast.ExprToValue(expr)
+						row = append(row, value.RawStr())
+					}
+					rows[insert.Table.Name.String()] = append(rows[insert.Table.Name.String()], row)
+				}
+			}
+		},
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			check(parseError, "sample statement %v", statementText)
+			content, err := io.ReadAll(data)
+			check(err)
+			table := statement.(*ast.CopyFrom).Table.Name.String()
+			for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+				rows[table] = append(rows[table], strings.Split(line, "\t"))
+			}
+		})
+	check(err)
+	return sampler, rows
+}
+
+// keys returns the set of values of the column
+func keys(rows [][]string, column int) map[string]bool {
+	keys := make(map[string]bool)
+	for _, row := range rows {
+		keys[row[column]] = true
+	}
+	return keys
+}
+
+func TestSamplerForeignKeys(t *testing.T) {
+	sampler, rows := sample(t, pgDump(), dialect.PSQL, 0.25, "users")
+
+	users := keys(rows["users"], 0)
+	if len(users) == 0 || len(users) >= 40 {
+		t.Fatalf("users are sampled to %v rows", len(users))
+	}
+	if count, kept := sampler.Rows("public.users"); count != 40 || kept != len(users) {
+		t.Errorf("users rows are %v of %v", kept, count)
+	}
+	// The orders of the kept users and the items of the kept orders
+	if len(rows["orders"]) != 2*len(users) {
+		t.Errorf("orders %v don't match users %v", rows["orders"], users)
+	}
+	for _, order := range rows["orders"] {
+		if !users[order[1]] {
+			t.Errorf("order %v references the skipped user", order)
+		}
+	}
+	orders := keys(rows["orders"], 0)
+	if len(rows["items"]) != len(orders) {
+		t.Errorf("items %v don't match orders %v", rows["items"], orders)
+	}
+	// The parents which are referenced by the kept rows only
+	products := keys(rows["items"], 1)
+	if len(rows["products"]) != len(products) {
+		t.Errorf("products %v don't match items %v", rows["products"], products)
+	}
+	for _, product := range rows["products"] {
+		if !products[product[0]] {
+			t.Errorf("product %v isn't referenced", product)
+		}
+	}
+	countries := keys(rows["users"], 1)
+	delete(countries, "\\N")
+	if len(rows["countries"]) != len(countries) || keys(rows["countries"], 0)["3"] {
+		t.Errorf("countries %v don't match users %v", rows["countries"], rows["users"])
+	}
+	// The table which isn't linked with the root table
+	if len(rows["settings"]) != 2 {
+		t.Errorf("settings are sampled to %v", rows["settings"])
+	}
+	// The escaped text of COPY data is kept as is
+	for _, user := range rows["users"] {
+		if user[2] != "user\\t"+user[0] {
+			t.Errorf("user row is %v", user)
+		}
+	}
+
+	// The same seed selects the same rows
+	_, again := sample(t, pgDump(), dialect.PSQL, 0.25, "public.users")
+	if fmt.Sprint(again["users"]) != fmt.Sprint(rows["users"]) {
+		t.Errorf("users %v differ from %v", again["users"], rows["users"])
+	}
+}
+
+func TestSamplerMysqlDump(t *testing.T) {
+	dump := "CREATE TABLE `orders` (`id` int NOT NULL, `user_id` int, PRIMARY KEY (`id`), " +
+		"CONSTRAINT `fk` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)) ENGINE=InnoDB;\n" +
+		"INSERT INTO `orders` VALUES (1,1),(2,2),(3,2),(4,NULL);\n" +
+		"CREATE TABLE `users` (`id` int NOT NULL, `name` varchar(10), PRIMARY KEY (`id`)) ENGINE=InnoDB;\n" +
+		"INSERT INTO `users` VALUES (1,'a'),(2,'b'),(3,'c');\n"
+	_, rows := sample(t, dump, dialect.MYSQL, 1, "users")
+	if len(rows["users"]) != 3 || len(rows["orders"]) != 3 {
+		t.Errorf("all rows aren't sampled: %v", rows)
+	}
+}
+
+func TestSamplerErrors(t *testing.T) {
+	for _, ratio := range []float64{0, -1, 1.5} {
+		if _, err := dump_sampler.NewSampler(dialect.PSQL, ratio, "users", 1); err == nil {
+			t.Errorf("ratio %v is accepted", ratio)
+		}
+	}
+	sampler, err := dump_sampler.NewSampler(dialect.PSQL, 0.5, "accounts", 1)
+	check(err)
+	check(sampler.Scan(archive(pgDump())))
+	if err := sampler.Select(); err == nil {
+		t.Errorf("unknown root table is accepted")
+	}
+
+	// The columns of the table with the foreign key aren't known
+	sampler, err = dump_sampler.NewSampler(dialect.PSQL, 0.5, "users", 1)
+	check(err)
+	dump := "ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id);\n" +
+		"INSERT INTO public.orders VALUES (1, 1);\n"
+	if err := sampler.Scan(archive(dump)); err == nil {
+		t.Errorf("insert without columns is scanned")
+	}
+}
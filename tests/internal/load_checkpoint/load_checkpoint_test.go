@@ -0,0 +1,134 @@
+package load_checkpoint_tests
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/load_checkpoint"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "state.json")
+
+	checkpoint, err := load_checkpoint.Load(fileName)
+	check(err, "load of missing checkpoint fail")
+	if checkpoint != nil {
+		t.Errorf("checkpoint %v is loaded from missing file", checkpoint)
+	}
+
+	saved := &load_checkpoint.Checkpoint{
+		File:        "dump.tar.gz",
+		Fingerprint: "sha256:00",
+		EntryIndex:  2,
+		Entry:       "dump/02_b.sql",
+		Offset:      12345,
+		Statement:   17,
+	}
+	check(saved.Save(fileName), "save checkpoint fail")
+	saved.Offset = 23456
+	check(saved.Save(fileName), "save checkpoint again fail")
+
+	checkpoint, err = load_checkpoint.Load(fileName)
+	check(err, "load checkpoint fail")
+	if checkpoint == nil {
+		t.Fatalf("checkpoint isn't loaded")
+	}
+	if !checkpoint.Updated.Equal(saved.Updated) {
+		t.Errorf("update time is %v but expected %v", checkpoint.Updated, saved.Updated)
+	}
+	checkpoint.Updated = saved.Updated
+	if *checkpoint != *saved {
+		t.Errorf("checkpoint is %v but expected %v", checkpoint, saved)
+	}
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(fileName), "*"))
+	check(err, "list files fail")
+	if len(files) != 1 {
+		t.Errorf("files are %v but expected the checkpoint only", files)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	directory := t.TempDir()
+	content := bytes.Repeat([]byte("INSERT INTO a VALUES (1);\n"), 3*load_checkpoint.FINGERPRINT_SAMPLE_SIZE/26)
+	fingerprints := make(map[string]bool)
+	for i, change := range []func([]byte) []byte{
+		func(content []byte) []byte { return content },
+		// The change at the beginning of the file
+		func(content []byte) []byte { return append([]byte("--\n"), content[3:]...) },
+		// The change at the end of the file
+		func(content []byte) []byte { return append(bytes.Clone(content[:len(content)-3]), "--\n"...) },
+		// The change of the size of the file
+		func(content []byte) []byte { return append(bytes.Clone(content), '\n') },
+	} {
+		fileName := filepath.Join(directory, fmt.Sprintf("dump%v.sql", i))
+		check(os.WriteFile(fileName, change(content), 0o644), "write file fail")
+		fingerprint, err := load_checkpoint.Fingerprint(fileName)
+		check(err, "fingerprint fail")
+		if fingerprints[fingerprint] {
+			t.Errorf("fingerprint of changed file %v isn't changed", i)
+		}
+		fingerprints[fingerprint] = true
+
+		again, err := load_checkpoint.Fingerprint(fileName)
+		check(err, "fingerprint fail")
+		if again != fingerprint {
+			t.Errorf("fingerprint of the same file is %v but expected %v", again, fingerprint)
+		}
+	}
+}
+
+func TestSkipStatements(t *testing.T) {
+	prefix := "SET statement_timeout = 0;\n" +
+		"SELECT pg_catalog.set_config('search_path', '', false);\n" +
+		"CREATE TABLE public.a (id integer);\n" +
+		"COPY public.a (id) FROM stdin;\n1\nSET x = 1;\n\\.\n" +
+		"SET search_path = public;\n"
+	rest := "INSERT INTO a VALUES (2);\n"
+	reader := strings.NewReader(prefix + rest)
+
+	replayed := make([]string, 0)
+	check(load_checkpoint.SkipStatements(reader, dialect.PSQL, int64(len(prefix)),
+		func(statementText string, statement ast.Statement, parseError error) {
+			replayed = append(replayed, strings.TrimSpace(statementText))
+		}), "skip statements fail")
+	expected := []string{
+		"SET statement_timeout = 0;",
+		"SELECT pg_catalog.set_config('search_path', '', false);",
+		"CREATE TABLE public.a (id integer);",
+		"SET search_path = public;",
+	}
+	if !slices.Equal(replayed, expected) {
+		t.Errorf("replayed statements are %q but expected %q", replayed, expected)
+	}
+	// The reader is positioned at the offset
+	remaining, err := io.ReadAll(reader)
+	check(err, "read rest fail")
+	if string(remaining) != rest {
+		t.Errorf("rest of the entry is %q but expected %q", remaining, rest)
+	}
+
+	if err := load_checkpoint.SkipStatements(strings.NewReader(prefix), dialect.PSQL, int64(len(prefix))+1,
+		func(statementText string, statement ast.Statement, parseError error) {}); err == nil {
+		t.Errorf("offset after the end of the entry is accepted")
+	}
+}
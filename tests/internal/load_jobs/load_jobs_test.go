@@ -0,0 +1,276 @@
+package load_jobs_tests
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/usalko/prodl/internal/load_jobs"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser"
+	"github.com/usalko/prodl/internal/sql_parser/ast"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+// call is the statement executed by the connection
+type call struct {
+	connection string
+	sql        string
+}
+
+// callLog records the calls of all connections in the order of execution
+type callLog struct {
+	mutex sync.Mutex
+	calls []call
+}
+
+func (log *callLog) add(connection string, sql string) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.calls = append(log.calls, call{connection, sql})
+}
+
+// statements returns the statements of the connection (all connections if it's empty)
+// which start with the prefix
+func (log *callLog) statements(connection string, prefix string) []string {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	statements := make([]string, 0)
+	for _, call := range log.calls {
+		if (connection == "" || call.connection == connection) && strings.HasPrefix(call.sql, prefix) {
+			statements = append(statements, call.sql)
+		}
+	}
+	return statements
+}
+
+// index returns the position of the statement in the log
+func (log *callLog) index(connection string, sql string) int {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return slices.Index(log.calls, call{connection, sql})
+}
+
+// recordingConnection records the executed statements, the execution of INSERT is delayed
+// to let the statements of other connections overtake it
+type recordingConnection struct {
+	name  string
+	log   *callLog
+	delay time.Duration
+}
+
+func (connection *recordingConnection) Establish(connectionOptions string) error {
+	return nil
+}
+
+func (connection *recordingConnection) Execute(rawSql string) error {
+	if strings.HasPrefix(rawSql, "INSERT") {
+		time.Sleep(connection.delay)
+	}
+	connection.log.add(connection.name, rawSql)
+	return nil
+}
+
+func (connection *recordingConnection) CopyFrom(rawSql string, data io.Reader) error {
+	content, err := io.ReadAll(data)
+	connection.log.add(connection.name, rawSql+"\n"+string(content))
+	return err
+}
+
+func (connection *recordingConnection) Begin() error {
+	return nil
+}
+
+func (connection *recordingConnection) Commit() error {
+	return nil
+}
+
+func (connection *recordingConnection) Rollback() error {
+	return nil
+}
+
+func (connection *recordingConnection) Close() error {
+	connection.log.add(connection.name, "<close>")
+	return nil
+}
+
+// newJobs makes the jobs with the recording connections: "main" and "job1", "job2" etc.
+func newJobs(t *testing.T, count int) (*load_jobs.LoadJobs, *callLog) {
+	log := &callLog{}
+	connections := 0
+	jobs, err := load_jobs.NewLoadJobs(&recordingConnection{name: "main", log: log}, count,
+		func() (sql_connection.SqlConnection, error) {
+			connections++
+			return &recordingConnection{name: fmt.Sprintf("job%d", connections), log: log, delay: time.Millisecond}, nil
+		},
+		func(statementText string, err error) {
+			t.Errorf("statement %v fail with error %v", statementText, err)
+		})
+	check(err, "make jobs fail")
+	return jobs, log
+}
+
+func parse(sql string) ast.Statement {
+	statement, err := sql_parser.Parse(sql, dialect.PSQL)
+	check(err, "parse %s fail", sql)
+	return statement
+}
+
+func execute(jobs *load_jobs.LoadJobs, sql string, statement ast.Statement) {
+	jobs.Execute(sql, statement, func(connection sql_connection.SqlConnection) {
+		check(connection.Execute(sql))
+	})
+}
+
+// connectionOf returns the connection which executed the statements, the empty string
+// if the statements are executed by different connections
+func connectionOf(log *callLog, statements []string) string {
+	connection := ""
+	for _, statement := range statements {
+		for _, name := range []string{"main", "job1", "job2", "job3"} {
+			if log.index(name, statement) >= 0 {
+				if connection != "" && connection != name {
+					return ""
+				}
+				connection = name
+			}
+		}
+	}
+	return connection
+}
+
+func TestLoadJobsTableOrder(t *testing.T) {
+	jobs, log := newJobs(t, 3)
+	expected := make(map[string][]string)
+	for i := range 20 {
+		for _, table := range []string{"a", "b", "c", "d"} {
+			sql := fmt.Sprintf("INSERT INTO %s VALUES (%d)", table, i)
+			execute(jobs, sql, parse(sql))
+			expected[table] = append(expected[table], sql)
+		}
+	}
+	check(jobs.Close(), "close jobs fail")
+
+	for table, statements := range expected {
+		// The statements of the table are executed by the same job in order
+		if actual := log.statements("", "INSERT INTO "+table+" "); !slices.Equal(actual, statements) {
+			t.Errorf("statements of table %v are %q but expected %q", table, actual, statements)
+		}
+		if connection := connectionOf(log, statements); connection == "" || connection == "main" {
+			t.Errorf("statements of table %v aren't executed by one job", table)
+		}
+	}
+}
+
+func TestLoadJobsBarrier(t *testing.T) {
+	jobs, log := newJobs(t, 2)
+	for i := range 10 {
+		for _, table := range []string{"a", "b"} {
+			sql := fmt.Sprintf("INSERT INTO %s VALUES (%d)", table, i)
+			execute(jobs, sql, parse(sql))
+		}
+	}
+	// The DDL of the table waits for the data of the table
+	execute(jobs, "DROP TABLE a", parse("DROP TABLE a"))
+	dropped := log.index("main", "DROP TABLE a")
+	for _, insert := range log.statements("", "INSERT INTO a ") {
+		if index := log.index(connectionOf(log, []string{insert}), insert); index < 0 || index > dropped {
+			t.Errorf("statement %v is executed after DROP TABLE a", insert)
+		}
+	}
+	if count := len(log.statements("", "INSERT INTO a ")); count != 10 {
+		t.Errorf("count of executed INSERT statements of table a is %v before DROP TABLE a", count)
+	}
+
+	// The statement which isn't parsed waits for all tasks
+	execute(jobs, "INSERT INTO b VALUES (10)", parse("INSERT INTO b VALUES (10)"))
+	execute(jobs, "CREATE FUNCTION f() RETURNS void AS $$ $$ LANGUAGE sql", nil)
+	if count := len(log.statements("", "INSERT INTO b ")); count != 11 {
+		t.Errorf("count of executed INSERT statements of table b is %v before the unknown statement", count)
+	}
+	check(jobs.Close(), "close jobs fail")
+}
+
+func TestLoadJobsSessionStatements(t *testing.T) {
+	jobs, log := newJobs(t, 3)
+	execute(jobs, "INSERT INTO a VALUES (1)", parse("INSERT INTO a VALUES (1)"))
+	execute(jobs, "SET search_path = public", parse("SET search_path = public"))
+	execute(jobs, "INSERT INTO a VALUES (2)", parse("INSERT INTO a VALUES (2)"))
+	// The transactions of the dump are skipped
+	execute(jobs, "BEGIN", parse("BEGIN"))
+	check(jobs.Close(), "close jobs fail")
+
+	for _, connection := range []string{"main", "job1", "job2", "job3"} {
+		if statements := log.statements(connection, "SET"); !slices.Equal(statements, []string{"SET search_path = public"}) {
+			t.Errorf("session statements of %v are %q", connection, statements)
+		}
+	}
+	// The session statement is executed by the job between the statements of the table
+	job := connectionOf(log, []string{"INSERT INTO a VALUES (1)", "INSERT INTO a VALUES (2)"})
+	set := log.index(job, "SET search_path = public")
+	if log.index(job, "INSERT INTO a VALUES (1)") > set || log.index(job, "INSERT INTO a VALUES (2)") < set {
+		t.Errorf("session statement isn't executed in order by %v: %v", job, log.statements(job, ""))
+	}
+	if statements := log.statements("", "BEGIN"); len(statements) != 0 {
+		t.Errorf("transaction statements %q are executed", statements)
+	}
+}
+
+func TestLoadJobsCopyFrom(t *testing.T) {
+	jobs, log := newJobs(t, 2)
+	sql := "COPY public.a (id) FROM stdin"
+	check(jobs.CopyFrom(sql, parse(sql), strings.NewReader("1\n2\n"),
+		func(connection sql_connection.SqlConnection, data io.Reader) {
+			check(connection.CopyFrom(sql, data))
+		}), "copy fail")
+	check(jobs.Close(), "close jobs fail")
+
+	if statements := log.statements("", sql); len(statements) != 1 || statements[0] != sql+"\n1\n2\n" {
+		t.Errorf("COPY statements are %q", statements)
+	} else if connection := connectionOf(log, statements); connection == "" || connection == "main" {
+		t.Errorf("COPY statement isn't executed by the job")
+	}
+}
+
+func TestSpoolCopyData(t *testing.T) {
+	for _, size := range []int{0, 100, load_jobs.COPY_DATA_MEMORY_SIZE, load_jobs.COPY_DATA_MEMORY_SIZE + 1, 3 * load_jobs.COPY_DATA_MEMORY_SIZE} {
+		data := bytes.Repeat([]byte("0123456789abcde\n"), size/16+1)[:size]
+		spooled, err := load_jobs.SpoolCopyData(bytes.NewReader(data))
+		check(err, "spool %v bytes fail", size)
+
+		// The data over the memory size is spooled to the temporary file
+		file, isFile := spooled.(interface{ Name() string })
+		if isFile != (size > load_jobs.COPY_DATA_MEMORY_SIZE) {
+			t.Errorf("data of %v bytes is spooled to the file: %v", size, isFile)
+		}
+		content, err := io.ReadAll(spooled)
+		check(err, "read spooled data fail")
+		if !bytes.Equal(content, data) {
+			t.Errorf("spooled data of %v bytes differs", size)
+		}
+		check(spooled.Close(), "close spooled data fail")
+		if isFile {
+			if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+				t.Errorf("spool file %v isn't removed", file.Name())
+			}
+		}
+	}
+}
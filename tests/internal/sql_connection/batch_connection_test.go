@@ -0,0 +1,229 @@
+package sql_connection_tests
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/sql_connection"
+)
+
+func check(err error, msgs ...any) {
+	if err != nil {
+		if len(msgs) == 0 {
+			panic(err)
+		} else if len(msgs) == 1 {
+			panic(fmt.Errorf("%s: %s", msgs[0], err))
+		} else {
+			panic(fmt.Errorf("%s: %s", fmt.Sprintf(msgs[0].(string), msgs[1:]...), err))
+		}
+	}
+}
+
+// recordingConnection records the calls of SqlConnection, the execution of the failed statement fails
+type recordingConnection struct {
+	calls  []string
+	failed string
+}
+
+func (connection *recordingConnection) Establish(connectionOptions string) error {
+	return nil
+}
+
+func (connection *recordingConnection) Execute(rawSql string) error {
+	connection.calls = append(connection.calls, rawSql)
+	if rawSql == connection.failed {
+		return fmt.Errorf("statement %s fails", rawSql)
+	}
+	return nil
+}
+
+func (connection *recordingConnection) CopyFrom(rawSql string, data io.Reader) error {
+	connection.calls = append(connection.calls, rawSql)
+	return nil
+}
+
+func (connection *recordingConnection) Begin() error {
+	connection.calls = append(connection.calls, "<begin>")
+	return nil
+}
+
+func (connection *recordingConnection) Commit() error {
+	connection.calls = append(connection.calls, "<commit>")
+	return nil
+}
+
+func (connection *recordingConnection) Rollback() error {
+	connection.calls = append(connection.calls, "<rollback>")
+	return nil
+}
+
+func (connection *recordingConnection) Close() error {
+	connection.calls = append(connection.calls, "<close>")
+	return nil
+}
+
+func TestBatchConnection(t *testing.T) {
+	recording := &recordingConnection{}
+	connection := sql_connection.NewBatchConnection(recording, 2, 0)
+
+	for _, rawSql := range []string{
+		"INSERT 1;",
+		"INSERT 2;",
+		"INSERT 3;",
+		"\nBEGIN TRANSACTION;",
+		"INSERT 4;",
+		"COMMIT;",
+		"INSERT 5;",
+	} {
+		check(connection.Execute(rawSql), "execute %s fail", rawSql)
+	}
+	check(connection.CopyFrom("COPY a FROM stdin;", strings.NewReader("1\n")), "copy fail")
+	check(connection.Execute("INSERT 6;"), "execute INSERT 6; fail")
+	check(connection.Close(), "close fail")
+
+	expectedCalls := []string{
+		"<begin>", "INSERT 1;", "INSERT 2;", "<commit>",
+		"<begin>", "INSERT 3;", "<commit>",
+		"<begin>", "INSERT 4;", "<commit>",
+		"<begin>", "INSERT 5;", "<commit>",
+		"COPY a FROM stdin;",
+		"<begin>", "INSERT 6;", "<commit>",
+		"<close>",
+	}
+	if !slices.Equal(recording.calls, expectedCalls) {
+		t.Errorf("calls are %q but expected %q", recording.calls, expectedCalls)
+	}
+}
+
+func TestBatchConnectionBytes(t *testing.T) {
+	recording := &recordingConnection{}
+	connection := sql_connection.NewBatchConnection(recording, 0, 16)
+
+	for _, rawSql := range []string{"INSERT 1;", "INSERT 2;", "INSERT 3;"} {
+		check(connection.Execute(rawSql), "execute %s fail", rawSql)
+	}
+	check(connection.Close(), "close fail")
+
+	expectedCalls := []string{
+		"<begin>", "INSERT 1;", "INSERT 2;", "<commit>",
+		"<begin>", "INSERT 3;", "<commit>",
+		"<close>",
+	}
+	if !slices.Equal(recording.calls, expectedCalls) {
+		t.Errorf("calls are %q but expected %q", recording.calls, expectedCalls)
+	}
+}
+
+func TestBatchConnectionRestore(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "batch.sqlite3")
+	connection := sql_connection.NewBatchConnection(&sql_connection.Sqlite3Connection{}, 10, 0)
+	check(connection.Establish("file:"+fileName), "establish connection fail")
+
+	check(connection.Execute("CREATE TABLE a (id integer PRIMARY KEY);"), "create table fail")
+	check(connection.Execute("INSERT INTO a VALUES (1);"), "insert fail")
+	check(connection.Execute("INSERT INTO a VALUES (2);"), "insert fail")
+	if err := connection.Execute("INSERT INTO a VALUES (1);"); err == nil {
+		t.Errorf("insert of duplicate key doesn't fail")
+	}
+	check(connection.Execute("INSERT INTO a VALUES (3);"), "insert fail")
+	check(connection.Close(), "close fail")
+
+	db, err := sql.Open("sqlite3", "file:"+fileName)
+	check(err, "open database fail")
+	defer db.Close()
+	var count int
+	check(db.QueryRow("SELECT count(*) FROM a").Scan(&count), "count rows fail")
+	if count != 3 {
+		t.Errorf("count of rows is %v but expected %v", count, 3)
+	}
+}
+
+func TestBatchConnectionCommitHandler(t *testing.T) {
+	recording := &recordingConnection{}
+	connection := sql_connection.NewBatchConnection(recording, 2, 0)
+	connection.SetCommitHandler(func() {
+		recording.calls = append(recording.calls, "<committed>")
+	})
+
+	for _, rawSql := range []string{"INSERT 1;", "INSERT 2;", "BEGIN;", "INSERT 3;"} {
+		check(connection.Execute(rawSql), "execute %s fail", rawSql)
+	}
+	check(connection.CopyFrom("COPY a FROM stdin;", strings.NewReader("1\n")), "copy fail")
+	check(connection.Execute("COMMIT;"), "execute COMMIT; fail")
+	check(connection.CopyFrom("COPY a FROM stdin;", strings.NewReader("1\n")), "copy fail")
+	check(connection.Close(), "close fail")
+
+	expectedCalls := []string{
+		"<begin>", "INSERT 1;", "INSERT 2;", "<commit>", "<committed>",
+		"<begin>", "INSERT 3;", "COPY a FROM stdin;", "<commit>", "<committed>",
+		"COPY a FROM stdin;", "<committed>",
+		"<close>",
+	}
+	if !slices.Equal(recording.calls, expectedCalls) {
+		t.Errorf("calls are %q but expected %q", recording.calls, expectedCalls)
+	}
+}
+
+func TestBatchConnectionNonBatchStatements(t *testing.T) {
+	recording := &recordingConnection{}
+	connection := sql_connection.NewBatchConnection(recording, 10, 0)
+
+	for _, rawSql := range []string{
+		"INSERT 1;",
+		"CREATE INDEX CONCURRENTLY a_idx ON a (id);",
+		"INSERT 2;",
+		"VACUUM a;",
+		"-- comment\nCREATE DATABASE b;",
+		"INSERT 3;",
+		"BEGIN;",
+		"CREATE TABLE c (id integer);",
+		"COMMIT;",
+	} {
+		check(connection.Execute(rawSql), "execute %s fail", rawSql)
+	}
+	check(connection.Close(), "close fail")
+
+	expectedCalls := []string{
+		"<begin>", "INSERT 1;", "<commit>",
+		"CREATE INDEX CONCURRENTLY a_idx ON a (id);",
+		"<begin>", "INSERT 2;", "<commit>",
+		"VACUUM a;",
+		"-- comment\nCREATE DATABASE b;",
+		"<begin>", "INSERT 3;", "<commit>",
+		"<begin>", "CREATE TABLE c (id integer);", "<commit>",
+		"<close>",
+	}
+	if !slices.Equal(recording.calls, expectedCalls) {
+		t.Errorf("calls are %q but expected %q", recording.calls, expectedCalls)
+	}
+}
+
+func TestBatchConnectionRestoreWithoutDDL(t *testing.T) {
+	recording := &recordingConnection{failed: "INSERT 3;"}
+	connection := sql_connection.NewBatchConnection(recording, 10, 0)
+
+	for _, rawSql := range []string{"INSERT 1;", "CREATE TABLE a (id integer);", "INSERT 2;"} {
+		check(connection.Execute(rawSql), "execute %s fail", rawSql)
+	}
+	if err := connection.Execute("INSERT 3;"); err == nil {
+		t.Errorf("failed statement doesn't fail")
+	}
+	check(connection.Close(), "close fail")
+
+	// The DDL statement isn't executed again by the restore of batch
+	expectedCalls := []string{
+		"<begin>", "INSERT 1;", "<commit>",
+		"CREATE TABLE a (id integer);",
+		"<begin>", "INSERT 2;", "INSERT 3;", "<rollback>",
+		"<begin>", "INSERT 2;", "<commit>",
+		"<close>",
+	}
+	if !slices.Equal(recording.calls, expectedCalls) {
+		t.Errorf("calls are %q but expected %q", recording.calls, expectedCalls)
+	}
+}
@@ -0,0 +1,77 @@
+package sql_connection_tests
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+func writeFile(t *testing.T, fileName string) {
+	connection, sqlDialect, connectionOptions, err := sql_connection.ConnectUrl("file://" + fileName + "?dialect=mysql")
+	check(err)
+	if _, ok := connection.(*sql_connection.FileConnection); !ok || sqlDialect != dialect.MYSQL || connectionOptions != fileName {
+		t.Fatalf("file url makes %T (%v, %v)", connection, sqlDialect, connectionOptions)
+	}
+	check(connection.Establish(connectionOptions))
+	check(connection.Begin())
+	check(connection.Execute("create table t (a int, b text);\n"))
+	check(connection.Execute("insert into t values (1, 'x')"))
+	check(connection.CopyFrom("COPY t (a, b) FROM stdin;", strings.NewReader("2\ty\\tz\n3\t\\N")))
+	check(connection.Execute("copy t (a) from stdin;\n4\n\\."))
+	check(connection.Execute("insert into t values (5, 'w') -- the last row"))
+	check(connection.Commit())
+	check(connection.Close())
+}
+
+const expectedFile = "BEGIN;\n" +
+	"create table t (a int, b text);\n" +
+	"insert into t values (1, 'x');\n" +
+	"COPY t (a, b) FROM stdin;\n" +
+	"2\ty\\tz\n" +
+	"3\t\\N\n" +
+	"\\.\n" +
+	"copy t (a) from stdin;\n4\n\\.\n" +
+	"insert into t values (5, 'w') -- the last row\n;\n" +
+	"COMMIT;\n"
+
+func TestFileConnection(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "out.sql")
+	writeFile(t, fileName)
+	content, err := os.ReadFile(fileName)
+	check(err)
+	if string(content) != expectedFile {
+		t.Errorf("file content is\n%q\nbut expected\n%q", content, expectedFile)
+	}
+}
+
+func TestFileConnectionGzip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "out.sql.gz")
+	writeFile(t, fileName)
+	file, err := os.Open(fileName)
+	check(err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	check(err, "file %v isn't compressed", fileName)
+	content, err := io.ReadAll(reader)
+	check(err)
+	if string(content) != expectedFile {
+		t.Errorf("file content is\n%q\nbut expected\n%q", content, expectedFile)
+	}
+}
+
+func TestFileConnectionUrl(t *testing.T) {
+	if _, sqlDialect, _, err := sql_connection.ConnectUrl("file://out.sql"); err != nil || sqlDialect != dialect.PSQL {
+		t.Errorf("file url without dialect is parsed to %v (%v)", sqlDialect, err)
+	}
+	for _, sqlUrl := range []string{"file://", "file://out.sql?dialect=unknown"} {
+		if _, _, _, err := sql_connection.ConnectUrl(sqlUrl); err == nil {
+			t.Errorf("wrong url %v is accepted", sqlUrl)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package sql_connection_tests
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/usalko/prodl/internal/sql_connection"
+	"github.com/usalko/prodl/internal/sql_parser/dialect"
+)
+
+// fakePgServer accepts the connections of pg protocol and records the statements of every
+// session, the connection is dropped when the dropped statement is received
+type fakePgServer struct {
+	listener net.Listener
+	dropped  string
+	mutex    sync.Mutex
+	sessions [][]string
+}
+
+func newFakePgServer(t *testing.T, dropped string) *fakePgServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	check(err, "listen fail")
+	server := &fakePgServer{listener: listener, dropped: dropped}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakePgServer) url() string {
+	return fmt.Sprintf("pg://prodl@%v/prodl?sslmode=disable", server.listener.Addr())
+}
+
+func (server *fakePgServer) statements() [][]string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return slices.Clone(server.sessions)
+}
+
+func (server *fakePgServer) record(session int, statement string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.sessions[session] = append(server.sessions[session], statement)
+}
+
+func (server *fakePgServer) serve(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+	message, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return
+	}
+	// The cancel requests aren't the sessions
+	if _, ok := message.(*pgproto3.StartupMessage); !ok {
+		return
+	}
+	server.mutex.Lock()
+	session := len(server.sessions)
+	server.sessions = append(server.sessions, []string{})
+	server.mutex.Unlock()
+
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if backend.Flush() != nil {
+		return
+	}
+	for {
+		message, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch message := message.(type) {
+		case *pgproto3.Parse:
+			if message.Query == server.dropped {
+				return
+			}
+			server.record(session, message.Query)
+			backend.Send(&pgproto3.ParseComplete{})
+		case *pgproto3.Bind:
+			backend.Send(&pgproto3.BindComplete{})
+		case *pgproto3.Describe:
+			backend.Send(&pgproto3.NoData{})
+		case *pgproto3.Execute:
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("OK")})
+		case *pgproto3.Sync:
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if backend.Flush() != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+func TestPgConnectionRestoresSession(t *testing.T) {
+	server := newFakePgServer(t, "select 'drop'")
+	connection, sqlDialect, connectionOptions, err := sql_connection.ConnectUrl(server.url())
+	check(err, "make connection fail")
+	if sqlDialect != dialect.PSQL {
+		t.Fatalf("dialect of connection is %v", sqlDialect)
+	}
+	check(connection.Establish(connectionOptions), "establish connection fail")
+	defer connection.Close()
+
+	for _, statement := range []string{
+		"SET statement_timeout = 0",
+		"SELECT pg_catalog.set_config('search_path', '', false);",
+		"SELECT pg_catalog.set_config('application_name', 'x', true);",
+		"SET LOCAL lock_timeout = 0",
+		"SET statement_timeout = 10",
+	} {
+		check(connection.Execute(statement), "execute %v fail", statement)
+	}
+	if err := connection.Execute("select 'drop'"); err == nil {
+		t.Fatalf("statement on the dropped connection is executed")
+	}
+	// The session statements are replayed on the new connection
+	check(connection.Execute("insert into t values (1)"), "execute after reconnect fail")
+	sessions := server.statements()
+	expected := []string{
+		"SELECT pg_catalog.set_config('search_path', '', false);",
+		"SET statement_timeout = 10",
+		"insert into t values (1)",
+	}
+	if len(sessions) != 2 || !slices.Equal(sessions[1], expected) {
+		t.Fatalf("statements of sessions are %q but expected %q in the second session", sessions, expected)
+	}
+
+	// The transaction isn't continued on the new connection
+	check(connection.Begin(), "begin fail")
+	if err := connection.Execute("select 'drop'"); err == nil {
+		t.Fatalf("statement on the dropped connection is executed")
+	}
+	if err := connection.Commit(); !errors.Is(err, sql_connection.ErrTransactionLost) {
+		t.Fatalf("commit of the lost transaction returns %v", err)
+	}
+	check(connection.Execute("insert into t values (2)"), "execute after the lost transaction fail")
+	sessions = server.statements()
+	if len(sessions) != 3 || slices.Contains(sessions[2], "COMMIT") {
+		t.Errorf("statements of sessions are %q, COMMIT shouldn't be sent to the new session", sessions)
+	}
+}
@@ -89,6 +89,7 @@ func TestPreview(t *testing.T) {
 		{"/* leading comment no end select ...", ast.StmtUnknown},
 		{"-- leading single line comment no end select ...", ast.StmtUnknown},
 		{"/*!40000 ALTER TABLE `t1` DISABLE KEYS */", ast.StmtComment},
+		{"COPY public.t1 (id) FROM stdin", ast.StmtCopy},
 	}
 	for _, tcase := range testcases {
 		if got := ast.Preview(tcase.sql); got != tcase.want {
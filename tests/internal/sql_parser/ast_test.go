@@ -58,14 +58,14 @@ func TestSelect(t *testing.T) {
 
 	sel := &ast.Select{}
 	sel.AddWhere(expr)
-	buf := ast.NewTrackedBuffer(nil)
+	buf := ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	sel.Where.Format(buf)
 	want := " where a = 1"
 	if buf.String() != want {
 		t.Errorf("where: %q, want %s", buf.String(), want)
 	}
 	sel.AddWhere(expr)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	sel.Where.Format(buf)
 	want = " where a = 1"
 	if buf.String() != want {
@@ -73,14 +73,14 @@ func TestSelect(t *testing.T) {
 	}
 	sel = &ast.Select{}
 	sel.AddHaving(expr)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	sel.Having.Format(buf)
 	want = " having a = 1"
 	if buf.String() != want {
 		t.Errorf("having: %q, want %s", buf.String(), want)
 	}
 	sel.AddHaving(expr)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	sel.Having.Format(buf)
 	want = " having a = 1 and a = 1"
 	if buf.String() != want {
@@ -92,7 +92,7 @@ func TestSelect(t *testing.T) {
 	expr = tree.(*ast.Select).Where.Expr
 	sel = &ast.Select{}
 	sel.AddWhere(expr)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	sel.Where.Format(buf)
 	want = " where a = 1 or b = 1"
 	if buf.String() != want {
@@ -100,7 +100,7 @@ func TestSelect(t *testing.T) {
 	}
 	sel = &ast.Select{}
 	sel.AddHaving(expr)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	sel.Having.Format(buf)
 	want = " having a = 1 or b = 1"
 	if buf.String() != want {
@@ -143,7 +143,7 @@ func TestRemoveHints(t *testing.T) {
 		sel.From = ast.TableExprs{
 			sel.From[0].(*ast.AliasedTableExpr).RemoveHints(),
 		}
-		buf := ast.NewTrackedBuffer(nil)
+		buf := ast.NewTrackedBuffer(nil, dialect.MYSQL)
 		sel.Format(buf)
 		if got, want := buf.String(), "select * from t"; got != want {
 			t.Errorf("stripped query: %s, want %s", got, want)
@@ -158,13 +158,13 @@ func TestAddOrder(t *testing.T) {
 	dst, err := sql_parser.Parse("select * from t", dialect.MYSQL)
 	require.NoError(t, err)
 	dst.(*ast.Select).AddOrder(order)
-	buf := ast.NewTrackedBuffer(nil)
+	buf := ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	dst.Format(buf)
 	require.Equal(t, "select * from t order by foo asc", buf.String())
 	dst, err = sql_parser.Parse("select * from t union select * from s", dialect.MYSQL)
 	require.NoError(t, err)
 	dst.(*ast.Union).AddOrder(order)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	dst.Format(buf)
 	require.Equal(t, "select * from t union select * from s order by foo asc", buf.String())
 }
@@ -176,13 +176,13 @@ func TestSetLimit(t *testing.T) {
 	dst, err := sql_parser.Parse("select * from t", dialect.MYSQL)
 	require.NoError(t, err)
 	dst.(*ast.Select).SetLimit(limit)
-	buf := ast.NewTrackedBuffer(nil)
+	buf := ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	dst.Format(buf)
 	require.Equal(t, "select * from t limit 4", buf.String())
 	dst, err = sql_parser.Parse("select * from t union select * from s", dialect.MYSQL)
 	require.NoError(t, err)
 	dst.(*ast.Union).SetLimit(limit)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	dst.Format(buf)
 	require.Equal(t, "select * from t union select * from s limit 4", buf.String())
 }
@@ -366,13 +366,13 @@ func TestSetAutocommitOFF(t *testing.T) {
 
 func TestWhere(t *testing.T) {
 	var w *ast.Where
-	buf := ast.NewTrackedBuffer(nil)
+	buf := ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	w.Format(buf)
 	if buf.String() != "" {
 		t.Errorf("w.Format(nil): %q, want \"\"", buf.String())
 	}
 	w = ast.NewWhere(ast.WhereClause, nil)
-	buf = ast.NewTrackedBuffer(nil)
+	buf = ast.NewTrackedBuffer(nil, dialect.MYSQL)
 	w.Format(buf)
 	if buf.String() != "" {
 		t.Errorf("w.Format(&Where{nil}: %q, want \"\"", buf.String())
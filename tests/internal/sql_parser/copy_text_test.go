@@ -0,0 +1,47 @@
+package sql_parser
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/usalko/prodl/internal/sql_parser"
+)
+
+func TestCopyLineReader(t *testing.T) {
+	long := strings.Repeat("x", 2*sql_parser.COPY_DATA_BUFFER_SIZE)
+	data := "1\ta\n2\tb\n3\t" + long + "\n4\td"
+	reader := sql_parser.NewCopyLineReader(strings.NewReader(data), func(line string) (string, error) {
+		// The even lines are skipped, the odd lines are upper-cased
+		if strings.HasPrefix(line, "2") || strings.HasPrefix(line, "4") {
+			return "", nil
+		}
+		return strings.ToUpper(line), nil
+	})
+	content, err := io.ReadAll(iotest.OneByteReader(reader))
+	if err != nil {
+		t.Fatalf("read fail with error %v", err)
+	}
+	if expected := "1\tA\n3\t" + strings.ToUpper(long) + "\n"; string(content) != expected {
+		t.Errorf("transformed data is %.40q but expected %.40q", content, expected)
+	}
+
+	lineErr := errors.New("wrong line")
+	reader = sql_parser.NewCopyLineReader(strings.NewReader(data), func(line string) (string, error) {
+		return "", lineErr
+	})
+	if _, err := io.ReadAll(reader); err != lineErr {
+		t.Errorf("error of the transform is %v but expected %v", err, lineErr)
+	}
+
+	lines := make([]string, 0)
+	err = sql_parser.ReadCopyLines(strings.NewReader("1\n\n3"), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil || strings.Join(lines, "|") != "1\n|\n|3" {
+		t.Errorf("lines are %q (%v)", lines, err)
+	}
+}
@@ -1,7 +1,11 @@
 package sql_parser
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"slices"
 	"strings"
 	"testing"
 
@@ -228,3 +232,423 @@ SELECT * FROM public.articles_article;
 		t.Errorf("count of statements is %v but expected %v", len(parsedStatements), expectedParseStatementsCount)
 	}
 }
+
+func TestStatementStreamCopyData(t *testing.T) {
+	var copyData strings.Builder
+	for i := 0; i < 5000; i++ {
+		copyData.WriteString(fmt.Sprintf("%d\tArticle %d with the long title for the page boundaries\n", i, i))
+	}
+	stringForStream := `
+CREATE TABLE public.articles_article (
+    id bigint NOT NULL,
+    title character varying(300) NOT NULL
+);
+
+COPY public.articles_article (id, title) FROM stdin;
+` + copyData.String() + `\.
+
+COPY public.empty_table (id) FROM stdin;
+\.
+INSERT INTO public.articles_article (id, title) VALUES (5001, '` + strings.Repeat("long title with ; semicolon ", 100) + `');
+SELECT * FROM public.articles_article;
+`
+
+	var textPieces []string = make([]string, 0)
+	copyTables := make([]string, 0)
+	copyBlocks := make([]string, 0)
+	parseErrors := make([]TextAndError, 0)
+
+	err := sql_parser.StatementStreamWithCopy(
+		strings.NewReader(stringForStream),
+		dialect.PSQL,
+		// PROCESS STATEMENTS
+		func(statementText string, statement ast.Statement, parseError error) {
+			textPieces = append(textPieces, statementText)
+			if parseError != nil {
+				parseErrors = append(parseErrors, TextAndError{statementText, parseError})
+			}
+		},
+		// PROCESS COPY DATA
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			if parseError != nil {
+				parseErrors = append(parseErrors, TextAndError{statementText, parseError})
+			}
+			copyTables = append(copyTables, ast.String(statement.(*ast.CopyFrom).Table))
+			content, err := io.ReadAll(data)
+			if err != nil {
+				t.Errorf("read copy data fail: %v", err)
+			}
+			copyBlocks = append(copyBlocks, string(content))
+		},
+	)
+	if err != nil {
+		t.Errorf("%q", err)
+	}
+
+	expectedTextPiecesCount := 3
+	if len(textPieces) != expectedTextPiecesCount {
+		t.Errorf("count of text pieces is %v but expected %v", len(textPieces), expectedTextPiecesCount)
+	}
+
+	if len(parseErrors) > 0 {
+		t.Errorf("unexpected errors: %v", parseErrors)
+	}
+
+	expectedCopyTables := []string{"public.articles_article", "public.empty_table"}
+	if !slices.Equal(copyTables, expectedCopyTables) {
+		t.Errorf("copy tables are %v but expected %v", copyTables, expectedCopyTables)
+	}
+
+	if len(copyBlocks) != 2 || copyBlocks[0] != copyData.String() || copyBlocks[1] != "" {
+		t.Errorf("copy data is not the same as the source data")
+	}
+}
+
+func TestStatementStreamCopyDataCompatibility(t *testing.T) {
+	stringForStream := `COPY public.articles_article (id, title) FROM stdin;
+11	Article 1
+12	Article 2
+\.
+SELECT * FROM public.articles_article;
+`
+	var textPieces []string = make([]string, 0)
+
+	err := sql_parser.StatementStream(
+		strings.NewReader(stringForStream),
+		dialect.PSQL,
+		// PROCESS STATEMENTS
+		func(statementText string, statement ast.Statement, parseError error) {
+			textPieces = append(textPieces, statementText)
+		},
+	)
+	if err != nil {
+		t.Errorf("%q", err)
+	}
+
+	expectedCopyText := "COPY public.articles_article (id, title) FROM stdin;\n11\tArticle 1\n12\tArticle 2\n\\."
+	if len(textPieces) != 2 || textPieces[0] != expectedCopyText {
+		t.Errorf("text pieces are %q but expected the COPY statement %q and the SELECT statement", textPieces, expectedCopyText)
+	}
+}
+
+func TestStatementStreamParseErrorOffset(t *testing.T) {
+	var copyData strings.Builder
+	for i := 0; i < 100; i++ {
+		copyData.WriteString(fmt.Sprintf("%d\tArticle %d\n", i, i))
+	}
+	invalidStatements := []string{
+		"CREATE TRIGGER first AFTER INSERT ON a FOR EACH ROW EXECUTE FUNCTION f();",
+		"CREATE TRIGGER second AFTER INSERT ON a FOR EACH ROW EXECUTE FUNCTION f();",
+	}
+	stringForStream := strings.Repeat("SELECT 1;\n", 100) + "\n  " + invalidStatements[0] + `
+COPY public.articles_article (id, title) FROM stdin;
+` + copyData.String() + `\.
+` + invalidStatements[1] + `
+SELECT 2;
+`
+	offsets := make([]int64, 0)
+	err := sql_parser.StatementStreamWithCopy(
+		strings.NewReader(stringForStream),
+		dialect.PSQL,
+		// PROCESS STATEMENTS
+		func(statementText string, statement ast.Statement, parseError error) {
+			if parseError == nil {
+				return
+			}
+			var statementError sql_parser.StatementError
+			if !errors.As(parseError, &statementError) {
+				t.Fatalf("parse error %v has no offset", parseError)
+			}
+			offsets = append(offsets, statementError.Offset)
+		},
+		// PROCESS COPY DATA
+		func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+			if _, err := io.Copy(io.Discard, data); err != nil {
+				t.Errorf("read copy data fail: %v", err)
+			}
+		},
+	)
+	if err != nil {
+		t.Errorf("%q", err)
+	}
+
+	if len(offsets) != len(invalidStatements) {
+		t.Fatalf("count of parse errors is %v but expected %v", len(offsets), len(invalidStatements))
+	}
+	for i, invalidStatement := range invalidStatements {
+		expectedOffset := int64(strings.Index(stringForStream, invalidStatement))
+		if offsets[i] != expectedOffset {
+			t.Errorf("offset of parse error is %v but expected %v", offsets[i], expectedOffset)
+		}
+	}
+}
+
+func TestCopyDataRowCounter(t *testing.T) {
+	for data, expectedRows := range map[string]uint64{
+		"":                         0,
+		"1\tone\n":                 1,
+		"1\tone\n2\ttwo\n3\tthree": 3,
+	} {
+		rowCounter := sql_parser.NewCopyDataRowCounter(strings.NewReader(data))
+		if _, err := io.Copy(io.Discard, rowCounter); err != nil {
+			t.Errorf("read copy data fail: %v", err)
+		}
+		if rowCounter.Rows() != expectedRows {
+			t.Errorf("count of rows for %q is %v but expected %v", data, rowCounter.Rows(), expectedRows)
+		}
+	}
+}
+
+func TestStatementStreamMysqlDump(t *testing.T) {
+	var values strings.Builder
+	for i := 1; i <= 200; i++ {
+		if i > 1 {
+			values.WriteString(",")
+		}
+		values.WriteString(fmt.Sprintf("(%d,'Article %d; it\\'s the \"title\"','Статья %d')", i, i, i))
+	}
+	stringForStream := `-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)
+--
+-- Host: localhost    Database: phytonyms
+-- ------------------------------------------------------
+-- Server version	8.0.36
+
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET NAMES utf8mb4 */;
+/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
+
+--
+-- Table structure for table ` + "`articles_article`" + `
+--
+
+DROP TABLE IF EXISTS ` + "`articles_article`" + `;
+CREATE TABLE ` + "`articles_article`" + ` (
+  ` + "`id`" + ` bigint NOT NULL AUTO_INCREMENT,
+  ` + "`title`" + ` varchar(300) NOT NULL,
+  ` + "`author`" + ` varchar(200) NOT NULL,
+  PRIMARY KEY (` + "`id`" + `)
+) ENGINE=InnoDB AUTO_INCREMENT=201 DEFAULT CHARSET=utf8mb4;
+
+--
+-- Dumping data for table ` + "`articles_article`" + `
+--
+
+LOCK TABLES ` + "`articles_article`" + ` WRITE;
+INSERT INTO ` + "`articles_article`" + ` VALUES ` + values.String() + `;
+UNLOCK TABLES;
+/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+
+-- Dump completed on 2024-03-01 12:00:00
+`
+	var textPieces []string = make([]string, 0)
+	var parsedStatements []ast.Statement = make([]ast.Statement, 0)
+	parseErrors := make([]TextAndError, 0)
+
+	err := sql_parser.StatementStream(
+		strings.NewReader(stringForStream),
+		dialect.MYSQL,
+		// PROCESS STATEMENTS
+		func(statementText string, statement ast.Statement, parseError error) {
+			textPieces = append(textPieces, statementText)
+			if statement != nil {
+				parsedStatements = append(parsedStatements, statement)
+			}
+			if parseError != nil {
+				parseErrors = append(parseErrors, TextAndError{statementText, parseError})
+			}
+		},
+	)
+	if err != nil {
+		t.Errorf("%q", err)
+	}
+
+	expectedTextPiecesCount := 9
+	if len(textPieces) != expectedTextPiecesCount {
+		t.Errorf("count of text pieces is %v but expected %v", len(textPieces), expectedTextPiecesCount)
+	}
+
+	expectedParseErrorsCount := 0
+	if len(parseErrors) > expectedParseErrorsCount {
+		t.Errorf("unexpected errors: %v", parseErrors)
+	}
+
+	expectedParseStatementsCount := 9
+	if len(parsedStatements) != expectedParseStatementsCount {
+		t.Errorf("count of statements is %v but expected %v", len(parsedStatements), expectedParseStatementsCount)
+	}
+
+	for _, statement := range parsedStatements {
+		if insert, ok := statement.(*ast.Insert); ok {
+			if rows, ok := insert.Rows.(ast.Values); !ok || len(rows) != 200 {
+				t.Errorf("count of inserted rows is not %v", 200)
+			}
+		}
+	}
+}
+
+func TestStatementStreamSqlite3Dump(t *testing.T) {
+	var inserts strings.Builder
+	for i := 1; i <= 50; i++ {
+		inserts.WriteString(fmt.Sprintf("INSERT INTO articles VALUES(%d,'Article %d; it''s the title','Статья %d');\n", i, i, i))
+	}
+	stringForStream := `PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE articles (id INTEGER PRIMARY KEY, title TEXT NOT NULL, body TEXT);
+` + inserts.String() + `CREATE INDEX articles_title ON articles(title);
+COMMIT;
+`
+	var textPieces []string = make([]string, 0)
+	var insertStatements []*ast.Insert = make([]*ast.Insert, 0)
+
+	err := sql_parser.StatementStream(
+		strings.NewReader(stringForStream),
+		dialect.SQLITE3,
+		// PROCESS STATEMENTS
+		func(statementText string, statement ast.Statement, parseError error) {
+			textPieces = append(textPieces, strings.TrimSpace(statementText))
+			if insert, ok := statement.(*ast.Insert); ok {
+				insertStatements = append(insertStatements, insert)
+			}
+		},
+	)
+	if err != nil {
+		t.Errorf("%q", err)
+	}
+
+	expectedTextPiecesCount := 55
+	if len(textPieces) != expectedTextPiecesCount {
+		t.Errorf("count of text pieces is %v but expected %v", len(textPieces), expectedTextPiecesCount)
+	}
+
+	expectedInsertStatementsCount := 50
+	if len(insertStatements) != expectedInsertStatementsCount {
+		t.Errorf("count of insert statements is %v but expected %v", len(insertStatements), expectedInsertStatementsCount)
+	}
+
+	expectedText := "INSERT INTO articles VALUES(50,'Article 50; it''s the title','Статья 50');"
+	if !slices.Contains(textPieces, expectedText) {
+		t.Errorf("text pieces don't contain %q", expectedText)
+	}
+}
+
+func TestStatementStreamWithOffsets(t *testing.T) {
+	var copyData strings.Builder
+	for i := 0; i < 100; i++ {
+		copyData.WriteString(fmt.Sprintf("%d\tArticle %d\n", i, i))
+	}
+	stringForStream := strings.Repeat("SELECT 1;\n", 100) + `COPY public.articles_article (id, title) FROM stdin;
+` + copyData.String() + `\.
+SELECT 2;
+SELECT 3;`
+
+	// Read the stream from the offset, the statements (the COPY data for the COPY statement) and the end offsets are collected
+	readFrom := func(startOffset int64) ([]string, []int64) {
+		statements := make([]string, 0)
+		offsets := make([]int64, 0)
+		err := sql_parser.StatementStreamWithOffsets(
+			strings.NewReader(stringForStream[startOffset:]),
+			dialect.PSQL,
+			startOffset,
+			// PROCESS STATEMENTS
+			func(statementText string, statement ast.Statement, parseError error) {
+				statements = append(statements, strings.TrimSpace(statementText))
+			},
+			// PROCESS COPY DATA
+			func(statementText string, statement ast.Statement, parseError error, data io.Reader) {
+				content, err := io.ReadAll(data)
+				if err != nil {
+					t.Errorf("read copy data fail: %v", err)
+				}
+				statements = append(statements, string(content))
+			},
+			// PROCESS OFFSETS
+			func(endOffset int64) {
+				offsets = append(offsets, endOffset)
+			},
+		)
+		if err != nil {
+			t.Errorf("%q", err)
+		}
+		return statements, offsets
+	}
+
+	statements, offsets := readFrom(0)
+	if len(statements) != 103 || len(offsets) != 103 {
+		t.Fatalf("count of statements is %v (offsets %v) but expected %v", len(statements), len(offsets), 103)
+	}
+	expectedCopyEnd := int64(strings.Index(stringForStream, "SELECT 2;"))
+	if offsets[100] != expectedCopyEnd {
+		t.Errorf("end offset of COPY is %v but expected %v", offsets[100], expectedCopyEnd)
+	}
+	if offsets[102] != int64(len(stringForStream)) {
+		t.Errorf("end offset of last statement is %v but expected %v", offsets[102], len(stringForStream))
+	}
+
+	// The stream resumed from the end offset of every statement yields the rest of statements
+	for i, offset := range offsets {
+		restStatements, restOffsets := readFrom(offset)
+		if !slices.Equal(restStatements, statements[i+1:]) {
+			t.Fatalf("statements after offset %v are %q but expected %q", offset, restStatements, statements[i+1:])
+		}
+		if !slices.Equal(restOffsets, offsets[i+1:]) {
+			t.Fatalf("offsets after offset %v are %v but expected %v", offset, restOffsets, offsets[i+1:])
+		}
+	}
+}
+
+func TestStatementStreamPsqlFunctions(t *testing.T) {
+	functions := []string{`CREATE FUNCTION public.update_modified_column() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.modified = now();
+    RETURN NEW;
+END;
+$$;`, `ALTER FUNCTION public.update_modified_column() OWNER TO postgres;`, `CREATE FUNCTION public.user_name(user_id integer) RETURNS text
+    LANGUAGE plpgsql STABLE
+    AS $_$
+DECLARE
+    result text;
+BEGIN
+    SELECT name INTO result FROM public.users WHERE id = $1;
+    RETURN coalesce(result, 'unknown; user');
+END;
+$_$;`, `CREATE FUNCTION public.slugify(value text) RETURNS text
+    LANGUAGE sql IMMUTABLE
+    AS $function$
+  SELECT regexp_replace(lower($$a;b$$ || value), '[^a-z0-9]+', '-', 'g');
+$function$;`, `DO $$
+BEGIN
+    RAISE NOTICE 'done; %', $q$it's$q$;
+END
+$$;`, `CREATE TABLE public.users (
+    id integer NOT NULL,
+    name text
+);`}
+
+	// The page boundary is moved through the statements by the comment of the growing length
+	for padding := 0; padding <= sql_parser.PAGE_SIZE; padding++ {
+		stringForStream := "-- " + strings.Repeat("x", padding) + "\n\n" + strings.Join(functions, "\n\n") + "\n"
+		statements := make([]string, 0)
+		err := sql_parser.StatementStream(
+			strings.NewReader(stringForStream),
+			dialect.PSQL,
+			// PROCESS STATEMENTS
+			func(statementText string, statement ast.Statement, parseError error) {
+				statements = append(statements, strings.TrimSpace(statementText))
+			},
+		)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+		statements[0] = strings.TrimSpace(statements[0][strings.Index(statements[0], "\n"):])
+		if len(statements) != len(functions) {
+			t.Fatalf("padding %v: count of statements is %v but expected %v: %q", padding, len(statements), len(functions), statements)
+		}
+		for i, statement := range statements {
+			if statement != functions[i] {
+				t.Fatalf("padding %v: statement is %q but expected %q", padding, statement, functions[i])
+			}
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/usalko/prodl/internal/sql_parser"
 	"github.com/usalko/prodl/internal/sql_parser/dialect"
 	"github.com/usalko/prodl/internal/sql_parser/mysql"
+	"github.com/usalko/prodl/internal/sql_parser/psql"
 )
 
 func TestLiteralID(t *testing.T) {
@@ -167,6 +168,66 @@ func TestString(t *testing.T) {
 	}
 }
 
+func TestPsqlDollarString(t *testing.T) {
+	testcases := []struct {
+		in   string
+		id   int
+		want string
+	}{{
+		in:   "$$$$",
+		id:   psql.STRING,
+		want: "",
+	}, {
+		in:   "$$ BEGIN RETURN 'a;b'; END; $$ LANGUAGE plpgsql",
+		id:   psql.STRING,
+		want: " BEGIN RETURN 'a;b'; END; ",
+	}, {
+		in:   "$body$ SELECT $$x$$; $body$",
+		id:   psql.STRING,
+		want: " SELECT $$x$$; ",
+	}, {
+		in:   "$_1$\\n'$_1$",
+		id:   psql.STRING,
+		want: "\\n'",
+	}, {
+		in:   "$1",
+		id:   psql.ID,
+		want: "$1",
+	}, {
+		in:   "$x ",
+		id:   psql.ID,
+		want: "$x",
+	}, {
+		in:   "$$ BEGIN",
+		id:   psql.LEX_ERROR,
+		want: "$$ BEGIN",
+	}, {
+		in:   "$body",
+		id:   psql.LEX_ERROR,
+		want: "$body",
+	}, {
+		in:   "$body$ BEGIN $$",
+		id:   psql.LEX_ERROR,
+		want: "$body$ BEGIN $$",
+	}, {
+		in:   "price$",
+		id:   psql.ID,
+		want: "price$",
+	}}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.in, func(t *testing.T) {
+			tokenizer, err := sql_parser.NewStringTokenizer(tcase.in, dialect.PSQL)
+			if err != nil {
+				t.Fatalf("%q", err)
+			}
+			id, got := tokenizer.Scan()
+			require.Equal(t, tcase.id, id, "Scan(%q) = (%d), want (%d)", tcase.in, id, tcase.id)
+			require.Equal(t, tcase.want, got)
+		})
+	}
+}
+
 func TestSplitStatement(t *testing.T) {
 	testcases := []struct {
 		in  string
@@ -180,3 +180,54 @@ func TestCanonicalOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestDialectOutput(t *testing.T) {
+	testcases := []struct {
+		sqlDialect dialect.SqlDialect
+		input      string
+		output     string
+	}{
+		{dialect.MYSQL, "select * from t limit 10 offset 5", "select * from t limit 5, 10"},
+		{dialect.MYSQL, "select a from `select`", "select a from `select`"},
+		{dialect.MYSQL, "insert into t values (1, 'x''y', true, null)", "insert into t values (1, 'x\\'y', true, null)"},
+		{dialect.MYSQL, "create table t (id int unsigned zerofill, d datetime)", "create table t (\n\tid int unsigned zerofill,\n\td datetime\n)"},
+		{dialect.PSQL, "select * from t limit 10 offset 5", "select * from t limit 10 offset 5"},
+		{dialect.PSQL, "select a from `select`", `select a from "select"`},
+		{dialect.PSQL, `insert into "order"("key", val) values (1, 'x''y', true, false, null)`, `insert into "order"("key", val) values (1, 'x''y', true, false, null)`},
+		{dialect.PSQL, "create table t (id int primary key, b boolean default false)", "create table t (\n\tid integer primary key,\n\tb boolean default false\n)"},
+		{dialect.PSQL, "delete from t where id in (1, 2) limit 3", "delete from t where id in (1, 2) limit 3"},
+		{dialect.SQLITE3, "select * from t limit 10 offset 5", "select * from t limit 10 offset 5"},
+		{dialect.SQLITE3, "insert into t values (1, 'x''y', null)", "insert into t values (1, 'x''y', null)"},
+		{dialect.SQLITE3, "update t set a = 'it''s' limit 3", "update t set a = 'it''s' limit 3"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.sqlDialect.String()+" "+tc.input, func(t *testing.T) {
+			tree, err := sql_parser.Parse(tc.input, tc.sqlDialect)
+			require.NoError(t, err, tc.input)
+			output := ast.DialectString(tree, tc.sqlDialect)
+			require.Equal(t, tc.output, output)
+
+			// The output is parsed by the grammar of the dialect and printed again
+			tree, err = sql_parser.Parse(output, tc.sqlDialect)
+			require.NoError(t, err, output)
+			require.Equal(t, tc.output, ast.DialectString(tree, tc.sqlDialect))
+		})
+	}
+}
+
+func TestDialectOutputOfMysqlTree(t *testing.T) {
+	tree, err := sql_parser.Parse("create table `a` (`id` int(11) unsigned not null, `d` datetime, `l` longtext character set utf8mb4, `p` double(10,2), `b` blob)", dialect.MYSQL)
+	require.NoError(t, err)
+	require.Equal(t, "create table a (\n\tid integer not null,\n\td timestamp,\n\tl text,\n\tp double precision,\n\tb bytea\n)",
+		ast.DialectString(tree, dialect.PSQL))
+
+	// The identifiers are quoted by double quotes for pg and sqlite3
+	tree, err = sql_parser.Parse("select `a b` from `select`", dialect.MYSQL)
+	require.NoError(t, err)
+	require.Equal(t, `select "a b" from "select"`, ast.DialectString(tree, dialect.PSQL))
+	require.Equal(t, `select "a b" from "select"`, ast.DialectString(tree, dialect.SQLITE3))
+
+	require.Equal(t, "true", ast.DialectString(ast.BoolVal(true), dialect.PSQL))
+	require.Equal(t, "1", ast.DialectString(ast.BoolVal(true), dialect.SQLITE3))
+	require.Equal(t, "0", ast.DialectString(ast.BoolVal(false), dialect.SQLITE3))
+}